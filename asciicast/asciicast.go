@@ -0,0 +1,345 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package asciicast reads and writes Asciinema recordings in the
+// asciicast v2 format.
+//
+// An asciicast starts with a header line, which is a JSON object that
+// contains the recording's settings. Every other line is an event: a
+// JSON array that contains the event's time, type and data.
+//
+// Fields and event types that this package does not know about are kept
+// as they are, so that a recording can be read and written again without
+// losing anything.
+package asciicast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of the asciicast format supported by this
+// package.
+const Version int = 2
+
+// EventType is the type of an event, which is the second element of an
+// event's array.
+type EventType string
+
+// Event types defined by the asciicast v2 format.
+const (
+	// Output is data printed to the terminal.
+	Output EventType = "o"
+	// Input is data typed by the user.
+	Input EventType = "i"
+	// Marker marks a point in the recording. Its data is a label.
+	Marker EventType = "m"
+	// Resize changes the size of the terminal. Its data is COLSxROWS.
+	Resize EventType = "r"
+)
+
+// Theme is the color theme of the terminal that was recorded.
+type Theme struct {
+	Fg      string `json:"fg"`
+	Bg      string `json:"bg"`
+	Palette string `json:"palette"`
+}
+
+// Header contains the settings of a recording. Only the version, width
+// and height are required.
+type Header struct {
+	Version       int
+	Width         int
+	Height        int
+	Timestamp     int64
+	Duration      float64
+	IdleTimeLimit float64
+	Command       string
+	Title         string
+	Env           map[string]string
+	Theme         *Theme
+	// Extra contains the fields that are not part of the format, by
+	// name. They are written back as they were read.
+	Extra map[string]json.RawMessage
+}
+
+// headerFields are the fields of the header that are known by this
+// package, in the order they are written.
+var headerFields = []string{"version", "width", "height", "timestamp", "duration", "idle_time_limit", "command", "title", "env", "theme"}
+
+// UnmarshalJSON reads a header line. Unknown fields are saved in Extra.
+func (h *Header) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if fields == nil {
+		return fmt.Errorf("header is not an object")
+	}
+
+	*h = Header{}
+	targets := map[string]interface{}{
+		"version":         &h.Version,
+		"width":           &h.Width,
+		"height":          &h.Height,
+		"timestamp":       &h.Timestamp,
+		"duration":        &h.Duration,
+		"idle_time_limit": &h.IdleTimeLimit,
+		"command":         &h.Command,
+		"title":           &h.Title,
+		"env":             &h.Env,
+		"theme":           &h.Theme,
+	}
+	for name, value := range fields {
+		target, known := targets[name]
+		if !known {
+			if h.Extra == nil {
+				h.Extra = make(map[string]json.RawMessage)
+			}
+			h.Extra[name] = value
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return fmt.Errorf("invalid %q: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes a header line. Known fields are written first, in
+// the order used by Asciinema, and are omitted when they are not set.
+// Extra fields are written afterwards, sorted by name.
+func (h Header) MarshalJSON() ([]byte, error) {
+	fields := []objectField{
+		{"version", h.Version},
+		{"width", h.Width},
+		{"height", h.Height},
+	}
+	if h.Timestamp != 0 {
+		fields = append(fields, objectField{"timestamp", h.Timestamp})
+	}
+	if h.Duration != 0 {
+		fields = append(fields, objectField{"duration", h.Duration})
+	}
+	if h.IdleTimeLimit != 0 {
+		fields = append(fields, objectField{"idle_time_limit", h.IdleTimeLimit})
+	}
+	if h.Command != "" {
+		fields = append(fields, objectField{"command", h.Command})
+	}
+	if h.Title != "" {
+		fields = append(fields, objectField{"title", h.Title})
+	}
+	if h.Env != nil {
+		fields = append(fields, objectField{"env", h.Env})
+	}
+	if h.Theme != nil {
+		fields = append(fields, objectField{"theme", h.Theme})
+	}
+
+	var extra []string
+	for name := range h.Extra {
+		if !isHeaderField(name) {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		fields = append(fields, objectField{name, h.Extra[name]})
+	}
+
+	return marshalObject(fields)
+}
+
+// isHeaderField checks whether or not a field is part of the format.
+func isHeaderField(name string) bool {
+	for _, field := range headerFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a single line of a recording, after the header.
+type Event struct {
+	// Time is the number of seconds since the start of the recording.
+	Time float64
+	Type EventType
+	Data string
+	// Extra contains the elements that follow the data, if any. They
+	// are written back as they were read.
+	Extra []json.RawMessage
+
+	// rawTime is the time as it was read, so that it can be written
+	// back with the same precision if it wasn't changed.
+	rawTime string
+}
+
+// UnmarshalJSON reads an event line. An event should be an array that
+// contains at least a time, a type and some data.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return err
+	}
+	if len(elements) < 3 {
+		return fmt.Errorf("event has %d elements, want at least 3", len(elements))
+	}
+
+	*e = Event{}
+	var time json.Number
+	if err := json.Unmarshal(elements[0], &time); err != nil {
+		return fmt.Errorf("invalid time: %s", err)
+	}
+	value, err := time.Float64()
+	if err != nil || value < 0 {
+		return fmt.Errorf("invalid time %s", time)
+	}
+	e.Time = value
+	e.rawTime = time.String()
+
+	var eventType string
+	if err := json.Unmarshal(elements[1], &eventType); err != nil {
+		return fmt.Errorf("invalid type: %s", err)
+	}
+	e.Type = EventType(eventType)
+
+	if err := json.Unmarshal(elements[2], &e.Data); err != nil {
+		return fmt.Errorf("invalid data: %s", err)
+	}
+	if len(elements) > 3 {
+		e.Extra = elements[3:]
+	}
+	return nil
+}
+
+// MarshalJSON writes an event line. The time is written as it was read
+// if it wasn't changed, or with microsecond precision otherwise.
+func (e Event) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('[')
+	if value, err := strconv.ParseFloat(e.rawTime, 64); err == nil && value == e.Time {
+		buffer.WriteString(e.rawTime)
+	} else {
+		buffer.WriteString(FormatTime(e.Time))
+	}
+
+	for _, value := range []string{string(e.Type), e.Data} {
+		encoded, err := marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.WriteString(", ")
+		buffer.Write(encoded)
+	}
+	for _, extra := range e.Extra {
+		buffer.WriteString(", ")
+		buffer.Write(extra)
+	}
+	buffer.WriteByte(']')
+	return buffer.Bytes(), nil
+}
+
+// FormatTime formats a time the way Asciinema does, with at most six
+// decimals and without trailing zeros.
+func FormatTime(seconds float64) string {
+	formatted := strconv.FormatFloat(seconds, 'f', 6, 64)
+	formatted = strings.TrimRight(formatted, "0")
+	if strings.HasSuffix(formatted, ".") {
+		formatted += "0"
+	}
+	return formatted
+}
+
+// Size returns the width and height set by a resize event.
+func (e Event) Size() (int, int, error) {
+	if e.Type != Resize {
+		return 0, 0, fmt.Errorf("event of type %q is not a resize event", e.Type)
+	}
+	var width, height int
+	if _, err := fmt.Sscanf(e.Data, "%dx%d", &width, &height); err != nil {
+		return 0, 0, fmt.Errorf("invalid size %q", e.Data)
+	}
+	return width, height, nil
+}
+
+// objectField is a single field of a JSON object.
+type objectField struct {
+	name  string
+	value interface{}
+}
+
+// marshalObject encodes fields as a JSON object, in the provided order.
+// Fields are separated the same way Asciinema does it, with a space
+// after each comma and colon.
+func marshalObject(fields []objectField) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, field := range fields {
+		name, err := marshal(field.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buffer.WriteString(", ")
+		}
+		buffer.Write(name)
+		buffer.WriteString(": ")
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// marshal encodes a value as JSON without escaping HTML characters,
+// since terminal output often contains "<", ">" and "&". Raw values are
+// written as they are.
+func marshal(value interface{}) ([]byte, error) {
+	switch value := value.(type) {
+	case json.RawMessage:
+		return value, nil
+	case map[string]string:
+		var names []string
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fields := make([]objectField, len(names))
+		for i, name := range names {
+			fields[i] = objectField{name, value[name]}
+		}
+		return marshalObject(fields)
+	case *Theme:
+		return marshalObject([]objectField{{"fg", value.Fg}, {"bg", value.Bg}, {"palette", value.Palette}})
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
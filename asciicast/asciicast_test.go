@@ -0,0 +1,216 @@
+package asciicast
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCast is a recording with a field and an event type that are not
+// part of the format.
+const testCast = `{"version": 2, "width": 80, "height": 24, "timestamp": 1625778960, "idle_time_limit": 2.5, "title": "demo", "env": {"TERM": "linux"}, "x-good-bot": {"scene": 1}}
+[0.23265, "o", "root@host:/app# "]
+[0.5, "i", "ls\r"]
+[1.000000, "m", "commands_1"]
+[1.5, "r", "100x30"]
+[2.1, "x", "unknown", {"kept": true}]
+`
+
+// TestReadWriteRoundTrip reads a recording and writes it again. Unknown
+// fields and events, as well as the precision of the times, should be
+// kept.
+func TestReadWriteRoundTrip(t *testing.T) {
+	cast, err := Read(strings.NewReader(testCast))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := cast.Header
+	if header.Width != 80 || header.Height != 24 || header.IdleTimeLimit != 2.5 || header.Title != "demo" || header.Env["TERM"] != "linux" {
+		t.Errorf("Read() header = %+v", header)
+	}
+	if string(header.Extra["x-good-bot"]) != `{"scene": 1}` {
+		t.Errorf("Read() extra = %s", header.Extra["x-good-bot"])
+	}
+
+	wantTypes := []EventType{Output, Input, Marker, Resize, "x"}
+	if len(cast.Events) != len(wantTypes) {
+		t.Fatalf("Read() returned %d events, want %d", len(cast.Events), len(wantTypes))
+	}
+	for i, event := range cast.Events {
+		if event.Type != wantTypes[i] {
+			t.Errorf("event %d has type %q, want %q", i, event.Type, wantTypes[i])
+		}
+	}
+
+	var written bytes.Buffer
+	if err := cast.Write(&written); err != nil {
+		t.Fatal(err)
+	}
+	if written.String() != testCast {
+		t.Errorf("Write() =\n%s\nwant\n%s", written.String(), testCast)
+	}
+}
+
+// TestEventTime checks that changed times are written with at most six
+// decimals.
+func TestEventTime(t *testing.T) {
+	event := Event{Time: 1.0 / 3, Type: Output, Data: "<&>"}
+	line, err := event.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[0.333333, "o", "<&>"]`; string(line) != want {
+		t.Errorf("MarshalJSON() = %s, want %s", line, want)
+	}
+
+	for seconds, want := range map[float64]string{0: "0.0", 2: "2.0", 1.25: "1.25"} {
+		if got := FormatTime(seconds); got != want {
+			t.Errorf("FormatTime(%v) = %s, want %s", seconds, got, want)
+		}
+	}
+}
+
+// TestEventSize reads the size of resize events.
+func TestEventSize(t *testing.T) {
+	width, height, err := Event{Type: Resize, Data: "100x30"}.Size()
+	if err != nil || width != 100 || height != 30 {
+		t.Errorf("Size() = %d, %d, %v, want 100, 30", width, height, err)
+	}
+	if _, _, err := (Event{Type: Output, Data: "100x30"}).Size(); err == nil {
+		t.Error("Size() on an output event did not return an error")
+	}
+}
+
+// TestReaderLineErrors checks the line numbers of invalid lines, and
+// that the reader can go on after an invalid line.
+func TestReaderLineErrors(t *testing.T) {
+	reader, err := NewReader(strings.NewReader(`{"version": 2, "width": 80, "height": 24}
+[0.1, "o", "a"]
+[0.2, "o"]
+
+[0.3, "o", "b"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.Next(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = reader.Next()
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 3 {
+		t.Fatalf("Next() error = %v, want an error on line 3", err)
+	}
+	event, err := reader.Next()
+	if err != nil || event.Data != "b" || reader.Line() != 5 {
+		t.Errorf("Next() = %+v, %v on line %d, want b on line 5", event, err, reader.Line())
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Next() error = %v, want io.EOF", err)
+	}
+}
+
+// TestReadEvents makes sure that events are read as soon as their line
+// is written, and that an error from the callback stops the reading.
+func TestReadEvents(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer reader.Close()
+	firstRead := make(chan struct{})
+	go func() {
+		io.WriteString(writer, "{\"version\": 2, \"width\": 80, \"height\": 24}\n[0.1, \"o\", \"a\"]\n")
+		<-firstRead
+		io.WriteString(writer, "[0.2, \"o\", \"b\"]\n[0.3, \"o\", \"c\"]\n")
+		writer.Close()
+	}()
+
+	stop := errors.New("stop")
+	var data []string
+	done := make(chan error, 1)
+	go func() {
+		header, err := ReadEvents(reader, func(event Event) error {
+			data = append(data, event.Data)
+			if len(data) == 1 {
+				close(firstRead)
+			} else if len(data) == 2 {
+				return stop
+			}
+			return nil
+		})
+		if header.Width != 80 {
+			t.Errorf("ReadEvents() returned header %+v", header)
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != stop {
+			t.Errorf("ReadEvents() error = %v, want %v", err, stop)
+		}
+		if strings.Join(data, "") != "ab" {
+			t.Errorf("ReadEvents() read %q, want a and b", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadEvents() waited for the whole recording before reading the first event")
+	}
+}
+
+// TestNewReaderErrors checks that invalid headers are rejected.
+func TestNewReaderErrors(t *testing.T) {
+	for _, contents := range []string{"", "[0.1, \"o\", \"a\"]\n", `{"version": 1, "width": 80, "height": 24}` + "\n"} {
+		if _, err := NewReader(strings.NewReader(contents)); err == nil {
+			t.Errorf("NewReader(%q) did not return an error", contents)
+		}
+	}
+}
+
+// TestValidate checks a complete recording, a truncated one and one
+// without events.
+func TestValidate(t *testing.T) {
+	if err := Validate(strings.NewReader(testCast)); err != nil {
+		t.Errorf("Validate() returned error:\n%s", err)
+	}
+
+	truncated := testCast[:len(testCast)-10]
+	err := Validate(strings.NewReader(truncated))
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 6 {
+		t.Errorf("Validate() on a truncated recording = %v, want an error on line 6", err)
+	}
+
+	if err := Validate(strings.NewReader(`{"version": 2, "width": 80, "height": 24}` + "\n")); err == nil {
+		t.Error("Validate() on a recording without events did not return an error")
+	}
+}
+
+// TestWriteFile writes a recording in a file and reads it back.
+func TestWriteFile(t *testing.T) {
+	castPath := filepath.Join(t.TempDir(), "test.cast")
+	cast := &Cast{Header: Header{Width: 80, Height: 24}, Events: []Event{{Time: 0.5, Type: Output, Data: "hello"}}}
+	if err := cast.WriteFile(castPath); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(castPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"version\": 2, \"width\": 80, \"height\": 24}\n[0.5, \"o\", \"hello\"]\n"; string(contents) != want {
+		t.Errorf("WriteFile() wrote\n%s\nwant\n%s", contents, want)
+	}
+
+	read, err := ReadFile(castPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Events) != 1 || read.Events[0].Data != "hello" {
+		t.Errorf("ReadFile() = %+v", read)
+	}
+}
@@ -0,0 +1,328 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package asciicast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"unicode"
+
+	"github.com/TrickyTroll/good-bot-cli/vt"
+)
+
+// Length returns the time of the last event of a recording, in seconds.
+func (c *Cast) Length() float64 {
+	if len(c.Events) == 0 {
+		return 0
+	}
+	return c.Events[len(c.Events)-1].Time
+}
+
+// LimitIdle shortens every pause between two events that is longer than
+// limit seconds, so that it lasts exactly limit seconds. The events that
+// follow a shortened pause are moved earlier. The limit is also written
+// in the header's idle_time_limit, unless the header already has a lower
+// limit.
+//
+// The number of seconds that were removed from the recording is
+// returned.
+func (c *Cast) LimitIdle(limit float64) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	if c.Header.IdleTimeLimit == 0 || c.Header.IdleTimeLimit > limit {
+		c.Header.IdleTimeLimit = limit
+	}
+
+	// Times are moved in microseconds, so that removing many pauses
+	// doesn't add rounding errors.
+	maxGap := microseconds(limit)
+	var previous, removed int64
+	for i := range c.Events {
+		current := microseconds(c.Events[i].Time)
+		if gap := current - previous; gap > maxGap {
+			removed += gap - maxGap
+		}
+		previous = current
+		if removed > 0 {
+			c.Events[i].Time = seconds(current - removed)
+		}
+	}
+
+	saved := seconds(removed)
+	if c.Header.Duration != 0 {
+		c.Header.Duration = math.Max(c.Header.Duration-saved, 0)
+	}
+	return saved
+}
+
+// Cut removes the part of a recording between from and to seconds. The
+// events in that part are removed, and the events that follow are moved
+// earlier so that the recording is shorter by to - from seconds.
+//
+// What the removed events print is not lost: the recording is replayed
+// in a virtual terminal up to to seconds, and a single output event at
+// from seconds draws the screen as it is at that point. The output that
+// follows the cut then lands on the screen it was recorded on. The last
+// size set by the removed resize events is also kept.
+func (c *Cast) Cut(from float64, to float64) error {
+	if from < 0 || to <= from {
+		return fmt.Errorf("can't cut from %ss to %ss", FormatTime(from), FormatTime(to))
+	}
+	if from >= c.Length() {
+		return fmt.Errorf("can't cut from %ss, the recording ends at %ss", FormatTime(from), FormatTime(c.Length()))
+	}
+
+	start, end := microseconds(from), microseconds(to)
+	terminal := vt.New(c.Header.Width, c.Header.Height)
+	var before *vt.Screen
+	var kept, following []Event
+	var resize *Event
+	removed := false
+	for _, event := range c.Events {
+		current := microseconds(event.Time)
+		if current >= start && before == nil {
+			before = terminal.Screen()
+		}
+		if current < end {
+			replay(terminal, event)
+		}
+
+		switch {
+		case current < start:
+			kept = append(kept, event)
+		case current < end:
+			removed = true
+			if event.Type == Resize {
+				resize = &Event{Time: from, Type: Resize, Data: event.Data}
+			}
+		default:
+			event.Time = seconds(current - (end - start))
+			following = append(following, event)
+		}
+	}
+
+	// Nothing needs to be drawn again if the cut goes until the end.
+	if removed && len(following) > 0 {
+		if resize != nil {
+			kept = append(kept, *resize)
+		}
+		if output := terminal.Screen().Diff(before); output != "" {
+			kept = append(kept, Event{Time: from, Type: Output, Data: output})
+		}
+	}
+	c.Events = append(kept, following...)
+	c.updateDuration()
+	return nil
+}
+
+// replay writes an event to a virtual terminal. Output events are
+// written, and resize events change the terminal's size.
+func replay(terminal *vt.Terminal, event Event) {
+	switch event.Type {
+	case Output:
+		terminal.Write([]byte(event.Data))
+	case Resize:
+		if width, height, err := event.Size(); err == nil {
+			terminal.Resize(width, height)
+		}
+	}
+}
+
+// Trim removes the pauses at the start and at the end of a recording.
+// The recording is moved earlier so that its first output starts right
+// away, and the events that come after its last output are removed,
+// since they don't change what is shown.
+//
+// The number of seconds that were removed from the recording is
+// returned.
+func (c *Cast) Trim() float64 {
+	first, last := -1, -1
+	for i, event := range c.Events {
+		if event.Type == Output && event.Data != "" {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first == -1 {
+		return 0
+	}
+
+	length := c.Length()
+	c.Events = c.Events[:last+1]
+	offset := microseconds(c.Events[first].Time)
+	if offset > 0 {
+		for i := range c.Events {
+			current := microseconds(c.Events[i].Time)
+			c.Events[i].Time = seconds(maxInt64(current-offset, 0))
+		}
+	}
+	c.updateDuration()
+	return seconds(microseconds(length) - microseconds(c.Length()))
+}
+
+// Splice adds the events of another recording at the end of this one,
+// gap seconds after its last event. Both recordings should have the
+// same size. The other recording is drawn on top of what this one shows
+// at its end, as if it had been recorded in the same terminal.
+func (c *Cast) Splice(other *Cast, gap float64) error {
+	if other.Header.Width != c.Header.Width || other.Header.Height != c.Header.Height {
+		return fmt.Errorf("can't splice a %dx%d recording after a %dx%d one", other.Header.Width, other.Header.Height, c.Header.Width, c.Header.Height)
+	}
+	if gap < 0 {
+		return errors.New("the gap between two recordings can't be negative")
+	}
+
+	offset := microseconds(c.Length()) + microseconds(gap)
+	for _, event := range other.Events {
+		event.Time = seconds(microseconds(event.Time) + offset)
+		c.Events = append(c.Events, event)
+	}
+	c.updateDuration()
+	return nil
+}
+
+// Speed makes a recording play faster by the provided factor. A factor
+// lower than 1 makes it play slower. The header's idle time limit is
+// changed by the same factor.
+func (c *Cast) Speed(factor float64) error {
+	if factor <= 0 || math.IsInf(factor, 0) || math.IsNaN(factor) {
+		return fmt.Errorf("invalid speed factor %v", factor)
+	}
+	for i := range c.Events {
+		c.Events[i].Time = seconds(microseconds(c.Events[i].Time / factor))
+	}
+	c.Header.IdleTimeLimit /= factor
+	c.updateDuration()
+	return nil
+}
+
+// Pad makes a recording longer by adding a pause of pause seconds at its
+// end. The pause is made of output events that don't
+// print anything. If the header has an idle time limit, the events are
+// at most that far apart, so that players don't shorten the pause.
+func (c *Cast) Pad(pause float64) error {
+	if pause < 0 {
+		return fmt.Errorf("can't pad a recording with %ss", FormatTime(pause))
+	}
+	end := microseconds(c.Length()) + microseconds(pause)
+	step := end
+	if limit := microseconds(c.Header.IdleTimeLimit); limit > 0 {
+		step = limit
+	}
+	for current := microseconds(c.Length()); current < end; {
+		current += step
+		if current > end {
+			current = end
+		}
+		c.Events = append(c.Events, Event{Time: seconds(current), Type: Output, Data: ""})
+	}
+	c.updateDuration()
+	return nil
+}
+
+// SlowTyping makes a recording longer by up to extra seconds, by slowing
+// down what is typed. The pauses before each typed
+// character are made longer, in proportion to their length. Typed
+// characters are output events that print a single character, which is
+// how shells echo what is typed.
+//
+// Pauses are never made longer than the header's idle time limit, if it
+// has one. The number of seconds that were added is returned, which can
+// be less than requested if there is not enough typing.
+func (c *Cast) SlowTyping(extra float64) float64 {
+	if extra <= 0 {
+		return 0
+	}
+	limit := microseconds(c.Header.IdleTimeLimit)
+
+	// The room each pause has to grow.
+	var total int64
+	pauses := make([]int64, len(c.Events))
+	for i := 1; i < len(c.Events); i++ {
+		if !isTyped(c.Events[i]) {
+			continue
+		}
+		pauses[i] = microseconds(c.Events[i].Time) - microseconds(c.Events[i-1].Time)
+		total += pauses[i]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	wanted := microseconds(extra)
+	var added int64
+	for i := range c.Events {
+		if pauses[i] > 0 {
+			grow := wanted * pauses[i] / total
+			if limit > 0 {
+				grow = minInt64(grow, maxInt64(limit-pauses[i], 0))
+			}
+			added += grow
+		}
+		if added > 0 {
+			c.Events[i].Time = seconds(microseconds(c.Events[i].Time) + added)
+		}
+	}
+	c.updateDuration()
+	return seconds(added)
+}
+
+// isTyped checks whether or not an event prints a single character that
+// was typed.
+func isTyped(event Event) bool {
+	if event.Type != Output {
+		return false
+	}
+	runes := []rune(event.Data)
+	return len(runes) == 1 && unicode.IsPrint(runes[0])
+}
+
+// updateDuration makes the header's duration match the recording's
+// length, if the header has a duration.
+func (c *Cast) updateDuration() {
+	if c.Header.Duration != 0 {
+		c.Header.Duration = c.Length()
+	}
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// microseconds converts a time in seconds to a number of microseconds,
+// which is the precision of the times that are written.
+func microseconds(seconds float64) int64 {
+	return int64(math.Round(seconds * 1e6))
+}
+
+// seconds converts a number of microseconds to a time in seconds.
+func seconds(microseconds int64) float64 {
+	return float64(microseconds) / 1e6
+}
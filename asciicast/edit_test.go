@@ -0,0 +1,253 @@
+package asciicast
+
+import (
+	"testing"
+
+	"github.com/TrickyTroll/good-bot-cli/vt"
+)
+
+// castWithTimes returns a recording with one output event at each of the
+// provided times.
+func castWithTimes(times ...float64) *Cast {
+	cast := &Cast{Header: Header{Version: Version, Width: 80, Height: 24}}
+	for _, time := range times {
+		cast.Events = append(cast.Events, Event{Time: time, Type: Output, Data: "a"})
+	}
+	return cast
+}
+
+// eventTimes returns the time of each event of a recording.
+func eventTimes(cast *Cast) []float64 {
+	times := make([]float64, len(cast.Events))
+	for i, event := range cast.Events {
+		times[i] = event.Time
+	}
+	return times
+}
+
+// TestLimitIdle shortens the pauses of recordings.
+func TestLimitIdle(t *testing.T) {
+	var testCases = []struct {
+		times []float64
+		limit float64
+		want  []float64
+		saved float64
+	}{
+		{[]float64{0.5, 1, 1.5}, 1, []float64{0.5, 1, 1.5}, 0},
+		{[]float64{0.5, 10.5, 11, 31}, 2, []float64{0.5, 2.5, 3, 5}, 26},
+		{[]float64{5, 5.1, 5.2}, 0.5, []float64{0.5, 0.6, 0.7}, 4.5},
+		{[]float64{0.1, 0.2, 60.3}, 0.1, []float64{0.1, 0.2, 0.3}, 60},
+		{[]float64{0.5, 10.5}, 0, []float64{0.5, 10.5}, 0},
+	}
+
+	for _, tc := range testCases {
+		cast := castWithTimes(tc.times...)
+		saved := cast.LimitIdle(tc.limit)
+		if saved != tc.saved {
+			t.Errorf("LimitIdle(%v) on %v saved %v, want %v", tc.limit, tc.times, saved, tc.saved)
+		}
+		if got := eventTimes(cast); !equalTimes(got, tc.want) {
+			t.Errorf("LimitIdle(%v) on %v moved events to %v, want %v", tc.limit, tc.times, got, tc.want)
+		}
+	}
+}
+
+// TestLimitIdleHeader checks the header's idle time limit and duration
+// after shortening pauses.
+func TestLimitIdleHeader(t *testing.T) {
+	cast := castWithTimes(1, 11)
+	cast.Header.Duration = 12
+	cast.LimitIdle(2)
+	if cast.Header.IdleTimeLimit != 2 || cast.Header.Duration != 4 {
+		t.Errorf("header has idle_time_limit %v and duration %v, want 2 and 4", cast.Header.IdleTimeLimit, cast.Header.Duration)
+	}
+
+	// A lower limit that was already there is kept.
+	cast.Header.IdleTimeLimit = 0.5
+	cast.LimitIdle(3)
+	if cast.Header.IdleTimeLimit != 0.5 {
+		t.Errorf("header has idle_time_limit %v, want 0.5", cast.Header.IdleTimeLimit)
+	}
+}
+
+// TestCut removes parts of a recording.
+func TestCut(t *testing.T) {
+	var testCases = []struct {
+		from, to float64
+		want     []float64
+	}{
+		// The screen at the end of the cut is drawn at its start.
+		{1, 2, []float64{0.5, 1, 1, 1.5, 2}},
+		{0.75, 2.25, []float64{0.5, 0.75, 1, 1.5}},
+		{0, 1, []float64{0, 0, 1, 1.5, 2}},
+		{2, 10, []float64{0.5, 1}},
+		{1.2, 1.8, []float64{0.5, 1, 1.4, 1.9, 2.4}},
+	}
+	for _, tc := range testCases {
+		cast := castWithTimes(0.5, 1, 2, 2.5, 3)
+		if err := cast.Cut(tc.from, tc.to); err != nil {
+			t.Errorf("Cut(%v, %v) returned error: %s", tc.from, tc.to, err)
+			continue
+		}
+		if got := eventTimes(cast); !equalTimes(got, tc.want) {
+			t.Errorf("Cut(%v, %v) moved events to %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+
+	cast := castWithTimes(0.5, 1)
+	for _, bounds := range [][2]float64{{1, 0.5}, {-1, 0.5}, {2, 3}} {
+		if err := cast.Cut(bounds[0], bounds[1]); err == nil {
+			t.Errorf("Cut(%v, %v) did not return an error", bounds[0], bounds[1])
+		}
+	}
+}
+
+// TestCutClear cuts a part of a recording that clears the screen. What
+// is printed after the cut should be drawn on the cleared screen.
+func TestCutClear(t *testing.T) {
+	cast := &Cast{Header: Header{Version: Version, Width: 10, Height: 2}, Events: []Event{
+		{Time: 0.5, Type: Output, Data: "old"},
+		{Time: 1, Type: Output, Data: "\x1b[2J\x1b[H"},
+		{Time: 1.5, Type: Output, Data: "new"},
+		{Time: 3, Type: Output, Data: "!"},
+	}}
+	if err := cast.Cut(0.75, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := eventTimes(cast), []float64{0.5, 0.75, 1.75}; !equalTimes(got, want) {
+		t.Errorf("Cut moved events to %v, want %v", got, want)
+	}
+
+	terminal := vt.New(10, 2)
+	for _, event := range cast.Events {
+		terminal.Write([]byte(event.Data))
+	}
+	if line := terminal.Screen().Line(0); line != "new!" {
+		t.Errorf("screen shows %q after the cut, want %q", line, "new!")
+	}
+}
+
+// TestTrim removes the pauses at the start and end of a recording.
+func TestTrim(t *testing.T) {
+	cast := castWithTimes(2, 2.5, 3)
+	cast.Events = append([]Event{{Time: 0.5, Type: Output, Data: ""}}, cast.Events...)
+	cast.Events = append(cast.Events, Event{Time: 10, Type: Input, Data: "exit"})
+	cast.Header.Duration = 11
+
+	if removed := cast.Trim(); removed != 9 {
+		t.Errorf("Trim() removed %v seconds, want 9", removed)
+	}
+	if got, want := eventTimes(cast), []float64{0, 0, 0.5, 1}; !equalTimes(got, want) {
+		t.Errorf("Trim() moved events to %v, want %v", got, want)
+	}
+	if cast.Header.Duration != 1 {
+		t.Errorf("Trim() set the duration to %v, want 1", cast.Header.Duration)
+	}
+}
+
+// TestSplice adds a recording at the end of another one.
+func TestSplice(t *testing.T) {
+	cast := castWithTimes(0.5, 1)
+	if err := cast.Splice(castWithTimes(0.25, 2), 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := eventTimes(cast), []float64{0.5, 1, 1.75, 3.5}; !equalTimes(got, want) {
+		t.Errorf("Splice() moved events to %v, want %v", got, want)
+	}
+
+	other := castWithTimes(1)
+	other.Header.Width = 100
+	if err := cast.Splice(other, 0); err == nil {
+		t.Error("Splice() of recordings with different sizes did not return an error")
+	}
+}
+
+// TestSpeed changes the speed of a recording.
+func TestSpeed(t *testing.T) {
+	cast := castWithTimes(0.3, 1.5, 3)
+	cast.Header.IdleTimeLimit = 1.5
+	if err := cast.Speed(1.5); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := eventTimes(cast), []float64{0.2, 1, 2}; !equalTimes(got, want) {
+		t.Errorf("Speed(1.5) moved events to %v, want %v", got, want)
+	}
+	if cast.Header.IdleTimeLimit != 1 {
+		t.Errorf("Speed(1.5) set the idle time limit to %v, want 1", cast.Header.IdleTimeLimit)
+	}
+	if err := cast.Speed(0); err == nil {
+		t.Error("Speed(0) did not return an error")
+	}
+}
+
+// TestPad adds a pause at the end of a recording.
+func TestPad(t *testing.T) {
+	cast := castWithTimes(0.5, 1)
+	if err := cast.Pad(1.5); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := eventTimes(cast), []float64{0.5, 1, 2.5}; !equalTimes(got, want) {
+		t.Errorf("Pad(1.5) moved events to %v, want %v", got, want)
+	}
+
+	// The pause is split so that it is not longer than the idle time
+	// limit.
+	cast = castWithTimes(0.5, 1)
+	cast.Header.IdleTimeLimit = 0.5
+	if err := cast.Pad(1.2); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := eventTimes(cast), []float64{0.5, 1, 1.5, 2, 2.2}; !equalTimes(got, want) {
+		t.Errorf("Pad(1.2) moved events to %v, want %v", got, want)
+	}
+	if saved := cast.LimitIdle(0.5); saved != 0 {
+		t.Errorf("LimitIdle(0.5) shortened the padding by %v seconds", saved)
+	}
+	if err := cast.Pad(-1); err == nil {
+		t.Error("Pad(-1) did not return an error")
+	}
+}
+
+// TestSlowTyping makes the pauses before typed characters longer.
+func TestSlowTyping(t *testing.T) {
+	cast := &Cast{Header: Header{Version: Version, Width: 80, Height: 24}}
+	cast.Events = []Event{
+		{Time: 0.5, Type: Output, Data: "$ "},
+		{Time: 1, Type: Output, Data: "l"},
+		{Time: 1.5, Type: Output, Data: "s"},
+		{Time: 2, Type: Output, Data: "\r\n"},
+		{Time: 3, Type: Output, Data: "file\r\n$ "},
+	}
+	if added := cast.SlowTyping(2); added != 2 {
+		t.Errorf("SlowTyping(2) added %v seconds, want 2", added)
+	}
+	if got, want := eventTimes(cast), []float64{0.5, 2, 3.5, 4, 5}; !equalTimes(got, want) {
+		t.Errorf("SlowTyping(2) moved events to %v, want %v", got, want)
+	}
+
+	// Pauses can't be longer than the idle time limit.
+	cast.Header.IdleTimeLimit = 2
+	if added := cast.SlowTyping(10); added != 1 {
+		t.Errorf("SlowTyping(10) added %v seconds, want 1", added)
+	}
+
+	// Recordings without typing are left as they are.
+	cast = castWithTimes(0.5, 1)
+	cast.Events[1].Data = "ab"
+	if added := cast.SlowTyping(1); added != 0 {
+		t.Errorf("SlowTyping(1) added %v seconds to a recording without typing", added)
+	}
+}
+
+// equalTimes checks whether or not two lists of times are the same.
+func equalTimes(a []float64, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,292 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrTruncated is returned by Validate when the last line of a recording
+// does not end with a newline, which happens when the recording was
+// interrupted.
+var ErrTruncated = errors.New("recording is truncated")
+
+// LineError is returned when a line of a recording can't be read. Line
+// numbers start at 1, which is the header's line.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Reader reads a recording one event at a time, so that long recordings
+// don't have to fit in memory.
+type Reader struct {
+	reader *bufio.Reader
+	header Header
+	line   int
+	// Whether or not the last line that was read ended with a newline.
+	terminated bool
+}
+
+// NewReader creates a Reader and reads the recording's header. An error
+// is returned if the header is missing or invalid, or if the recording
+// uses another version of the format.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{reader: bufio.NewReader(r)}
+
+	line, err := reader.readLine()
+	if err == io.EOF {
+		return nil, &LineError{1, errors.New("recording is empty")}
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(line, &reader.header); err != nil {
+		return nil, &LineError{reader.line, fmt.Errorf("invalid header: %s", err)}
+	}
+	if reader.header.Version == 1 {
+		return nil, &LineError{reader.line, errors.New("v1 recordings can't be streamed, use Read to convert them")}
+	}
+	if reader.header.Version != Version {
+		return nil, &LineError{reader.line, fmt.Errorf("unsupported version %d", reader.header.Version)}
+	}
+	return reader, nil
+}
+
+// Header returns the header of the recording.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Line returns the number of the last line that was read.
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Next reads the next event. Blank lines are skipped. At the end of the
+// recording, io.EOF is returned.
+//
+// If a line can't be read as an event, a *LineError is returned. Next can
+// still be called afterwards to read the following events, which is
+// useful with recordings that are still being written.
+func (r *Reader) Next() (Event, error) {
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return Event{}, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return Event{}, &LineError{r.line, fmt.Errorf("invalid event: %s", err)}
+		}
+		return event, nil
+	}
+}
+
+// readLine reads a single line, without its newline.
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.reader.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return nil, io.EOF
+	} else if err != nil && err != io.EOF {
+		return nil, err
+	}
+	r.line++
+	r.terminated = err == nil
+	return bytes.TrimSuffix(line, []byte("\n")), nil
+}
+
+// ReadHeader reads the header of a recording. Only the first line of a
+// v2 recording is read. Recordings in the v1 format are read completely
+// and their header is converted to v2.
+func ReadHeader(r io.Reader) (Header, error) {
+	whole, isV2, err := peekHeader(r)
+	if err != nil {
+		return Header{}, err
+	}
+	if !isV2 {
+		return ReadEvents(whole, func(Event) error { return nil })
+	}
+
+	reader, err := NewReader(whole)
+	if err != nil {
+		return Header{}, err
+	}
+	return reader.Header(), nil
+}
+
+// ReadEvents reads a recording one event at a time, and calls each with
+// every event, in order. Unlike Read, the events are not kept in memory.
+// Recordings in the v1 format are a single JSON object, so they are read
+// completely and converted to v2 first, see ReadV1.
+//
+// The header of the recording is returned. Reading stops at the first
+// error, including one returned by each.
+func ReadEvents(r io.Reader, each func(Event) error) (Header, error) {
+	whole, isV2, err := peekHeader(r)
+	if err != nil {
+		return Header{}, err
+	}
+	if !isV2 {
+		data, err := io.ReadAll(whole)
+		if err != nil {
+			return Header{}, err
+		}
+		if detectVersion(data) == 1 {
+			cast, err := ReadV1(bytes.NewReader(data))
+			if err != nil {
+				return Header{}, err
+			}
+			for _, event := range cast.Events {
+				if err := each(event); err != nil {
+					return cast.Header, err
+				}
+			}
+			return cast.Header, nil
+		}
+		// NewReader reports what is wrong with the header.
+		whole = bytes.NewReader(data)
+	}
+
+	reader, err := NewReader(whole)
+	if err != nil {
+		return Header{}, err
+	}
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return reader.Header(), nil
+		} else if err != nil {
+			return reader.Header(), err
+		}
+		if err := each(event); err != nil {
+			return reader.Header(), err
+		}
+	}
+}
+
+// ReadFileEvents uses ReadEvents on a recording saved in a file.
+func ReadFileEvents(castPath string, each func(Event) error) (Header, error) {
+	file, err := os.Open(castPath)
+	if err != nil {
+		return Header{}, err
+	}
+	defer file.Close()
+
+	header, err := ReadEvents(file, each)
+	if err != nil {
+		return header, fmt.Errorf("%s: %w", castPath, err)
+	}
+	return header, nil
+}
+
+// peekHeader reads the first line of a recording, and checks whether or
+// not it is the header of a v2 recording. The returned reader reads the
+// whole recording, starting with that line.
+func peekHeader(r io.Reader) (io.Reader, bool, error) {
+	buffered := bufio.NewReader(r)
+	first, err := buffered.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+
+	var header Header
+	isV2 := json.Unmarshal(first, &header) == nil && header.Version == Version
+	return io.MultiReader(bytes.NewReader(first), buffered), isV2, nil
+}
+
+// Cast is a recording that has been read completely.
+type Cast struct {
+	Header Header
+	Events []Event
+}
+
+// Read reads every event of a recording. Recordings in the v1 format
+// are converted to v2, see ReadV1. The first error is returned. v2
+// recordings are decoded one line at a time, see ReadEvents.
+func Read(r io.Reader) (*Cast, error) {
+	cast := &Cast{}
+	header, err := ReadEvents(r, func(event Event) error {
+		cast.Events = append(cast.Events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	cast.Header = header
+	return cast, nil
+}
+
+// ReadFile reads every event of a recording saved in a file.
+func ReadFile(castPath string) (*Cast, error) {
+	file, err := os.Open(castPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cast, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", castPath, err)
+	}
+	return cast, nil
+}
+
+// Validate makes sure that a recording is complete. The header should be
+// valid, there should be at least one event, every event should be valid
+// and the recording should end with a newline.
+func Validate(r io.Reader) error {
+	reader, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	events := 0
+	for {
+		_, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		events++
+	}
+
+	if !reader.terminated {
+		return &LineError{reader.line, ErrTruncated}
+	}
+	if events == 0 {
+		return errors.New("recording does not contain any event")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package asciicast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// v1Fields are the fields of a v1 recording that are converted to v2
+// fields. Every other field is kept in the header's Extra fields.
+var v1Fields = []string{"version", "width", "height", "duration", "command", "title", "env", "stdout"}
+
+// detectVersion returns the version of a recording, which is found in
+// the first JSON value of the data. Zero is returned if the version
+// can't be found.
+func detectVersion(data []byte) int {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&header); err != nil {
+		return 0
+	}
+	return header.Version
+}
+
+// ReadV1 reads a recording in the v1 format and converts it to v2.
+//
+// A v1 recording is a single JSON object. Everything printed is saved in
+// its "stdout" frames, and each frame's time is the delay since the
+// previous frame. Frames become output events, which are timed from the
+// start of the recording. Times are rounded to the microsecond, so that
+// delays don't add up rounding errors.
+func ReadV1(r io.Reader) (*Cast, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid v1 recording: %s", err)
+	}
+
+	var v1 struct {
+		Version  int               `json:"version"`
+		Width    int               `json:"width"`
+		Height   int               `json:"height"`
+		Duration float64           `json:"duration"`
+		Command  string            `json:"command"`
+		Title    string            `json:"title"`
+		Env      map[string]string `json:"env"`
+		Stdout   []json.RawMessage `json:"stdout"`
+	}
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return nil, fmt.Errorf("invalid v1 recording: %s", err)
+	}
+	if v1.Version != 1 {
+		return nil, fmt.Errorf("recording has version %d, want 1", v1.Version)
+	}
+
+	cast := &Cast{Header: Header{
+		Version:  Version,
+		Width:    v1.Width,
+		Height:   v1.Height,
+		Duration: v1.Duration,
+		Command:  v1.Command,
+		Title:    v1.Title,
+		Env:      v1.Env,
+	}}
+	for _, name := range v1Fields {
+		delete(fields, name)
+	}
+	if len(fields) > 0 {
+		cast.Header.Extra = fields
+	}
+
+	var elapsed int64
+	for i, raw := range v1.Stdout {
+		var frame []json.RawMessage
+		var delay float64
+		var output string
+		if err := json.Unmarshal(raw, &frame); err != nil || len(frame) < 2 {
+			return nil, fmt.Errorf("invalid v1 recording: frame %d is not a [delay, data] pair", i+1)
+		}
+		if err := json.Unmarshal(frame[0], &delay); err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid v1 recording: frame %d has an invalid delay", i+1)
+		}
+		if err := json.Unmarshal(frame[1], &output); err != nil {
+			return nil, fmt.Errorf("invalid v1 recording: frame %d has invalid data", i+1)
+		}
+		elapsed += int64(math.Round(delay * 1e6))
+		cast.Events = append(cast.Events, Event{Time: float64(elapsed) / 1e6, Type: Output, Data: output})
+	}
+	return cast, nil
+}
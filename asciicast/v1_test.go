@@ -0,0 +1,93 @@
+package asciicast
+
+import (
+	"strings"
+	"testing"
+)
+
+// testV1Cast is a recording in the v1 format, as written by older
+// versions of Asciinema.
+const testV1Cast = `{
+  "version": 1,
+  "width": 80,
+  "height": 24,
+  "duration": 1.515,
+  "command": "/bin/bash",
+  "title": "old demo",
+  "env": {"TERM": "xterm-256color", "SHELL": "/bin/bash"},
+  "x-archive": "2016",
+  "stdout": [
+    [0.248848, "$ "],
+    [1.001376, "ls\r\n"],
+    [0.264776, "file.txt\r\n"]
+  ]
+}
+`
+
+// TestReadV1 converts a v1 recording and checks its header and events.
+func TestReadV1(t *testing.T) {
+	cast, err := ReadV1(strings.NewReader(testV1Cast))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := cast.Header
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Command != "/bin/bash" || header.Title != "old demo" || header.Env["TERM"] != "xterm-256color" {
+		t.Errorf("ReadV1() header = %+v", header)
+	}
+	if string(header.Extra["x-archive"]) != `"2016"` {
+		t.Errorf("ReadV1() did not keep the unknown fields: %v", header.Extra)
+	}
+	if _, ok := header.Extra["stdout"]; ok {
+		t.Error("ReadV1() kept the stdout frames in the header")
+	}
+
+	wantTimes := []float64{0.248848, 1.250224, 1.515}
+	if len(cast.Events) != len(wantTimes) {
+		t.Fatalf("ReadV1() returned %d events, want %d", len(cast.Events), len(wantTimes))
+	}
+	for i, event := range cast.Events {
+		if event.Time != wantTimes[i] || event.Type != Output {
+			t.Errorf("event %d = %+v, want an output event at %v", i, event, wantTimes[i])
+		}
+	}
+}
+
+// TestReadDetectsV1 makes sure that Read and ReadHeader convert v1
+// recordings, while NewReader rejects them.
+func TestReadDetectsV1(t *testing.T) {
+	cast, err := Read(strings.NewReader(testV1Cast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cast.Header.Version != 2 || len(cast.Events) != 3 {
+		t.Errorf("Read() = %+v", cast)
+	}
+
+	header, err := ReadHeader(strings.NewReader(testV1Cast))
+	if err != nil || header.Width != 80 {
+		t.Errorf("ReadHeader() = %+v, %v", header, err)
+	}
+	header, err = ReadHeader(strings.NewReader(testCast))
+	if err != nil || header.Title != "demo" {
+		t.Errorf("ReadHeader() on a v2 recording = %+v, %v", header, err)
+	}
+
+	if _, err := NewReader(strings.NewReader(testV1Cast)); err == nil {
+		t.Error("NewReader() on a v1 recording did not return an error")
+	}
+}
+
+// TestReadV1Errors checks that invalid v1 recordings are rejected.
+func TestReadV1Errors(t *testing.T) {
+	for _, contents := range []string{
+		`{"version": 2, "width": 80, "height": 24}`,
+		`{"version": 1, "width": 80, "height": 24, "stdout": [[0.1]]}`,
+		`{"version": 1, "width": 80, "height": 24, "stdout": [[-1, "a"]]}`,
+		`{"version": 1, "width": 80, "height": 24, "stdout": [[0.1, 2]]}`,
+	} {
+		if _, err := ReadV1(strings.NewReader(contents)); err == nil {
+			t.Errorf("ReadV1(%s) did not return an error", contents)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Writer writes a recording one event at a time. Events are buffered,
+// so Flush has to be called once every event has been written.
+type Writer struct {
+	writer *bufio.Writer
+}
+
+// NewWriter creates a Writer and writes the recording's header. If the
+// header does not have a version, the version supported by this package
+// is used.
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	if header.Version == 0 {
+		header.Version = Version
+	}
+	writer := &Writer{bufio.NewWriter(w)}
+	if err := writer.writeLine(header); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// WriteEvent writes a single event.
+func (w *Writer) WriteEvent(event Event) error {
+	return w.writeLine(event)
+}
+
+// Flush writes the buffered events to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.writer.Flush()
+}
+
+// writeLine writes a value as JSON, followed by a newline.
+func (w *Writer) writeLine(value json.Marshaler) error {
+	line, err := value.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if _, err := w.writer.Write(line); err != nil {
+		return err
+	}
+	return w.writer.WriteByte('\n')
+}
+
+// Write writes a whole recording.
+func (c *Cast) Write(w io.Writer) error {
+	writer, err := NewWriter(w, c.Header)
+	if err != nil {
+		return err
+	}
+	for _, event := range c.Events {
+		if err := writer.WriteEvent(event); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// WriteFile writes a whole recording in a file. The recording is first
+// written to a temporary file in the same directory, which is then moved
+// over the destination, so the file is never left half written.
+func (c *Cast) WriteFile(castPath string) error {
+	temporary, err := ioutil.TempFile(filepath.Dir(castPath), filepath.Base(castPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+
+	if err := c.Write(temporary); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temporary.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), castPath)
+}
@@ -0,0 +1,189 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/spf13/cobra"
+)
+
+// castCmd represents the cast command
+var castCmd = &cobra.Command{
+	Use:   "cast",
+	Short: "Edits and converts asciicasts.",
+	Long: `Cast groups the commands that work on a single
+Asciinema recording.`,
+}
+
+var castConvertCmd = &cobra.Command{
+	Use:   "convert [path to asciicast] [path to converted asciicast]",
+	Short: "Converts an asciicast v1 recording to the v2 format.",
+	Long: `Convert reads an asciicast in the v1 format, which is a
+single JSON document, and writes it in the v2 format used
+by Good Bot and recent versions of Asciinema.
+
+If no destination is provided, the converted asciicast is
+written next to the original one, with the ".v2.cast"
+extension. The original asciicast is never modified.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		source, err := processPath(args[0])
+		if err != nil {
+			log.Fatalf("Got error trying to process the agrument '%s'. Error was:\n%s", args[0], err)
+		}
+
+		destination := convertedCastPath(source)
+		if len(args) == 2 {
+			destination, err = processPath(args[1])
+			if err != nil {
+				log.Fatalf("Got error trying to process the agrument '%s'. Error was:\n%s", args[1], err)
+			}
+		}
+
+		if err := convertCast(source, destination); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Converted asciicast has been written as %s.\n", destination)
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("requires at least one argument")
+		} else if len(args) > 2 {
+			return errors.New("requires at most two arguments")
+		} else if !validatePath(args[0]) {
+			return errors.New("not a valid path")
+		} else {
+			return nil
+		}
+	},
+}
+
+var castCompressCmd = &cobra.Command{
+	Use:   "compress [path to asciicast]...",
+	Short: "Shortens the long pauses of asciicasts.",
+	Long: `Compress shortens every pause of the provided asciicasts
+that is longer than the idle limit, so that slow commands
+don't make the videos drag on. The asciicasts are modified
+in place, and the limit is written in their header.
+
+The time saved in each asciicast, and in total, is reported
+once every asciicast has been compressed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if compressIdleLimit <= 0 {
+			log.Fatal("The idle limit should be positive.")
+		}
+		var total time.Duration
+		for _, arg := range args {
+			castPath, err := processPath(arg)
+			if err != nil {
+				log.Fatalf("Got error trying to process the agrument '%s'. Error was:\n%s", arg, err)
+			}
+			saved, err := compressRec(castPath, compressIdleLimit)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s: saved %s.\n", castPath, saved)
+			total += saved
+		}
+		fmt.Printf("Saved %s in total.\n", total)
+	},
+	Args: castPathsArgs,
+}
+
+var compressIdleLimit time.Duration
+
+func init() {
+	rootCmd.AddCommand(castCmd)
+	castCmd.AddCommand(castConvertCmd)
+	castCmd.AddCommand(castCompressCmd)
+
+	castCompressCmd.Flags().DurationVar(&compressIdleLimit, "idle-limit", 2*time.Second, `How long a pause can last, e.g. "1.5s". Longer pauses are
+shortened to this.`)
+}
+
+// convertedCastPath returns the default path of a converted asciicast,
+// which is the original path with the ".v2.cast" extension.
+func convertedCastPath(castPath string) string {
+	return strings.TrimSuffix(castPath, filepath.Ext(castPath)) + ".v2.cast"
+}
+
+// convertCast converts a v1 asciicast to the v2 format and writes it as
+// destination. An error is returned if the asciicast is already in the
+// v2 format, or if the destination is the source itself.
+func convertCast(source string, destination string) error {
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	absDestination, err := filepath.Abs(destination)
+	if err != nil {
+		return err
+	}
+	if absSource == absDestination {
+		return errors.New("the converted asciicast can't replace the original one")
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := asciicast.NewReader(file); err == nil {
+		return fmt.Errorf("asciicast %s is already in the v2 format", source)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return err
+	}
+
+	cast, err := asciicast.ReadV1(file)
+	if err != nil {
+		return fmt.Errorf("could not convert %s: %s", source, err)
+	}
+
+	return cast.WriteFile(destination)
+}
+
+// compressRec shortens the pauses of an asciicast that are longer than
+// limit, and writes it back. See asciicast.Cast.LimitIdle for more
+// information. The time that was removed from the asciicast is returned.
+//
+// Asciicasts in the v1 format are converted to v2 when they are
+// written back. Asciicasts that don't change are not written back, so
+// that they don't look newer than what was rendered from them.
+func compressRec(recPath string, limit time.Duration) (time.Duration, error) {
+	cast, err := asciicast.ReadFile(recPath)
+	if err != nil {
+		return 0, err
+	}
+
+	previousLimit := cast.Header.IdleTimeLimit
+	saved := cast.LimitIdle(limit.Seconds())
+	if saved == 0 && cast.Header.IdleTimeLimit == previousLimit {
+		return 0, nil
+	}
+	if err := cast.WriteFile(recPath); err != nil {
+		return 0, err
+	}
+	return time.Duration(saved * float64(time.Second)).Round(time.Millisecond), nil
+}
@@ -0,0 +1,307 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/spf13/cobra"
+)
+
+var castCutCmd = &cobra.Command{
+	Use:   "cut [path to asciicast]",
+	Short: "Removes part of an asciicast.",
+	Long: `Cut removes everything that happens between the --from
+and --to times of an asciicast, e.g.:
+
+good-bot-cli cast cut scene_1/asciicasts/commands_1.cast --from 12.5s --to 20s
+
+The screen is then drawn as it is at --to, so that what is
+printed after the cut lands on the right screen, e.g. after a
+clear. The rest of the asciicast is moved earlier.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("to") {
+			log.Fatal("Please provide the end of the part to remove with --to.")
+		}
+		castPath, err := processPath(args[0])
+		if err != nil {
+			log.Fatalf("Got error trying to process the agrument '%s'. Error was:\n%s", args[0], err)
+		}
+		err = editRec(castPath, func(cast *asciicast.Cast) error {
+			return cast.Cut(cutFrom.Seconds(), cutTo.Seconds())
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Removed %s from %s.\n", cutTo-cutFrom, castPath)
+	},
+	Args: singleCastArgs,
+}
+
+var castTrimCmd = &cobra.Command{
+	Use:   "trim [path to asciicast or project]...",
+	Short: "Removes the pauses at the start and end of asciicasts.",
+	Long: `Trim removes the time before the first output of each
+asciicast, and everything that comes after its last output.
+
+The arguments can be asciicasts or project directories, in
+which case every asciicast of the project is trimmed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		castPaths, err := getCastPaths(args)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, castPath := range castPaths {
+			var trimmed float64
+			err := editRec(castPath, func(cast *asciicast.Cast) error {
+				trimmed = cast.Trim()
+				return nil
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s: removed %s.\n", castPath, secondsDuration(trimmed))
+		}
+	},
+	Args: castPathsArgs,
+}
+
+var castSpliceCmd = &cobra.Command{
+	Use:   "splice [path to first asciicast] [path to second asciicast]",
+	Short: "Adds an asciicast at the end of another one.",
+	Long: `Splice adds the second asciicast at the end of the first
+one. The first asciicast is modified, and the second one is
+left as it is.
+
+The second asciicast is drawn over what the first one shows
+at its end, as if both had been recorded in the same terminal.
+If it doesn't have the same size, it is cropped to the size
+of the first asciicast.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		first, err := processPath(args[0])
+		if err != nil {
+			log.Fatalf("Got error trying to process the agrument '%s'. Error was:\n%s", args[0], err)
+		}
+		second, err := processPath(args[1])
+		if err != nil {
+			log.Fatalf("Got error trying to process the agrument '%s'. Error was:\n%s", args[1], err)
+		}
+		if err := spliceRecs(first, second, spliceGap); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s has been added at the end of %s.\n", second, first)
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("requires exactly two arguments")
+		} else if !validatePath(args[0]) || !validatePath(args[1]) {
+			return errors.New("not a valid path")
+		} else {
+			return nil
+		}
+	},
+}
+
+var castSpeedCmd = &cobra.Command{
+	Use:   "speed [factor] [path to asciicast or project]...",
+	Short: "Makes asciicasts play faster or slower.",
+	Long: `Speed changes the speed of asciicasts by a factor, e.g.:
+
+good-bot-cli cast speed 1.5x scene_1/asciicasts/commands_1.cast
+
+A factor lower than 1 makes asciicasts play slower. The
+arguments can be asciicasts or project directories, in which
+case every asciicast of the project is changed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		factor, err := parseSpeedFactor(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		castPaths, err := getCastPaths(args[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, castPath := range castPaths {
+			var before, after float64
+			err := editRec(castPath, func(cast *asciicast.Cast) error {
+				before = cast.Length()
+				err := cast.Speed(factor)
+				after = cast.Length()
+				return err
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s: now lasts %s instead of %s.\n", castPath, secondsDuration(after), secondsDuration(before))
+		}
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return errors.New("requires a factor and at least one path")
+		}
+		return castPathsArgs(cmd, args[1:])
+	},
+}
+
+var (
+	cutFrom   time.Duration
+	cutTo     time.Duration
+	spliceGap time.Duration
+)
+
+func init() {
+	castCmd.AddCommand(castCutCmd)
+	castCmd.AddCommand(castTrimCmd)
+	castCmd.AddCommand(castSpliceCmd)
+	castCmd.AddCommand(castSpeedCmd)
+
+	castCutCmd.Flags().DurationVar(&cutFrom, "from", 0, `Where the part to remove starts, e.g. "12.5s". Starts at
+the beginning of the asciicast by default.`)
+	castCutCmd.Flags().DurationVar(&cutTo, "to", 0, `Where the part to remove ends, e.g. "1m20s".`)
+	castSpliceCmd.Flags().DurationVar(&spliceGap, "gap", 0, `How long to wait between the end of the first asciicast
+and the start of the second one, e.g. "1s".`)
+}
+
+// backupExtension is added to the path of an asciicast to get the path
+// of its backup.
+const backupExtension string = ".backup"
+
+// editRec applies an edit to an asciicast and writes it back. A copy of
+// the asciicast as it was before the edit is kept next to it, with the
+// ".backup" extension, so that the edit can be undone by renaming the
+// copy. Only the last edit can be undone.
+//
+// Nothing is written if the edit returns an error. Asciicasts in the v1
+// format are converted to v2 when they are written back, but their
+// backup is kept in the v1 format.
+//
+// The edited asciicast replaces the uncropped copy made by cropRec, if
+// any, so that the edit is not lost when the recording is cropped again.
+func editRec(recPath string, edit func(*asciicast.Cast) error) error {
+	original, err := ioutil.ReadFile(recPath)
+	if err != nil {
+		return err
+	}
+	cast, err := asciicast.Read(bytes.NewReader(original))
+	if err != nil {
+		return fmt.Errorf("could not read %s: %s", recPath, err)
+	}
+
+	if err := edit(cast); err != nil {
+		return fmt.Errorf("could not edit %s: %s", recPath, err)
+	}
+
+	if err := ioutil.WriteFile(recPath+backupExtension, original, 0644); err != nil {
+		return err
+	}
+	if err := os.Remove(recPath + uncroppedExtension); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return cast.WriteFile(recPath)
+}
+
+// spliceRecs adds the asciicast at second to the end of the one at
+// first, gap after its last event. The second asciicast is cropped to
+// the size of the first one if needed. Only the first asciicast is
+// modified.
+func spliceRecs(first string, second string, gap time.Duration) error {
+	other, err := asciicast.ReadFile(second)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %s", second, err)
+	}
+	return editRec(first, func(cast *asciicast.Cast) error {
+		if needsCrop(other, cast.Header.Width, cast.Header.Height) {
+			other = cropCast(other, cast.Header.Width, cast.Header.Height)
+		}
+		return cast.Splice(other, gap.Seconds())
+	})
+}
+
+// parseSpeedFactor reads a speed factor such as "1.5x" or "0.5". The
+// "x" suffix is optional.
+func parseSpeedFactor(factor string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(factor), "x"), 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid speed factor '%s', use a positive number such as 1.5x", factor)
+	}
+	return value, nil
+}
+
+// getCastPaths returns the paths of the asciicasts to edit. Each path
+// is either an asciicast, or a project directory, in which case every
+// asciicast of the project is returned.
+func getCastPaths(paths []string) ([]string, error) {
+	var castPaths []string
+	for _, path := range paths {
+		processed, err := processPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("got error trying to process the agrument '%s': %s", path, err)
+		}
+		isDir, err := isDirectory(processed)
+		if err != nil {
+			return nil, err
+		}
+		if isDir {
+			castPaths = append(castPaths, getRecsPaths(processed)...)
+		} else {
+			castPaths = append(castPaths, processed)
+		}
+	}
+	return castPaths, nil
+}
+
+// secondsDuration converts a number of seconds to a duration that can
+// be printed.
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+}
+
+// singleCastArgs makes sure that a command gets the path of a single
+// asciicast.
+func singleCastArgs(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return errors.New("requires at least one argument")
+	} else if len(args) > 1 {
+		return errors.New("requires at most one argument")
+	} else if !validatePath(args[0]) {
+		return errors.New("not a valid path")
+	} else {
+		return nil
+	}
+}
+
+// castPathsArgs makes sure that a command gets at least one path, and
+// that every path exists.
+func castPathsArgs(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return errors.New("requires at least one argument")
+	}
+	for _, arg := range args {
+		if !validatePath(arg) {
+			return fmt.Errorf("not a valid path: %s", arg)
+		}
+	}
+	return nil
+}
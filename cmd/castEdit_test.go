@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+)
+
+// testV2Cast is a short asciicast in the v2 format, with a long pause
+// at its start.
+const testV2Cast = `{"version": 2, "width": 80, "height": 24}
+[2.5, "o", "$ "]
+[3, "o", "ls\r\n"]
+`
+
+// writeV2Cast writes testV2Cast in the test directory.
+func writeV2Cast(t *testing.T, name string) string {
+	castPath := filepath.Join(testData.dir, name)
+	if err := ioutil.WriteFile(castPath, []byte(testV2Cast), 0644); err != nil {
+		t.Fatalf("Test error: could not write to file.\n%s", err)
+	}
+	return castPath
+}
+
+// TestEditRec edits an asciicast, and makes sure that its backup
+// contains the original asciicast.
+func TestEditRec(t *testing.T) {
+	castPath := writeV1Cast(t)
+	defer os.Remove(castPath)
+	defer os.Remove(castPath + backupExtension)
+
+	err := editRec(castPath, func(cast *asciicast.Cast) error {
+		return cast.Cut(0.25, 0.75)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := ioutil.ReadFile(castPath + backupExtension)
+	if err != nil {
+		t.Fatalf("editRec did not keep a backup:\n%s", err)
+	}
+	if string(backup) != testV1Cast {
+		t.Errorf("backup contains %s, want the original asciicast", backup)
+	}
+	cast, err := asciicast.ReadFile(castPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The prompt that was cut is drawn again at the start of the cut.
+	if len(cast.Events) != 2 || cast.Events[0].Time != 0.25 || cast.Events[1].Time != 0.7 {
+		t.Errorf("edited asciicast = %+v", cast)
+	}
+
+	// The asciicast and its backup are left as they are if the edit
+	// fails.
+	edited, _ := ioutil.ReadFile(castPath)
+	err = editRec(castPath, func(cast *asciicast.Cast) error {
+		return errors.New("failed")
+	})
+	if err == nil {
+		t.Error("editRec did not return the edit's error")
+	}
+	after, _ := ioutil.ReadFile(castPath)
+	backupAfter, _ := ioutil.ReadFile(castPath + backupExtension)
+	if string(after) != string(edited) || string(backupAfter) != testV1Cast {
+		t.Error("a failed edit changed the asciicast or its backup")
+	}
+}
+
+// TestSpliceRecs splices an asciicast of another size after a v2
+// asciicast.
+func TestSpliceRecs(t *testing.T) {
+	first := writeV2Cast(t, "first.cast")
+	defer os.Remove(first)
+	defer os.Remove(first + backupExtension)
+	second := writeV1Cast(t)
+	defer os.Remove(second)
+
+	if err := spliceRecs(first, second, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	cast, err := asciicast.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cast.Header.Width != 80 || cast.Header.Height != 24 || cast.Length() != 5.2 {
+		t.Errorf("spliced asciicast has size %dx%d and length %v, want 80x24 and 5.2", cast.Header.Width, cast.Header.Height, cast.Length())
+	}
+	if err := validateAsciicast(first); err != nil {
+		t.Errorf("spliced asciicast is invalid:\n%s", err)
+	}
+}
+
+// TestParseSpeedFactor reads valid and invalid speed factors.
+func TestParseSpeedFactor(t *testing.T) {
+	var testCases = []struct {
+		factor string
+		want   float64
+		valid  bool
+	}{
+		{"1.5x", 1.5, true},
+		{"2", 2, true},
+		{"0.5X", 0.5, true},
+		{"0x", 0, false},
+		{"-2", 0, false},
+		{"fast", 0, false},
+	}
+	for _, tc := range testCases {
+		got, err := parseSpeedFactor(tc.factor)
+		if tc.valid && (err != nil || got != tc.want) {
+			t.Errorf("parseSpeedFactor(%s) = %v, %v, want %v", tc.factor, got, err, tc.want)
+		} else if !tc.valid && err == nil {
+			t.Errorf("parseSpeedFactor(%s) did not return an error", tc.factor)
+		}
+	}
+}
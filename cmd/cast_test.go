@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+)
+
+// testV1Cast is a short asciicast in the v1 format.
+const testV1Cast = `{"version": 1, "width": 120, "height": 40, "duration": 1.2, "command": "/bin/bash", "title": "", "env": {"TERM": "xterm"}, "stdout": [[0.5, "$ "], [0.7, "ls\r\n"]]}`
+
+// writeV1Cast writes testV1Cast in the test directory.
+func writeV1Cast(t *testing.T) string {
+	castPath := filepath.Join(testData.dir, "v1.json")
+	if err := ioutil.WriteFile(castPath, []byte(testV1Cast), 0644); err != nil {
+		t.Fatalf("Test error: could not write to file.\n%s", err)
+	}
+	return castPath
+}
+
+// TestConvertCast converts a v1 asciicast, and makes sure that a v2
+// asciicast can't be converted again.
+func TestConvertCast(t *testing.T) {
+	castPath := writeV1Cast(t)
+	defer os.Remove(castPath)
+
+	converted := convertedCastPath(castPath)
+	if filepath.Base(converted) != "v1.v2.cast" {
+		t.Errorf("convertedCastPath(%s) = %s", castPath, converted)
+	}
+
+	if err := convertCast(castPath, converted); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(converted)
+
+	if err := validateAsciicast(converted); err != nil {
+		t.Errorf("converted asciicast is invalid:\n%s", err)
+	}
+	cast, err := asciicast.ReadFile(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cast.Header.Width != 120 || len(cast.Events) != 2 || cast.Events[1].Time != 1.2 {
+		t.Errorf("converted asciicast = %+v", cast)
+	}
+
+	if err := convertCast(converted, filepath.Join(testData.dir, "again.cast")); err == nil {
+		t.Error("convertCast on a v2 asciicast did not return an error")
+	}
+	if err := convertCast(castPath, castPath); err == nil {
+		t.Error("convertCast did not refuse to replace the original asciicast")
+	}
+}
+
+// TestCropRecV1 crops a v1 asciicast, which should be converted to v2.
+func TestCropRecV1(t *testing.T) {
+	castPath := writeV1Cast(t)
+	defer os.Remove(castPath)
+	defer os.Remove(castPath + uncroppedExtension)
+
+	info, err := getAsciicastConfig(castPath)
+	if err != nil {
+		t.Fatalf("getAsciicastConfig on a v1 asciicast returned error:\n%s", err)
+	}
+	if info.Width != 120 || info.Height != 40 {
+		t.Errorf("getAsciicastConfig(%s) = %+v", castPath, info)
+	}
+
+	if err := cropRec(castPath, 80, 24); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateAsciicast(castPath); err != nil {
+		t.Errorf("cropped v1 asciicast is not a valid v2 asciicast:\n%s", err)
+	}
+	info, err = getAsciicastConfig(castPath)
+	if err != nil || info.Width != 80 || info.Height != 24 {
+		t.Errorf("cropRec(%s) gave %+v, %v", castPath, info, err)
+	}
+}
+
+// TestCompressRec compresses a v1 asciicast that has a long pause.
+func TestCompressRec(t *testing.T) {
+	castPath := writeV1Cast(t)
+	defer os.Remove(castPath)
+
+	saved, err := compressRec(castPath, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != 800*time.Millisecond {
+		t.Errorf("compressRec(%s) saved %s, want 800ms", castPath, saved)
+	}
+
+	cast, err := asciicast.ReadFile(castPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cast.Header.IdleTimeLimit != 0.2 || cast.Events[0].Time != 0.2 || cast.Events[1].Time != 0.4 {
+		t.Errorf("compressed asciicast = %+v", cast)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/TrickyTroll/good-bot-cli/vt"
+)
+
+// uncroppedExtension is added to the path of an asciicast to get the
+// path of the recording as it was before being cropped.
+const uncroppedExtension string = ".uncropped"
+
+// cropRec crops an Asciinema recording to the provided terminal size.
+// See cropCast for more information. Recordings that already have the
+// right size are left as they are.
+//
+// Cropping cuts columns, so the recording is first copied next to the
+// asciicast with the uncroppedExtension. When the size changes again,
+// the recording is cropped from that copy instead of from an asciicast
+// that was already cropped.
+//
+// Asciicasts in the v1 format are converted to v2 when they are
+// written back.
+func cropRec(recPath string, width int, height int) error {
+
+	cast, err := asciicast.ReadFile(recPath)
+	if err != nil {
+		return err
+	}
+
+	if !needsCrop(cast, width, height) {
+		return nil
+	}
+
+	uncroppedPath := recPath + uncroppedExtension
+	if uncropped, err := asciicast.ReadFile(uncroppedPath); err == nil {
+		cast = uncropped
+	} else if !os.IsNotExist(err) {
+		return err
+	} else if err := copyRec(recPath, uncroppedPath); err != nil {
+		return err
+	}
+
+	// WriteFile replaces the asciicast only once it has been written
+	// completely.
+	if !needsCrop(cast, width, height) {
+		return cast.WriteFile(recPath)
+	}
+	return cropCast(cast, width, height).WriteFile(recPath)
+}
+
+// copyRec copies the asciicast at source to destination.
+func copyRec(source string, destination string) error {
+	contents, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(destination, contents, 0644)
+}
+
+// needsCrop checks whether or not a recording has to be cropped to be
+// displayed on a terminal of the provided size. Recordings that have
+// the right size and are never resized don't need to be.
+func needsCrop(cast *asciicast.Cast, width int, height int) bool {
+	if cast.Header.Width != width || cast.Header.Height != height {
+		return true
+	}
+	for _, event := range cast.Events {
+		if event.Type == asciicast.Resize {
+			return true
+		}
+	}
+	return false
+}
+
+// cropCast replays a recording in a virtual terminal of the recording's
+// size, and returns a recording of the provided size that shows the same
+// screens.
+//
+// Only changing the size in the header would make the player wrap lines
+// at the new width, which garbles everything that was drawn for the
+// original width. Instead, after each output event, the part of the
+// screen that fits in the new size is drawn again. Columns that don't fit
+// are cut on the right. If the recording has more rows than the new
+// size, the visible rows follow the cursor.
+//
+// The virtual terminal has at least as many rows as the new size, so
+// that recordings with fewer rows use the whole height instead of
+// scrolling early. Resize events change the size of the virtual
+// terminal, and become output events. Events that don't change the
+// cropped screen are kept with empty output, so that the cropped
+// recording is exactly as long as the original. Other events are kept
+// as they are.
+func cropCast(cast *asciicast.Cast, width int, height int) *asciicast.Cast {
+	terminal := vt.New(cast.Header.Width, maxInt(cast.Header.Height, height))
+
+	cropped := &asciicast.Cast{Header: cast.Header}
+	cropped.Header.Width = width
+	cropped.Header.Height = height
+
+	previous := vt.NewScreen(width, height)
+	top := 0
+	for _, event := range cast.Events {
+		switch event.Type {
+		case asciicast.Output:
+			terminal.Write([]byte(event.Data))
+		case asciicast.Resize:
+			newWidth, newHeight, err := event.Size()
+			if err != nil {
+				continue
+			}
+			terminal.Resize(newWidth, maxInt(newHeight, height))
+		default:
+			cropped.Events = append(cropped.Events, event)
+			continue
+		}
+
+		top = followCursor(terminal, top, height)
+		screen := terminal.Viewport(0, top, width, height)
+		event.Type = asciicast.Output
+		event.Data = screen.Diff(previous)
+		cropped.Events = append(cropped.Events, event)
+		previous = screen
+	}
+	return cropped
+}
+
+// followCursor returns the first row that should be visible so that the
+// cursor stays in a viewport of the provided height. The viewport only
+// moves when the cursor leaves it.
+func followCursor(terminal *vt.Terminal, top int, height int) int {
+	_, terminalHeight := terminal.Size()
+	_, y, _ := terminal.Cursor()
+	if y < top {
+		top = y
+	} else if y >= top+height {
+		top = y - height + 1
+	}
+	if top+height > terminalHeight {
+		top = terminalHeight - height
+	}
+	return maxInt(top, 0)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/TrickyTroll/good-bot-cli/vt"
+)
+
+// updateGolden rewrites the golden files instead of comparing them.
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// replayScreens replays the output events of a recording in a terminal
+// of the recording's size. The screens shown at each of the provided
+// times are returned, one after the other.
+func replayScreens(cast *asciicast.Cast, times []float64) string {
+	terminal := vt.New(cast.Header.Width, cast.Header.Height)
+	var screens strings.Builder
+	next := 0
+	for _, event := range cast.Events {
+		for next < len(times) && times[next] <= event.Time {
+			fmt.Fprintf(&screens, "-- at %s --\n%s", asciicast.FormatTime(times[next]), terminal.Screen())
+			next++
+		}
+		if event.Type == asciicast.Output {
+			terminal.Write([]byte(event.Data))
+		}
+	}
+	for ; next < len(times); next++ {
+		fmt.Fprintf(&screens, "-- at %s --\n%s", asciicast.FormatTime(times[next]), terminal.Screen())
+	}
+	return screens.String()
+}
+
+// checkGolden compares got with the contents of a golden file, or writes
+// it if the -update flag is used.
+func checkGolden(t *testing.T, name string, got string) {
+	goldenPath := filepath.Join(testData.testProject1, "..", "golden", name)
+	if *updateGolden {
+		if err := ioutil.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Test error: could not read golden file %s.\n%s", goldenPath, err)
+	}
+	if got != string(want) {
+		t.Errorf("screens do not match %s.\ngot:\n%s\nwant:\n%s", goldenPath, got, want)
+	}
+}
+
+// TestCropCastGolden crops recordings and compares the screens shown by
+// the cropped recordings at a few points in time with golden snapshots.
+func TestCropCastGolden(t *testing.T) {
+	var testCases = []struct {
+		cast   string
+		times  func(*asciicast.Cast) []float64
+		golden string
+	}{
+		// Recorded at 219x8 by Good Bot. Only the last screen is kept.
+		{"commands_1.cast", endTime, "commands_1_80x24.golden"},
+		// A 120x10 recording with colors, lines longer than 80 columns,
+		// scrolling, a clear and line drawing characters. The screen
+		// before the clear and the last screen are kept.
+		{"wide.cast", func(cast *asciicast.Cast) []float64 {
+			return append([]float64{timeOf(cast, "\x1b[2J")}, endTime(cast)...)
+		}, "wide_80x24.golden"},
+	}
+
+	for _, tc := range testCases {
+		cast, err := asciicast.ReadFile(filepath.Join(testData.testProject1, "croptests", tc.cast))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cropped := cropCast(cast, 80, 24)
+		if cropped.Header.Width != 80 || cropped.Header.Height != 24 {
+			t.Errorf("cropCast(%s) has size %dx%d, want 80x24", tc.cast, cropped.Header.Width, cropped.Header.Height)
+		}
+		checkGolden(t, tc.golden, replayScreens(cropped, tc.times(cast)))
+	}
+}
+
+// endTime returns the time of the last event of a recording.
+func endTime(cast *asciicast.Cast) []float64 {
+	return []float64{cast.Events[len(cast.Events)-1].Time}
+}
+
+// timeOf returns the time of the first event that contains data. The
+// screen at that time is the one shown before the event.
+func timeOf(cast *asciicast.Cast, data string) float64 {
+	for _, event := range cast.Events {
+		if strings.Contains(event.Data, data) {
+			return event.Time
+		}
+	}
+	return cast.Events[len(cast.Events)-1].Time
+}
+
+// TestCropCastMatchesViewport replays a recording and its cropped copy
+// side by side. After each event, the cropped screen should show the
+// same cells as the top left corner of the original screen.
+func TestCropCastMatchesViewport(t *testing.T) {
+	cast, err := asciicast.ReadFile(filepath.Join(testData.testProject1, "croptests", "wide.cast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Using a height that fits the recording, so that the viewport
+	// never moves.
+	cropped := cropCast(cast, 60, 10)
+	if len(cropped.Events) != len(cast.Events) {
+		t.Fatalf("cropCast returned %d events, want %d", len(cropped.Events), len(cast.Events))
+	}
+
+	original := vt.New(cast.Header.Width, cast.Header.Height)
+	replayed := vt.New(60, 10)
+	for i := range cast.Events {
+		original.Write([]byte(cast.Events[i].Data))
+		replayed.Write([]byte(cropped.Events[i].Data))
+		if cropped.Events[i].Time != cast.Events[i].Time {
+			t.Errorf("event %d was moved from %v to %v", i, cast.Events[i].Time, cropped.Events[i].Time)
+		}
+
+		want := original.Viewport(0, 0, 60, 10)
+		got := replayed.Screen()
+		for y := range want.Cells {
+			for x := range want.Cells[y] {
+				if got.Cells[y][x] != want.Cells[y][x] {
+					t.Fatalf("after event %d, cell %d,%d is %+v, want %+v", i, x, y, got.Cells[y][x], want.Cells[y][x])
+				}
+			}
+		}
+	}
+}
+
+// TestCropCastFollowsCursor crops a recording to fewer rows than it has,
+// and makes sure that the cursor stays visible.
+func TestCropCastFollowsCursor(t *testing.T) {
+	cast, err := asciicast.ReadFile(filepath.Join(testData.testProject1, "croptests", "wide.cast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cropped := cropCast(cast, 80, 4)
+
+	replayed := vt.New(80, 4)
+	for _, event := range cropped.Events {
+		replayed.Write([]byte(event.Data))
+	}
+	screen := replayed.Screen()
+	if !strings.HasPrefix(screen.Line(screen.CursorY), "root@good-bot:/app#") {
+		t.Errorf("the cursor is not on the last prompt:\n%s", screen)
+	}
+}
+
+// TestNeedsCrop makes sure that recordings that already have the right
+// size are not cropped again.
+func TestNeedsCrop(t *testing.T) {
+	cast := &asciicast.Cast{Header: asciicast.Header{Width: 80, Height: 24}, Events: []asciicast.Event{{Time: 1, Type: asciicast.Output, Data: "a"}}}
+	if needsCrop(cast, 80, 24) {
+		t.Error("needsCrop returned true for a recording of the right size")
+	}
+	if !needsCrop(cast, 100, 30) {
+		t.Error("needsCrop returned false for a recording of another size")
+	}
+	cast.Events = append(cast.Events, asciicast.Event{Time: 2, Type: asciicast.Resize, Data: "100x30"})
+	if !needsCrop(cast, 80, 24) {
+		t.Error("needsCrop returned false for a recording that is resized")
+	}
+}
+
+// TestLoadProjectSettings reads a project without settings, and one that
+// sets the terminal's size.
+func TestLoadProjectSettings(t *testing.T) {
+	settings, err := loadProjectSettings(testData.testProject1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Terminal.Width != 80 || settings.Terminal.Height != 24 {
+		t.Errorf("default terminal size is %dx%d, want 80x24", settings.Terminal.Width, settings.Terminal.Height)
+	}
+
+	projectPath := t.TempDir()
+	settingsPath := filepath.Join(projectPath, projectSettingsName)
+	if err := ioutil.WriteFile(settingsPath, []byte("terminal:\n  width: 100\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings, err = loadProjectSettings(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Terminal.Width != 100 || settings.Terminal.Height != 24 {
+		t.Errorf("terminal size is %dx%d, want 100x24", settings.Terminal.Width, settings.Terminal.Height)
+	}
+
+	for _, contents := range []string{"terminal:\n  width: 0\n", "terminal:\n  colums: 100\n"} {
+		if err := ioutil.WriteFile(settingsPath, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadProjectSettings(projectPath); err == nil {
+			t.Errorf("loadProjectSettings did not return an error for:\n%s", contents)
+		}
+	}
+}
+
+// TestCropCastKeepsLength crops a recording whose last events don't
+// change the cropped screen. The cropped recording should be exactly as
+// long as the original.
+func TestCropCastKeepsLength(t *testing.T) {
+	cast, err := asciicast.ReadFile(filepath.Join(testData.testProject1, "croptests", "wide.cast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cast.Events = append(cast.Events, asciicast.Event{Time: cast.Length() + 5, Type: asciicast.Output, Data: ""})
+
+	cropped := cropCast(cast, 20, 4)
+	if cropped.Length() != cast.Length() {
+		t.Errorf("cropped recording lasts %v, want %v", cropped.Length(), cast.Length())
+	}
+}
+
+// TestCropRecAgain crops a recording to a narrow size, and then to a
+// wider one. The second crop should show the columns cut by the first.
+func TestCropRecAgain(t *testing.T) {
+	contents, err := ioutil.ReadFile(filepath.Join(testData.testProject1, "croptests", "wide.cast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	castPath := filepath.Join(t.TempDir(), "wide.cast")
+	if err := ioutil.WriteFile(castPath, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cropRec(castPath, 20, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := cropRec(castPath, 60, 10); err != nil {
+		t.Fatal(err)
+	}
+	cast, err := asciicast.ReadFile(castPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := asciicast.ReadFile(castPath + uncroppedExtension)
+	if err != nil {
+		t.Fatalf("cropRec did not keep the original recording:\n%s", err)
+	}
+	want := replayScreens(cropCast(original, 60, 10), endTime(original))
+	if got := replayScreens(cast, endTime(original)); got != want {
+		t.Errorf("cropping again gave:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Going back to the original size restores the original recording.
+	if err := cropRec(castPath, original.Header.Width, original.Header.Height); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := asciicast.ReadFile(castPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Header.Width != original.Header.Width || len(restored.Events) != len(original.Events) {
+		t.Errorf("cropRec did not restore the original recording")
+	}
+}
@@ -0,0 +1,304 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/TrickyTroll/good-bot-cli/render"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports a recorded project.",
+	Long: `Export converts a recorded project to a format that can
+be shared without rendering a video.`,
+}
+
+var exportHTMLCmd = &cobra.Command{
+	Use:   "html [path to project]",
+	Short: "Exports a project as a web page with its own player.",
+	Long: `Html writes a directory that contains a web page, which
+plays each scene of a recorded project with its narration.
+The text that is read is shown as captions.
+
+The page does not need a server or network access. Open
+its index.html file in a web browser to watch the project.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := processPath(args[0])
+		if err != nil {
+			log.Fatalf("Got error trying to process the agrument '%s'. Error was:\n%s", args[0], err)
+		}
+		outputPath := filepath.Join(projectPath, htmlPath)
+		if exportOutput != "" {
+			if outputPath, err = processPath(exportOutput); err != nil {
+				log.Fatalf("Got error trying to process the output '%s'. Error was:\n%s", exportOutput, err)
+			}
+		}
+
+		if err := exportHTML(projectPath, outputPath); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("The project has been exported to %s.\n", filepath.Join(outputPath, "index.html"))
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("requires at least one argument")
+		} else if len(args) > 1 {
+			return errors.New("requires at most one argument")
+		} else if !validatePath(args[0]) {
+			return errors.New("not a valid path")
+		} else {
+			return nil
+		}
+	},
+}
+
+var exportOutput string
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportHTMLCmd)
+
+	exportHTMLCmd.Flags().StringVarP(&exportOutput, "output", "o", "", `Where to write the web page. It is written in the project's
+html directory by default.`)
+}
+
+// htmlPath is the directory, in a project, where the project is exported
+// as a web page by default.
+const htmlPath string = "/html/"
+
+// htmlFrameDelay is the shortest time, in centiseconds, between two
+// frames of an exported asciicast.
+const htmlFrameDelay = 4
+
+// player contains the files of the web page's player. They are copied as
+// they are, except for index.html which is a template.
+//go:embed player
+var player embed.FS
+
+// htmlProject is what the player knows about a project. It is written
+// in the web page's data.js file.
+type htmlProject struct {
+	Title  string      `json:"title"`
+	Scenes []htmlScene `json:"scenes"`
+}
+
+// htmlScene is a scene of an exported project. Its actions are played one
+// after the other.
+type htmlScene struct {
+	Name     string       `json:"name"`
+	Duration float64      `json:"duration"`
+	Actions  []htmlAction `json:"actions"`
+}
+
+// htmlAction is an action of an exported scene. Times are in seconds
+// since the start of the scene.
+type htmlAction struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	// Caption is the text read during the action, if it is narrated.
+	Caption string `json:"caption,omitempty"`
+	// Start is when the action's narration starts, and Shown is when
+	// its asciicast starts.
+	Start    float64 `json:"start"`
+	Shown    float64 `json:"shown"`
+	Duration float64 `json:"duration"`
+	// Audio is the path of the action's narration, relative to the web
+	// page.
+	Audio      string      `json:"audio,omitempty"`
+	Width      int         `json:"width"`
+	Height     int         `json:"height"`
+	Foreground string      `json:"foreground"`
+	Background string      `json:"background"`
+	Frames     []htmlFrame `json:"frames"`
+}
+
+// htmlFrame contains the rows of the screen that changed since the
+// previous frame of the same action, by row number.
+type htmlFrame struct {
+	Time float64        `json:"time"`
+	Rows map[int]string `json:"rows"`
+}
+
+// exportHTML writes a web page that plays a project in outputPath. The
+// page is made of the player's files, a data.js file that contains
+// every frame of the project's asciicasts, and a copy of each
+// narration.
+//
+// Frames are drawn in advance with the render package, so the player
+// only has to show them at the right time.
+func exportHTML(projectPath string, outputPath string) error {
+	scenes, err := getProjectScenes(projectPath)
+	if err != nil {
+		return err
+	}
+	if len(scenes) == 0 {
+		return fmt.Errorf("no scenes found in %s", projectPath)
+	}
+
+	if err := os.MkdirAll(outputPath, 0755); err != nil {
+		return err
+	}
+
+	project := htmlProject{Title: filepath.Base(projectPath)}
+	for _, scene := range scenes {
+		exported, err := exportScene(filepath.Join(projectPath, scene), outputPath)
+		if err != nil {
+			return fmt.Errorf("could not export %s: %s", scene, err)
+		}
+		project.Scenes = append(project.Scenes, *exported)
+	}
+
+	if err := writePlayer(outputPath, project.Title); err != nil {
+		return err
+	}
+	data, err := json.Marshal(project)
+	if err != nil {
+		return err
+	}
+	// The data is loaded with a script tag, since browsers don't let
+	// pages opened from a file fetch other files.
+	contents := append([]byte("var project = "), data...)
+	return ioutil.WriteFile(filepath.Join(outputPath, "data.js"), append(contents, ";\n"...), 0644)
+}
+
+// exportScene reads the timeline and asciicasts of a scene, and copies
+// its narrations in the web page's audio directory.
+func exportScene(scenePath string, outputPath string) (*htmlScene, error) {
+	timeline, err := buildSceneTimeline(scenePath, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	scene := &htmlScene{Name: timeline.Scene, Duration: timeline.Duration}
+	for _, action := range timeline.Actions {
+		castPath := filepath.Join(scenePath, recordingsPath, action.Name+".cast")
+		cast, err := asciicast.ReadFile(castPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", castPath, err)
+		}
+		number, err := actionNumber(action.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		marker, _ := findMarker(cast, action.Name)
+		theme := render.ThemeFromHeader(&cast.Header)
+		exported := htmlAction{
+			Name:       action.Name,
+			Title:      action.Title,
+			Caption:    actionNarration(scenePath, number),
+			Start:      action.Start,
+			Shown:      action.Start - marker,
+			Duration:   action.Duration,
+			Width:      cast.Header.Width,
+			Height:     cast.Header.Height,
+			Foreground: render.HexColor(theme.Foreground),
+			Background: render.HexColor(theme.Background),
+			Frames:     exportFrames(cast, theme, action.Start-marker),
+		}
+
+		if action.Audio != "" {
+			audioPath := filepath.Join("audio", scene.Name, filepath.Base(action.Audio))
+			if err := copyExportFile(action.Audio, filepath.Join(outputPath, audioPath)); err != nil {
+				return nil, err
+			}
+			exported.Audio = filepath.ToSlash(audioPath)
+		}
+		scene.Actions = append(scene.Actions, exported)
+	}
+	return scene, nil
+}
+
+// exportFrames draws the frames of an asciicast as HTML rows. Each frame
+// only contains the rows that changed, and starts offset seconds after
+// the start of the scene.
+func exportFrames(cast *asciicast.Cast, theme *render.Theme, offset float64) []htmlFrame {
+	var frames []htmlFrame
+	var previous []string
+	for _, frame := range render.Frames(cast, htmlFrameDelay) {
+		rows := render.HTMLRows(frame.Screen, theme)
+		changed := make(map[int]string)
+		for y, row := range rows {
+			if previous == nil || row != previous[y] {
+				changed[y] = row
+			}
+		}
+		previous = rows
+		frames = append(frames, htmlFrame{Time: offset + float64(frame.Time)/100, Rows: changed})
+	}
+	return frames
+}
+
+// writePlayer copies the player's files in outputPath. The title of the
+// project is added to index.html.
+func writePlayer(outputPath string, title string) error {
+	files, err := player.ReadDir("player")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		contents, err := player.ReadFile("player/" + file.Name())
+		if err != nil {
+			return err
+		}
+		if file.Name() != "index.html" {
+			if err := ioutil.WriteFile(filepath.Join(outputPath, file.Name()), contents, 0644); err != nil {
+				return err
+			}
+			continue
+		}
+
+		page, err := template.New(file.Name()).Parse(string(contents))
+		if err != nil {
+			return err
+		}
+		var output strings.Builder
+		if err := page.Execute(&output, struct{ Title string }{title}); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(outputPath, file.Name()), []byte(output.String()), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyExportFile copies a file of the project in the exported web page.
+// The directories of the destination are created if needed.
+func copyExportFile(source string, destination string) error {
+	contents, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(destination, contents, 0644)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExportHTML exports a scene of the test project as a web page, and
+// reads the data given to the player.
+func TestExportHTML(t *testing.T) {
+	projectPath := copyTestScene(t)
+	outputPath := filepath.Join(t.TempDir(), "html")
+	if err := exportHTML(projectPath, outputPath); err != nil {
+		t.Fatalf("exportHTML(%s) returned error: %s", projectPath, err)
+	}
+
+	page, err := os.ReadFile(filepath.Join(outputPath, "index.html"))
+	if err != nil {
+		t.Fatalf("exportHTML(%s) did not write index.html: %s", projectPath, err)
+	}
+	if title := "<title>" + filepath.Base(projectPath) + "</title>"; !strings.Contains(string(page), title) {
+		t.Errorf("index.html does not contain %q", title)
+	}
+	for _, name := range []string{"player.js", "player.css", "audio/scene_1/read_1.mp3", "audio/scene_1/read_2.mp3"} {
+		if _, err := os.Stat(filepath.Join(outputPath, name)); err != nil {
+			t.Errorf("exportHTML(%s) did not write %s: %s", projectPath, name, err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputPath, "data.js"))
+	if err != nil {
+		t.Fatalf("exportHTML(%s) did not write data.js: %s", projectPath, err)
+	}
+	var project htmlProject
+	contents := strings.TrimSuffix(strings.TrimPrefix(string(data), "var project = "), ";\n")
+	if err := json.Unmarshal([]byte(contents), &project); err != nil {
+		t.Fatalf("Could not read data.js: %s", err)
+	}
+
+	if len(project.Scenes) != 1 || len(project.Scenes[0].Actions) != 2 {
+		t.Fatalf("exportHTML(%s) exported %+v, want 1 scene with 2 actions", projectPath, project.Scenes)
+	}
+	first, second := project.Scenes[0].Actions[0], project.Scenes[0].Actions[1]
+	if first.Caption != "Hello, world." || first.Audio != "audio/scene_1/read_1.mp3" {
+		t.Errorf("first action has caption %q and audio %q, want %q and %q", first.Caption, first.Audio, "Hello, world.", "audio/scene_1/read_1.mp3")
+	}
+	if second.Shown <= first.Shown || second.Frames[0].Time != second.Shown {
+		t.Errorf("second action is shown at %v with a first frame at %v, want both after %v", second.Shown, second.Frames[0].Time, first.Shown)
+	}
+	// The first frame has every row, the others only the rows that
+	// changed.
+	if len(first.Frames[0].Rows) != first.Height || len(first.Frames[1].Rows) >= first.Height {
+		t.Errorf("first frames have %d and %d rows, want %d and less", len(first.Frames[0].Rows), len(first.Frames[1].Rows), first.Height)
+	}
+}
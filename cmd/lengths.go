@@ -0,0 +1,212 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+)
+
+// Ways to fix the actions whose narration is longer than their
+// asciicast, selected with --fix-lengths.
+const (
+	// padFix adds a pause at the end of the asciicast.
+	padFix = "pad"
+	// slowFix slows down the typing of the asciicast, and adds a pause
+	// for the rest.
+	slowFix = "slow"
+)
+
+// lengthTolerance is how much longer than its asciicast a narration can
+// be, in seconds, without being reported.
+const lengthTolerance = 0.1
+
+// lengthMismatch is an action whose narration is longer than its
+// asciicast. Lengths are in seconds.
+type lengthMismatch struct {
+	scene    string
+	castPath string
+	// castLength is the time between the start of the narration and the
+	// end of the asciicast.
+	castLength  float64
+	audioLength float64
+}
+
+// missing returns how much longer the asciicast should be.
+func (m lengthMismatch) missing() float64 {
+	return m.audioLength - m.castLength
+}
+
+// findLengthMismatches compares the length of each asciicast of the
+// provided scenes with the length of its narration. The narration of an
+// action starts at the action's marker, so only the part of the
+// asciicast that comes after it is counted.
+//
+// If scenes is empty, every scene of the project is checked.
+func findLengthMismatches(projectPath string, scenes []int) ([]lengthMismatch, error) {
+	var mismatches []lengthMismatch
+	for _, castPath := range filterRecsPaths(getRecsPaths(projectPath), scenes) {
+		scenePath, err := getScenePath(castPath)
+		if err != nil {
+			return nil, err
+		}
+		number, err := actionNumber(filepath.Base(castPath))
+		if err != nil {
+			continue
+		}
+		audioPath := filepath.Join(scenePath, "audio", fmt.Sprintf("read_%d.mp3", number))
+		if _, err := os.Stat(audioPath); err != nil {
+			continue
+		}
+		audioLength, err := audioDuration(audioPath)
+		if err != nil {
+			return nil, err
+		}
+
+		length, marker, err := castTiming(castPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", castPath, err)
+		}
+		mismatch := lengthMismatch{
+			scene:       filepath.Base(scenePath),
+			castPath:    castPath,
+			castLength:  length - marker,
+			audioLength: audioLength,
+		}
+		if mismatch.missing() > lengthTolerance {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+	return mismatches, nil
+}
+
+// printLengthMismatches writes a table of the actions whose narration is
+// longer than their asciicast.
+func printLengthMismatches(w io.Writer, mismatches []lengthMismatch) {
+	if len(mismatches) == 0 {
+		fmt.Fprintln(w, "Every narration fits in its asciicast.")
+		return
+	}
+	fmt.Fprintln(w, "These narrations are longer than their asciicast:")
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SCENE\tASCIICAST\tASCIICAST LENGTH\tNARRATION LENGTH\tMISSING")
+	for _, mismatch := range mismatches {
+		fmt.Fprintf(table, "%s\t%s\t%ss\t%ss\t%ss\n", mismatch.scene, filepath.Base(mismatch.castPath),
+			formatSeconds(mismatch.castLength), formatSeconds(mismatch.audioLength), formatSeconds(mismatch.missing()))
+	}
+	table.Flush()
+}
+
+// formatSeconds writes a number of seconds with one decimal.
+func formatSeconds(seconds float64) string {
+	return fmt.Sprintf("%.1f", seconds)
+}
+
+// narratedLength returns the time between an action's marker and the
+// end of its asciicast, in seconds. This is how long the narration of
+// the action can be.
+func narratedLength(cast *asciicast.Cast, castPath string) float64 {
+	name := strings.TrimSuffix(filepath.Base(castPath), filepath.Ext(castPath))
+	marker, _ := findMarker(cast, name)
+	return cast.Length() - marker
+}
+
+// fixLengthMismatch makes an asciicast as long as its narration. The
+// padFix adds a pause at the end of the asciicast, and the slowFix slows
+// down its typing first, and adds a pause for what's left.
+//
+// The asciicast is measured again before it is fixed, and asciicasts
+// that are already long enough are left as they are, so the fix can be
+// applied on every render. Unlike editRec, no backup is written, since
+// it would replace the backup of the last cast command with an
+// asciicast that was fixed before. The uncropped copy is removed, so
+// that the fix is not lost when the asciicast is cropped again.
+//
+// Whether or not the asciicast was changed is returned.
+func fixLengthMismatch(mismatch lengthMismatch, fix string) (bool, error) {
+	cast, err := asciicast.ReadFile(mismatch.castPath)
+	if err != nil {
+		return false, fmt.Errorf("could not read %s: %s", mismatch.castPath, err)
+	}
+	missing := mismatch.audioLength - narratedLength(cast, mismatch.castPath)
+	if missing <= lengthTolerance {
+		return false, nil
+	}
+
+	if fix == slowFix {
+		missing -= cast.SlowTyping(missing)
+	}
+	if missing > 0 {
+		if err := cast.Pad(missing); err != nil {
+			return false, fmt.Errorf("could not edit %s: %s", mismatch.castPath, err)
+		}
+	}
+
+	if err := os.Remove(mismatch.castPath + uncroppedExtension); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, cast.WriteFile(mismatch.castPath)
+}
+
+// checkLengths reports the actions of the provided scenes whose
+// narration is longer than their asciicast, and fixes them if a fix was
+// selected with --fix-lengths. The asciicasts are prepared for rendering
+// first, since cropping them and --idle-limit change their length. The
+// fixes then last until the asciicasts are rendered.
+func checkLengths(projectPath string, scenes []int) error {
+	for _, castPath := range filterRecsPaths(getRecsPaths(projectPath), scenes) {
+		if _, err := prepareRecording(castPath); err != nil {
+			return err
+		}
+	}
+
+	mismatches, err := findLengthMismatches(projectPath, scenes)
+	if err != nil {
+		return err
+	}
+	printLengthMismatches(os.Stdout, mismatches)
+	if fixLengths == "" || len(mismatches) == 0 {
+		return nil
+	}
+
+	fixed := 0
+	for _, mismatch := range mismatches {
+		changed, err := fixLengthMismatch(mismatch, fixLengths)
+		if err != nil {
+			return err
+		}
+		if changed {
+			fixed++
+		}
+	}
+	fmt.Printf("Made %d asciicast(s) as long as their narration.\n", fixed)
+	return nil
+}
+
+// checkLengthFix makes sure that the fix selected with --fix-lengths
+// exists.
+func checkLengthFix() error {
+	if fixLengths != "" && fixLengths != padFix && fixLengths != slowFix {
+		return fmt.Errorf("unknown fix '%s', use '%s' or '%s'", fixLengths, padFix, slowFix)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+)
+
+// shortCast is an asciicast that lasts half a second, where "ls" is
+// typed.
+const shortCast = `{"version": 2, "width": 80, "height": 24}
+[0.1, "o", "$ "]
+[0.2, "o", "l"]
+[0.3, "o", "s"]
+[0.5, "o", "\r\n"]
+`
+
+// writeShortCast replaces the second asciicast of the test scene with
+// shortCast, which is shorter than its narration.
+func writeShortCast(t *testing.T, projectPath string) string {
+	castPath := filepath.Join(projectPath, "scene_1", "asciicasts", "commands_2.cast")
+	if err := ioutil.WriteFile(castPath, []byte(shortCast), 0644); err != nil {
+		t.Fatalf("Test error: could not write to file.\n%s", err)
+	}
+	return castPath
+}
+
+// TestFindLengthMismatches finds the asciicasts that are shorter than
+// their narration.
+func TestFindLengthMismatches(t *testing.T) {
+	projectPath := copyTestScene(t)
+	mismatches, err := findLengthMismatches(projectPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("found mismatches %+v in the test scene, want none", mismatches)
+	}
+
+	castPath := writeShortCast(t, projectPath)
+	mismatches, err = findLengthMismatches(projectPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 || mismatches[0].castPath != castPath {
+		t.Fatalf("found mismatches %+v, want one for %s", mismatches, castPath)
+	}
+	if missing := mismatches[0].missing(); math.Abs(missing-0.868) > 1e-6 {
+		t.Errorf("%s is missing %vs, want 0.868s", castPath, missing)
+	}
+
+	var output bytes.Buffer
+	printLengthMismatches(&output, mismatches)
+	for _, want := range []string{"SCENE", "scene_1  commands_2.cast  0.5s", "1.4s", "0.9s"} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("table %q does not contain %q", output.String(), want)
+		}
+	}
+}
+
+// TestFixLengthMismatch makes an asciicast as long as its narration with
+// each fix.
+func TestFixLengthMismatch(t *testing.T) {
+	for _, fix := range []string{padFix, slowFix} {
+		projectPath := copyTestScene(t)
+		castPath := writeShortCast(t, projectPath)
+		mismatches, err := findLengthMismatches(projectPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mismatches) != 1 {
+			t.Fatalf("found mismatches %+v, want one", mismatches)
+		}
+
+		if changed, err := fixLengthMismatch(mismatches[0], fix); err != nil || !changed {
+			t.Fatalf("fixLengthMismatch(%s) = %v, %v, want true", fix, changed, err)
+		}
+		cast, err := asciicast.ReadFile(castPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(cast.Length()-1.368) > 1e-5 {
+			t.Errorf("%s: asciicast lasts %vs, want 1.368s", fix, cast.Length())
+		}
+		// Slowing down the typing moves the typed characters.
+		if moved := cast.Events[2].Time != 0.3; moved != (fix == slowFix) {
+			t.Errorf("%s: typed character is at %vs", fix, cast.Events[2].Time)
+		}
+	}
+}
+
+// TestFixLengthMismatchTwice fixes an asciicast on two renders. The
+// second fix should leave the asciicast and the backup of the last cast
+// command as they are.
+func TestFixLengthMismatchTwice(t *testing.T) {
+	projectPath := copyTestScene(t)
+	castPath := writeShortCast(t, projectPath)
+	backup := []byte("backup of the last cast command")
+	if err := ioutil.WriteFile(castPath+backupExtension, backup, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mismatches, err := findLengthMismatches(projectPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 {
+		t.Fatalf("found mismatches %+v, want one", mismatches)
+	}
+
+	if _, err := fixLengthMismatch(mismatches[0], padFix); err != nil {
+		t.Fatal(err)
+	}
+	fixed, err := ioutil.ReadFile(castPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := fixLengthMismatch(mismatches[0], padFix); err != nil || changed {
+		t.Errorf("fixing the asciicast again = %v, %v, want false", changed, err)
+	}
+	if again, _ := ioutil.ReadFile(castPath); !bytes.Equal(again, fixed) {
+		t.Errorf("the asciicast was padded again:\n%s", again)
+	}
+	if kept, _ := ioutil.ReadFile(castPath + backupExtension); !bytes.Equal(kept, backup) {
+		t.Errorf("the backup was replaced with:\n%s", kept)
+	}
+}
+
+// TestCheckLengthsBeforeRender pads an asciicast that doesn't have the
+// project's terminal size, and prepares it for rendering. The pause
+// should still be there once the asciicast is cropped.
+func TestCheckLengthsBeforeRender(t *testing.T) {
+	projectPath := copyTestScene(t)
+	castPath := writeShortCast(t, projectPath)
+	wide := strings.Replace(shortCast, `"width": 80, "height": 24`, `"width": 100, "height": 30`, 1)
+	if err := ioutil.WriteFile(castPath, []byte(wide), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	previousFix := fixLengths
+	fixLengths = padFix
+	defer func() { fixLengths = previousFix }()
+	if err := checkLengths(projectPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prepareRecording(castPath); err != nil {
+		t.Fatal(err)
+	}
+
+	cast, err := asciicast.ReadFile(castPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cast.Header.Width != 80 || cast.Header.Height != 24 {
+		t.Errorf("asciicast was not cropped, it is %dx%d", cast.Header.Width, cast.Header.Height)
+	}
+	if math.Abs(cast.Length()-1.368) > 1e-5 {
+		t.Errorf("asciicast lasts %vs once prepared, want 1.368s", cast.Length())
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// manifestName is the name of the file where the manifest is saved, at
+// the root of a project.
+const manifestName string = ".good-bot-manifest.json"
+
+// recordManifest keeps track of the last successful recording of each
+// scene in a project. Scenes are saved by name, along with the hash of
+// everything that was used to record them.
+type recordManifest struct {
+	Scenes map[string]string `json:"scenes"`
+}
+
+// loadManifest reads the manifest saved in a project. If the project
+// does not have a manifest yet, an empty manifest is returned.
+//
+// An error is returned if the manifest exists but cannot be read or
+// unmarshalled.
+func loadManifest(projectPath string) (*recordManifest, error) {
+	manifest := &recordManifest{Scenes: make(map[string]string)}
+
+	contents, err := os.ReadFile(filepath.Join(projectPath, manifestName))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, manifest); err != nil {
+		return nil, fmt.Errorf("could not read the manifest of project %s: %s", projectPath, err)
+	}
+	if manifest.Scenes == nil {
+		manifest.Scenes = make(map[string]string)
+	}
+	return manifest, nil
+}
+
+// save writes the manifest at the root of the project.
+func (m *recordManifest) save(projectPath string) error {
+	contents, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(projectPath, manifestName), append(contents, '\n'), 0644)
+}
+
+// planRecording finds which of the selected scenes need to be recorded.
+//
+// If useCache is false, every selected scene is recorded. Otherwise, a
+// scene is reused if its hash matches the one saved in the manifest and
+// if its outputs still exist. Every other scene is recorded.
+//
+// The names of the scenes to record and of the scenes that are reused
+// are returned.
+func planRecording(projectPath string, manifest *recordManifest, scenes []int, useCache bool, settings *languageSettings, imageDigest string) ([]string, []string, error) {
+	selected, err := selectScenes(projectPath, scenes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !useCache {
+		return selected, nil, nil
+	}
+
+	var toRecord []string
+	var reused []string
+	for _, scene := range selected {
+		scenePath := filepath.Join(projectPath, scene)
+		hash, err := hashScene(scenePath, settings, imageDigest)
+		if err != nil {
+			return nil, nil, err
+		}
+		if manifest.Scenes[scene] == hash && sceneOutputsExist(scenePath) {
+			reused = append(reused, scene)
+		} else {
+			toRecord = append(toRecord, scene)
+		}
+	}
+	return toRecord, reused, nil
+}
+
+// update saves the hash of each recorded scene in the manifest. Scenes
+// that failed, or whose outputs were not all written since the
+// recording started, are removed from the manifest instead, so that
+// outputs left over from a previous recording are not reused.
+func (m *recordManifest) update(projectPath string, recorded []string, failed map[string]bool, started time.Time, settings *languageSettings, imageDigest string) error {
+	for _, scene := range recorded {
+		scenePath := filepath.Join(projectPath, scene)
+		if failed[scene] || !sceneOutputsSince(scenePath, started) {
+			delete(m.Scenes, scene)
+			continue
+		}
+		hash, err := hashScene(scenePath, settings, imageDigest)
+		if err != nil {
+			return err
+		}
+		m.Scenes[scene] = hash
+	}
+	return nil
+}
+
+// hashScene computes a hash of everything that is used to record a
+// scene. The hash covers the scene's command files, the text that is
+// read, the language settings and the digest of Good Bot's image.
+//
+// Files are hashed along with their name, so renaming a file also
+// changes the hash.
+func hashScene(scenePath string, settings *languageSettings, imageDigest string) (string, error) {
+	hash := sha256.New()
+
+	fmt.Fprintf(hash, "language=%s\nlanguage-name=%s\nimage=%s\n", settings.lang, settings.langName, imageDigest)
+
+	for _, dir := range []string{"commands", "read"} {
+		files, err := listFiles(filepath.Join(scenePath, dir))
+		if err != nil {
+			return "", err
+		}
+		for _, file := range files {
+			contents, err := os.ReadFile(filepath.Join(scenePath, dir, file))
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(hash, "%s/%s %d\n", dir, file, len(contents))
+			hash.Write(contents)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// sceneOutputsExist checks whether or not every output of a scene has
+// been recorded. Each command file should have a matching asciicast,
+// and each text file that is read should have a matching mp3 file.
+func sceneOutputsExist(scenePath string) bool {
+	return sceneOutputsSince(scenePath, time.Time{})
+}
+
+// sceneOutputsSince checks whether or not every output of a scene has
+// been written since the provided time. See sceneOutputsExist.
+func sceneOutputsSince(scenePath string, since time.Time) bool {
+	expected := map[string][2]string{
+		"commands": {"asciicasts", ".cast"},
+		"read":     {"audio", ".mp3"},
+	}
+
+	for inputDir, output := range expected {
+		files, err := listFiles(filepath.Join(scenePath, inputDir))
+		if err != nil {
+			return false
+		}
+		for _, file := range files {
+			name := strings.TrimSuffix(file, filepath.Ext(file)) + output[1]
+			info, err := os.Stat(filepath.Join(scenePath, output[0], name))
+			if err != nil || info.ModTime().Before(since) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// listFiles returns the sorted names of the files saved in a directory.
+// A directory that does not exist contains no files.
+func listFiles(dirPath string) ([]string, error) {
+	contents, err := os.ReadDir(dirPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, item := range contents {
+		if !item.IsDir() {
+			files = append(files, item.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// getImageDigest returns the ID of a Docker image on the host. The image
+// is pulled first if it can't be found.
+func getImageDigest(imageName string) (string, error) {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", err
+	}
+
+	if !imageExists(imageName, ctx, cli) {
+		reader, err := cli.ImagePull(ctx, imageName, types.ImagePullOptions{})
+		if err != nil {
+			return "", err
+		}
+		io.Copy(os.Stdout, reader)
+		reader.Close()
+	}
+
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		return "", err
+	}
+	return inspect.ID, nil
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestHashSceneSettings makes sure that the hash of a scene is stable,
+// and that it changes when the language settings or the image change.
+func TestHashSceneSettings(t *testing.T) {
+	scenePath := filepath.Join(testData.testProject1, "scene_1")
+	settings := &languageSettings{"en-US", "en-US-Standard-C"}
+
+	first, err := hashScene(scenePath, settings, "sha256:1234")
+	if err != nil {
+		t.Fatalf("hashScene(%s) returned error:\n%s", scenePath, err)
+	}
+	second, _ := hashScene(scenePath, settings, "sha256:1234")
+	if first != second {
+		t.Errorf("hashScene(%s) is not stable: got %s and %s", scenePath, first, second)
+	}
+
+	otherLanguage, _ := hashScene(scenePath, &languageSettings{"fr-CA", "fr-CA-Standard-A"}, "sha256:1234")
+	if otherLanguage == first {
+		t.Errorf("hashScene(%s) did not change with the language settings", scenePath)
+	}
+
+	otherImage, _ := hashScene(scenePath, settings, "sha256:5678")
+	if otherImage == first {
+		t.Errorf("hashScene(%s) did not change with the image digest", scenePath)
+	}
+}
+
+// TestSceneOutputsExist checks sceneOutputsExist on a scene that has
+// been recorded and on a scene that has not.
+func TestSceneOutputsExist(t *testing.T) {
+	recorded := filepath.Join(testData.testProject1, "scene_1")
+	if !sceneOutputsExist(recorded) {
+		t.Errorf("sceneOutputsExist(%s) = false, want true", recorded)
+	}
+
+	notRecorded := filepath.Join(testData.noAudio, "scene_1")
+	if sceneOutputsExist(notRecorded) {
+		t.Errorf("sceneOutputsExist(%s) = true, want false", notRecorded)
+	}
+}
+
+// TestPlanRecording uses a manifest that contains the hash of scene_1
+// only. scene_1 should be reused and every other scene recorded, unless
+// the cache is not used.
+func TestPlanRecording(t *testing.T) {
+	settings := &languageSettings{"en-US", "en-US-Standard-C"}
+	hash, err := hashScene(filepath.Join(testData.testProject1, "scene_1"), settings, "sha256:1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := &recordManifest{Scenes: map[string]string{"scene_1": hash, "scene_2": "outdated"}}
+
+	toRecord, reused, err := planRecording(testData.testProject1, manifest, nil, true, settings, "sha256:1234")
+	if err != nil {
+		t.Fatalf("planRecording(%s) returned error:\n%s", testData.testProject1, err)
+	}
+	if len(reused) != 1 || reused[0] != "scene_1" {
+		t.Errorf("planRecording(%s) reused %v, want [scene_1]", testData.testProject1, reused)
+	}
+	if len(toRecord) != 3 {
+		t.Errorf("planRecording(%s) records %v, want 3 scenes", testData.testProject1, toRecord)
+	}
+
+	toRecord, reused, _ = planRecording(testData.testProject1, manifest, nil, false, settings, "sha256:1234")
+	if len(reused) != 0 || len(toRecord) != 4 {
+		t.Errorf("planRecording(%s) without cache records %v and reuses %v, want every scene recorded", testData.testProject1, toRecord, reused)
+	}
+}
+
+// TestManifestSave saves a manifest in a temporary directory and loads
+// it back.
+func TestManifestSave(t *testing.T) {
+	manifest, err := loadManifest(testData.dir)
+	if err != nil {
+		t.Fatalf("loadManifest(%s) returned error:\n%s", testData.dir, err)
+	}
+	if len(manifest.Scenes) != 0 {
+		t.Errorf("loadManifest(%s) on a directory without manifest returned %v", testData.dir, manifest.Scenes)
+	}
+
+	manifest.Scenes["scene_1"] = "abc"
+	if err := manifest.save(testData.dir); err != nil {
+		t.Fatalf("save(%s) returned error:\n%s", testData.dir, err)
+	}
+
+	loaded, err := loadManifest(testData.dir)
+	if err != nil {
+		t.Fatalf("loadManifest(%s) returned error:\n%s", testData.dir, err)
+	}
+	if loaded.Scenes["scene_1"] != "abc" {
+		t.Errorf("loadManifest(%s) = %v, want scene_1: abc", testData.dir, loaded.Scenes)
+	}
+}
+
+// TestManifestUpdate only saves the scenes whose outputs were written
+// during the recording, and that did not fail.
+func TestManifestUpdate(t *testing.T) {
+	projectPath := copyTestScene(t)
+	settings := &languageSettings{"en-US", "en-US-Standard-C"}
+	manifest := &recordManifest{Scenes: map[string]string{"scene_1": "previous"}}
+	scenes := []string{"scene_1"}
+
+	// The outputs were copied before the recording started, so they
+	// are left over from a previous recording.
+	if err := manifest.update(projectPath, scenes, nil, time.Now().Add(time.Hour), settings, "sha256:1234"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manifest.Scenes["scene_1"]; ok {
+		t.Errorf("scene_1 was saved with outputs from before the recording: %v", manifest.Scenes)
+	}
+
+	started := time.Now().Add(-time.Hour)
+	if err := manifest.update(projectPath, scenes, map[string]bool{"scene_1": true}, started, settings, "sha256:1234"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manifest.Scenes["scene_1"]; ok {
+		t.Errorf("scene_1 was saved although it failed: %v", manifest.Scenes)
+	}
+
+	if err := manifest.update(projectPath, scenes, nil, started, settings, "sha256:1234"); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := hashScene(filepath.Join(projectPath, "scene_1"), settings, "sha256:1234")
+	if manifest.Scenes["scene_1"] != want {
+		t.Errorf("scene_1 has hash %q, want %q", manifest.Scenes["scene_1"], want)
+	}
+}
@@ -0,0 +1,258 @@
+// Player of a project exported by good-bot-cli. The frames of each
+// asciicast are drawn in advance, so the player only shows the rows of
+// each frame at the right time, and plays the narrations with them.
+(function () {
+  "use strict";
+
+  var terminal = document.getElementById("terminal");
+  var caption = document.getElementById("caption");
+  var playButton = document.getElementById("play");
+  var progress = document.getElementById("progress");
+  var timeLabel = document.getElementById("time");
+  var sceneList = document.getElementById("scenes");
+
+  var sceneIndex = 0;
+  var time = 0;
+  var playing = false;
+  var lastTick = 0;
+
+  // What the terminal shows: the action, its rows, and the index of the
+  // last frame drawn.
+  var shownAction = null;
+  var rows = [];
+  var frameIndex = -1;
+
+  var audios = [];
+
+  function scene() {
+    return project.scenes[sceneIndex];
+  }
+
+  function formatTime(seconds) {
+    var minutes = Math.floor(seconds / 60);
+    var rest = Math.floor(seconds % 60);
+    return minutes + ":" + (rest < 10 ? "0" : "") + rest;
+  }
+
+  // currentAction returns the action whose asciicast is shown at time t.
+  function currentAction(t) {
+    var actions = scene().actions;
+    var index = 0;
+    for (var i = 0; i < actions.length; i++) {
+      if (actions[i].shown <= t) {
+        index = i;
+      }
+    }
+    return actions[index];
+  }
+
+  function drawRows() {
+    terminal.innerHTML = rows.join("\n");
+  }
+
+  // drawFrames shows the frames of the current action up to time t. The
+  // rows are drawn again from the first frame when going back in time.
+  function drawFrames(t) {
+    var action = currentAction(t);
+    if (!action) {
+      return;
+    }
+    if (action !== shownAction || (frameIndex >= 0 && action.frames[frameIndex].time > t)) {
+      shownAction = action;
+      rows = [];
+      for (var y = 0; y < action.height; y++) {
+        rows.push("");
+      }
+      frameIndex = -1;
+      terminal.style.color = action.foreground;
+      terminal.style.background = action.background;
+      terminal.style.width = action.width + "ch";
+      terminal.style.height = (action.height * 1.2) + "em";
+    }
+
+    var changed = false;
+    while (frameIndex + 1 < action.frames.length && action.frames[frameIndex + 1].time <= t) {
+      frameIndex++;
+      var frame = action.frames[frameIndex];
+      for (var row in frame.rows) {
+        rows[row] = frame.rows[row];
+      }
+      changed = true;
+    }
+    if (changed || frameIndex === -1) {
+      drawRows();
+    }
+  }
+
+  // audioEnd returns when the narration of an action ends.
+  function audioEnd(action, audio) {
+    var length = audio && isFinite(audio.duration) ? audio.duration : action.duration;
+    return action.start + length;
+  }
+
+  function drawCaption(t) {
+    var text = "";
+    scene().actions.forEach(function (action, i) {
+      var end = Math.max(action.start + action.duration, audioEnd(action, audios[i]));
+      if (action.caption && action.start <= t && t < end) {
+        text = action.caption;
+      }
+    });
+    if (caption.textContent !== text) {
+      caption.textContent = text;
+    }
+  }
+
+  // syncAudio plays the narrations that should be heard at time t. When
+  // seek is true, narrations that are already playing are moved to t.
+  function syncAudio(t, seek) {
+    scene().actions.forEach(function (action, i) {
+      var audio = audios[i];
+      if (!audio) {
+        return;
+      }
+      var heard = playing && action.start <= t && t < audioEnd(action, audio);
+      if (!heard) {
+        if (!audio.paused) {
+          audio.pause();
+        }
+        return;
+      }
+      if (audio.paused || seek) {
+        audio.currentTime = t - action.start;
+      }
+      if (audio.paused) {
+        audio.play().catch(function () {});
+      }
+    });
+  }
+
+  function draw(t, seek) {
+    drawFrames(t);
+    drawCaption(t);
+    syncAudio(t, seek);
+    progress.value = t;
+    timeLabel.textContent = formatTime(t) + " / " + formatTime(scene().duration);
+  }
+
+  function tick(now) {
+    if (!playing) {
+      return;
+    }
+    time += (now - lastTick) / 1000;
+    lastTick = now;
+    if (time >= scene().duration) {
+      if (sceneIndex + 1 < project.scenes.length) {
+        loadScene(sceneIndex + 1, 0);
+      } else {
+        time = scene().duration;
+        setPlaying(false);
+        draw(time, false);
+        return;
+      }
+    }
+    draw(time, false);
+    requestAnimationFrame(tick);
+  }
+
+  function setPlaying(value) {
+    playing = value;
+    playButton.textContent = playing ? "Pause" : "Play";
+    if (playing) {
+      lastTick = performance.now();
+      requestAnimationFrame(tick);
+    }
+    syncAudio(time, false);
+  }
+
+  // loadScene shows a scene from time t, and creates the audio elements
+  // of its narrations.
+  function loadScene(index, t) {
+    audios.forEach(function (audio) {
+      if (audio) {
+        audio.pause();
+      }
+    });
+    sceneIndex = index;
+    audios = scene().actions.map(function (action) {
+      if (!action.audio) {
+        return null;
+      }
+      var audio = new Audio(action.audio);
+      audio.preload = "auto";
+      return audio;
+    });
+    shownAction = null;
+    time = t;
+    progress.max = scene().duration;
+    updateSceneList();
+    draw(time, true);
+  }
+
+  function seek(index, t) {
+    if (index !== sceneIndex) {
+      loadScene(index, t);
+    } else {
+      time = t;
+      draw(time, true);
+    }
+  }
+
+  function updateSceneList() {
+    var items = sceneList.querySelectorAll("[data-scene]");
+    for (var i = 0; i < items.length; i++) {
+      var current = Number(items[i].getAttribute("data-scene")) === sceneIndex;
+      items[i].classList.toggle("current", current);
+    }
+  }
+
+  function button(text, className, onClick) {
+    var element = document.createElement("button");
+    element.type = "button";
+    element.className = className;
+    element.textContent = text;
+    element.addEventListener("click", onClick);
+    return element;
+  }
+
+  // buildSceneList lists the scenes of the project, with one chapter
+  // for each action.
+  function buildSceneList() {
+    project.scenes.forEach(function (s, index) {
+      var sceneButton = button(s.name.replace("_", " "), "scene", function () {
+        seek(index, 0);
+      });
+      sceneButton.setAttribute("data-scene", index);
+      sceneList.appendChild(sceneButton);
+
+      var chapters = document.createElement("ol");
+      s.actions.forEach(function (action) {
+        var item = document.createElement("li");
+        item.appendChild(button(action.title, "chapter", function () {
+          seek(index, action.start);
+        }));
+        chapters.appendChild(item);
+      });
+      sceneList.appendChild(chapters);
+    });
+  }
+
+  playButton.addEventListener("click", function () {
+    if (!playing && time >= scene().duration && sceneIndex + 1 >= project.scenes.length) {
+      loadScene(0, 0);
+    }
+    setPlaying(!playing);
+  });
+  progress.addEventListener("input", function () {
+    seek(sceneIndex, Number(progress.value));
+  });
+  document.addEventListener("keydown", function (event) {
+    if (event.key === " " && event.target === document.body) {
+      event.preventDefault();
+      playButton.click();
+    }
+  });
+
+  buildSceneList();
+  loadScene(0, 0);
+})();
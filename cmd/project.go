@@ -0,0 +1,75 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// projectSettingsName is the name of the file, at the root of a
+// project, that contains the project's settings.
+const projectSettingsName string = "good-bot.yaml"
+
+// projectSettings are the settings of a single project. Every setting is
+// optional.
+type projectSettings struct {
+	Terminal terminalSettings `yaml:"terminal"`
+}
+
+// terminalSettings is the size of the terminal that asciicasts are
+// cropped to before being rendered.
+type terminalSettings struct {
+	Width  int `yaml:"width"`
+	Height int `yaml:"height"`
+}
+
+// defaultProjectSettings returns the settings used when a project does
+// not set them.
+func defaultProjectSettings() *projectSettings {
+	return &projectSettings{
+		Terminal: terminalSettings{Width: 80, Height: 24},
+	}
+}
+
+// loadProjectSettings reads the settings file of a project. Settings
+// that are missing from the file, or the whole file, are replaced by
+// their default value.
+//
+// An error is returned if the file exists but cannot be read, or if one
+// of its settings is invalid.
+func loadProjectSettings(projectPath string) (*projectSettings, error) {
+	settings := defaultProjectSettings()
+
+	settingsPath := filepath.Join(projectPath, projectSettingsName)
+	contents, err := os.ReadFile(settingsPath)
+	if os.IsNotExist(err) {
+		return settings, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(contents, settings); err != nil {
+		return nil, fmt.Errorf("could not read %s: %s", settingsPath, err)
+	}
+	if settings.Terminal.Width < 1 || settings.Terminal.Height < 1 {
+		return nil, fmt.Errorf("%s: the terminal's width and height should be positive", settingsPath)
+	}
+	return settings, nil
+}
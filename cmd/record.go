@@ -21,9 +21,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -48,6 +54,15 @@ If the argument is already a directory created by the
 setup command, this command will only use the record
 command to create the recordings.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if err := checkRenderer(); err != nil {
+			log.Fatal(err)
+		}
+		if err := checkLengthFix(); err != nil {
+			log.Fatal(err)
+		}
+		if err := checkVideoEngine(); err != nil {
+			log.Fatal(err)
+		}
 		setConfigInteraction()
 		dockerCheck()
 		processedArg, err := processPath(args[0])
@@ -59,25 +74,17 @@ command to create the recordings.`,
 		if err != nil {
 			log.Fatal(err)
 		}
+		scenes, err := parseSceneSelection(sceneSelection)
+		if err != nil {
+			log.Fatalf("Could not use the scenes '%s'. Error was:\n%s", sceneSelection, err)
+		}
 		if isDir {
-			runRecordCommand(processedArg, credentials.ttsFile, credentials.passwords, &languageSettings{language, languageName})
-			if !noRender {
-				renderAllRecordings(processedArg)
-				if !gifsOnly {
-					renderVideo(processedArg)
-				}
+			err = recordAndRender(processedArg, credentials, scenes)
+			if err != nil {
+				log.Fatal(err)
 			}
 		} else {
-			// TODO: Fix this.
-			// runSetupCommand(args[0], "/project")
-			// recDir := askRecDir()
-			// runRecordCommand(recDir, credentials.ttsFile, credentials.passwords)
-			// if !noRender {
-			// 	renderProject("Toto")
-			// }
-			fmt.Printf("Cannot create a video from %s.\n", processedArg)
-			fmt.Println("Please make sure that you used the setup command first.")
-			os.Exit(1)
+			recordScript(processedArg, credentials, scenes)
 		}
 	},
 	Args: func(cmd *cobra.Command, args []string) error {
@@ -96,13 +103,35 @@ command to create the recordings.`,
 type credentials struct {
 	passwords []string
 	ttsFile   string
+	// Whether or not the passwords from the secrets store were added.
+	storeLoaded bool
 }
 
 var (
-	gifsOnly     bool
-	noRender     bool
-	language     string
-	languageName string
+	gifsOnly        bool
+	noRender        bool
+	language        string
+	languageName    string
+	sceneSelection  string
+	recordJobs      int
+	failFast        bool
+	forceRecord     bool
+	recordRetries   int
+	projectDir      string
+	keepProject     bool
+	recordTimeout   time.Duration
+	idleLimit       time.Duration
+	renderer        string
+	renderScale     int
+	muxSubtitles    bool
+	fixLengths      string
+	videoEngine     string
+	videoCodec      string
+	videoCRF        int
+	videoFPS        int
+	videoResolution string
+	normalizeAudio  bool
+	forceRender     bool
 )
 
 type languageSettings struct {
@@ -128,6 +157,265 @@ func init() {
 audio recordings. No gifs or mp4 files are produced.`)
 	recordCmd.Flags().StringVarP(&language, "language", "l", "en-US", "Which language code to use for the narration.")
 	recordCmd.Flags().StringVarP(&languageName, "language-name", "n", "en-US-Standard-C", "Which language name to use for the narration.")
+	recordCmd.Flags().StringVar(&sceneSelection, "scenes", "", `Only record the provided scenes, e.g. "2,5-7". Every scene is
+recorded by default.`)
+	recordCmd.Flags().IntVarP(&recordJobs, "jobs", "j", 1, `How many scenes can be recorded, and asciicasts rendered, at
+the same time. Each scene is recorded in its own container.`)
+	recordCmd.Flags().BoolVar(&failFast, "fail-fast", false, `Stop recording the other scenes as soon as one of them fails.
+Only used when recording more than one scene at a time.`)
+	recordCmd.Flags().BoolVar(&forceRecord, "force", false, `Record every scene, even the ones that haven't changed since
+the last recording.`)
+	recordCmd.Flags().IntVar(&recordRetries, "retries", 0, `How many times a scene that failed is recorded again. Each
+scene is then recorded in its own container.`)
+	recordCmd.Flags().StringVar(&projectDir, "project-dir", "", `Where to create the project when recording a script. The
+project is created in a temporary directory by default.`)
+	recordCmd.Flags().BoolVar(&keepProject, "keep-project", false, `Keep the temporary project created when recording a script.
+Projects created with --project-dir are always kept.`)
+	recordCmd.Flags().DurationVar(&recordTimeout, "timeout", 0, `How long Good Bot can wait for what it expects, e.g. "30s".
+Actions can override it with a "timeout" key. There is no
+timeout by default.`)
+	recordCmd.Flags().DurationVar(&idleLimit, "idle-limit", 0, `Shorten the pauses of the recordings that are longer than
+this, e.g. "2s". Pauses are kept as they are by default.`)
+	recordCmd.Flags().StringSliceVar(&renderFormats, "formats", []string{gifFormat}, formatsHelp)
+	recordCmd.Flags().StringVar(&renderer, "renderer", dockerRenderer, `How gifs are rendered. "asciicast2gif" uses Asciicast2gif's
+Docker image, and "native" renders them without Docker.`)
+	recordCmd.Flags().IntVar(&renderScale, "scale", 1, `How much bigger the gifs of the native renderer are. A scale
+of 1 uses 7x13 pixels per character.`)
+	recordCmd.Flags().BoolVar(&muxSubtitles, "subtitles", false, `Add the subtitles of the narration to the final video.
+They are always written in the final directory.`)
+	recordCmd.Flags().StringVar(&fixLengths, "fix-lengths", "", `Make the asciicasts whose narration is longer as long as
+their narration. "pad" adds a pause at their end, and "slow"
+slows down their typing first. They are only reported by
+default.`)
+	recordCmd.Flags().StringVar(&videoEngine, "video-engine", containerEngine, `How the final video is made from the gifs. "container" uses
+Good Bot's Docker image, and "ffmpeg" uses a local FFmpeg.`)
+	recordCmd.Flags().StringVar(&videoCodec, "codec", "libx264", "Which video codec the ffmpeg video engine and the mp4 format use.")
+	recordCmd.Flags().IntVar(&videoCRF, "crf", 23, `The quality of the videos made with FFmpeg, from 0 to 51. Lower
+values look better, but make bigger files.`)
+	recordCmd.Flags().IntVar(&videoFPS, "fps", 25, "How many frames per second the videos made with FFmpeg have.")
+	recordCmd.Flags().StringVar(&videoResolution, "resolution", "1280x720", `The size of the videos of the ffmpeg video engine and the mp4
+format. The gifs are scaled to fit it.`)
+	recordCmd.Flags().BoolVar(&normalizeAudio, "normalize", false, "Normalize the loudness of the narration.")
+}
+
+// recordAndRender records a project and then renders it, unless the
+// --no-render flag is used. Only the provided scenes are recorded and
+// rendered, or every scene if scenes is empty.
+//
+// Passwords that were printed during the recording are redacted from
+// the asciicasts and the recording logs before they are rendered, even
+// if the recording failed. A marker is then added at the start of each
+// action. The markers are used to align the narration
+// with the actions, and to add chapters to the final video.
+//
+// An error is returned if the project could not be recorded, redacted
+// or rendered.
+func recordAndRender(projectPath string, creds *credentials, scenes []int) error {
+	recordErr := recordProject(projectPath, creds, &languageSettings{language, languageName}, scenes)
+	err := redactProject(projectPath, scenes, creds.passwords)
+	if err != nil {
+		return err
+	}
+	if recordErr != nil {
+		return recordErr
+	}
+	err = markProjectActions(projectPath, scenes)
+	if err != nil {
+		return err
+	}
+	if !noRender {
+		// Narrations are only added to the mp4 files.
+		if makesFinalVideo() || hasFormat(mp4Format) {
+			if err := checkLengths(projectPath, scenes); err != nil {
+				log.Printf("Could not compare the length of the narrations and asciicasts.\n%s", err)
+			}
+		}
+		if err := renderAllRecordings(projectPath, scenes); err != nil {
+			return err
+		}
+		if makesFinalVideo() {
+			makeVideo(projectPath)
+		}
+	}
+	return nil
+}
+
+// recordScript creates a project from a script using the setup command,
+// and then records and renders the project. No prompt is shown to the
+// user. See setupFromScript for more information on where the project
+// is created.
+//
+// A temporary project is removed once it has been rendered, unless
+// --keep-project is used. The final video is then copied next to the
+// script, in a directory named after the script. Temporary projects are
+// always kept when using --no-render or --gifs-only, since the final
+// directory would be empty. The same goes for --formats with anything
+// but the gif format, since the other formats are written in the
+// project's scenes.
+func recordScript(scriptPath string, creds *credentials, scenes []int) {
+	projectPath, isTemporary, err := setupFromScript(scriptPath, projectDir)
+	if err != nil {
+		log.Fatalf("Could not set up a project from %s. Error was:\n%s", scriptPath, err)
+	}
+	onlyFinalVideo := makesFinalVideo() && len(renderFormats) == 1
+	keep := !isTemporary || keepProject || noRender || !onlyFinalVideo
+
+	err = recordAndRender(projectPath, creds, scenes)
+	if err != nil {
+		log.Fatalf("%s\nThe project has been kept in %s", err, projectPath)
+	}
+
+	if keep {
+		fmt.Printf("The project has been saved in %s\n", projectPath)
+		return
+	}
+
+	stem := strings.TrimSuffix(filepath.Base(scriptPath), filepath.Ext(scriptPath))
+	finalPath := filepath.Join(filepath.Dir(scriptPath), stem+"-final")
+	if err := copyDir(filepath.Join(projectPath, "final"), finalPath); err != nil {
+		log.Fatalf("Could not copy the final video. Error was:\n%s\nThe project has been kept in %s", err, projectPath)
+	}
+	// The temporary directory only contains the project.
+	if err := os.RemoveAll(filepath.Dir(projectPath)); err != nil {
+		log.Printf("Could not remove the temporary project %s.\n%s", projectPath, err)
+	}
+	fmt.Printf("The final video has been saved in %s\n", finalPath)
+}
+
+// setupFromScript uses the setup command to create a project from a
+// script, without prompting the user.
+//
+// If projectDir is empty, the project is created in a new temporary
+// directory and named after the script. Otherwise, the project is
+// created at projectDir, which should not exist yet.
+//
+// The path towards the project is returned, along with whether or not
+// the project is temporary. An error is returned if the project could
+// not be created.
+func setupFromScript(scriptPath string, projectDir string) (string, bool, error) {
+	var saveInfo projectSaveInfo
+	isTemporary := projectDir == ""
+
+	if isTemporary {
+		tempDir, err := ioutil.TempDir("", "good-bot-")
+		if err != nil {
+			return "", false, err
+		}
+		stem := strings.TrimSuffix(filepath.Base(scriptPath), filepath.Ext(scriptPath))
+		saveInfo = projectSaveInfo{Path: tempDir, Name: stem}
+	} else {
+		processed, err := processPath(projectDir)
+		if err != nil {
+			return "", false, err
+		}
+		if validatePath(processed) {
+			return "", false, fmt.Errorf("%s already exists", processed)
+		}
+		if !validatePath(filepath.Dir(processed)) {
+			return "", false, fmt.Errorf("directory %s does not exist", filepath.Dir(processed))
+		}
+		saveInfo = projectSaveInfo{Path: filepath.Dir(processed), Name: filepath.Base(processed)}
+	}
+
+	projectPath := runSetupCommand(scriptPath, "/project", saveInfo, false)
+
+	isDir, err := isDirectory(projectPath)
+	if err != nil || !isDir {
+		return "", false, fmt.Errorf("the setup command did not create a project in %s", projectPath)
+	}
+	return projectPath, isTemporary, nil
+}
+
+// recordProject records the scenes of a project that need to be recorded.
+//
+// If no scene is provided and the recording is not forced, the scenes that
+// haven't changed since their last successful recording are reused. See
+// planRecording for more information on how those scenes are found.
+// Otherwise, every selected scene is recorded.
+//
+// Each scene that was recorded successfully is then saved in the project's
+// manifest. A scene only counts as recorded if every one of its asciicasts
+// was written during this recording, so that outputs left over from a
+// previous recording are never saved as up to date. An error is returned if the manifest cannot be used or if one
+// of the scenes could not be recorded.
+func recordProject(projectPath string, creds *credentials, settings *languageSettings, scenes []int) error {
+	imageDigest, err := getImageDigest("trickytroll/good-bot:latest")
+	if err != nil {
+		return err
+	}
+
+	manifest, err := loadManifest(projectPath)
+	if err != nil {
+		return err
+	}
+
+	useCache := !forceRecord && len(scenes) == 0
+	toRecord, reused, err := planRecording(projectPath, manifest, scenes, useCache, settings, imageDigest)
+	if err != nil {
+		return err
+	}
+
+	if len(reused) > 0 {
+		fmt.Printf("Reusing %d unchanged scene(s) from the previous recording: %s\n", len(reused), strings.Join(reused, ", "))
+	}
+	if len(toRecord) == 0 {
+		fmt.Println("Every scene is up to date. Use --force to record them again.")
+		return nil
+	}
+
+	// The secrets store is only opened if it is needed.
+	usesPasswords, err := referencesPasswords(projectPath, toRecord)
+	if err != nil {
+		return err
+	}
+	if usesPasswords {
+		if err := creds.loadStoredPasswords(); err != nil {
+			return err
+		}
+	}
+	if err := checkPasswordReferences(projectPath, toRecord, creds.passwords); err != nil {
+		return err
+	}
+
+	var toRecordNumbers []int
+	for _, scene := range toRecord {
+		number, _ := sceneNumber(scene)
+		toRecordNumbers = append(toRecordNumbers, number)
+	}
+
+	// Outputs written before this are left over from a previous
+	// recording.
+	started := time.Now().Add(-modTimeSlack)
+	failed := make(map[string]bool)
+	var recordErr error
+	if recordJobs > 1 || recordRetries > 0 {
+		var results []sceneResult
+		results, recordErr = recordScenes(projectPath, creds.ttsFile, creds.passwords, settings, toRecordNumbers, &jobSettings{recordJobs, failFast, recordRetries, recordTimeout})
+		for _, result := range results {
+			if result.err != nil {
+				failed[result.scene] = true
+			}
+		}
+	} else {
+		recordErr = runRecordCommand(projectPath, creds.ttsFile, creds.passwords, settings, toRecordNumbers, recordTimeout)
+		// A single container records every scene, so there is no way
+		// to tell which ones succeeded.
+		if recordErr != nil {
+			for _, scene := range toRecord {
+				failed[scene] = true
+			}
+		}
+	}
+
+	if err := manifest.update(projectPath, toRecord, failed, started, settings, imageDigest); err != nil {
+		return err
+	}
+
+	if err := manifest.save(projectPath); err != nil {
+		return err
+	}
+
+	return recordErr
 }
 
 // runRecordCommand uses Good Bot's record command to record a project.
@@ -142,13 +430,29 @@ audio recordings. No gifs or mp4 files are produced.`)
 //
 // runRecordCommand also sets language settings by providing the required
 // flags to the container's command-line interface.
-func runRecordCommand(hostPath string, ttsFile string, envVars []string, settings *languageSettings) {
-	// Used later for i/o between container and shell
-	isRead, err := isReadStatement(hostPath)
-	var containerTtsPath string
-	var credentialsEnv string
-	var resp container.ContainerCreateCreatedBody
+//
+// If scenes is not empty, only the scenes with those numbers are mounted
+// in the container. Good Bot then only sees those scenes, and the outputs
+// of every other scene are left untouched.
+//
+// The recording is watched for timeouts, using timeout as the default
+// timeout of every action. If the recording times out, the container is
+// killed and a recordTimeoutError is returned. See watchRecording for
+// more information. An error is also returned if the container exits with
+// a non-zero status. The container is removed once the recording is done.
+func runRecordCommand(hostPath string, ttsFile string, envVars []string, settings *languageSettings, scenes []int, timeout time.Duration) error {
+	// The selection is checked before anything is created, so that an
+	// invalid selection doesn't leave a container behind.
+	selected, err := selectScenes(hostPath, scenes)
+	if err != nil {
+		return err
+	}
+	var scenePaths []string
+	for _, scene := range selected {
+		scenePaths = append(scenePaths, filepath.Join(hostPath, scene))
+	}
 
+	// Used later for i/o between container and shell
 	inout := make(chan []byte)
 
 	ctx := context.Background()
@@ -157,7 +461,6 @@ func runRecordCommand(hostPath string, ttsFile string, envVars []string, setting
 		panic(err)
 	}
 
-
 	if !imageExists("trickytroll/good-bot:latest", ctx, cli) {
 		reader, err := cli.ImagePull(ctx, "trickytroll/good-bot:latest", types.ImagePullOptions{})
 		if err != nil {
@@ -166,19 +469,125 @@ func runRecordCommand(hostPath string, ttsFile string, envVars []string, setting
 		io.Copy(os.Stdout, reader)
 	}
 
-	stats, err := os.Stat(hostPath)
+	containerID, err := createRecordContainer(ctx, cli, hostPath, ttsFile, envVars, settings, scenes)
+	if err != nil {
+		panic(err)
+	}
+	defer cli.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{Force: true})
+
+	if err := cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
+		panic(err)
+	}
+	// Need to attach since the user will be interacting with the container
+	waiter, err := cli.ContainerAttach(ctx, containerID, types.ContainerAttachOptions{
+		Stderr: true,
+		Stdout: true,
+		Stdin:  true,
+		Stream: true,
+	})
+
+	// Starting a goroutine for copying. Copies container output to stdout.
+	go io.Copy(os.Stdout, waiter.Reader)
+	go io.Copy(os.Stderr, waiter.Reader)
+
+	if err != nil {
+		panic(err)
+	}
+
+	go func() { // In a goroutine
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() { // Write terminal input to inout channel
+			inout <- []byte(scanner.Text())
+		}
+	}()
+
+	go func(w io.WriteCloser) { // In another goroutine
+		for {
+			data, ok := <-inout // Get terminal input from channel
+			if !ok {
+				fmt.Println("!ok")
+				w.Close()
+				return
+			}
+
+			w.Write(append(data, '\n')) // Write input to `w`. `w` is a Conn interface.
+			// See https://pkg.go.dev/net#Conn
+		}
+	}(waiter.Conn)
+
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	timedOut := watchRecording(watchCtx, scenePaths, timeout)
+
+	var statusErr error
+	statusCh, errCh := cli.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case err := <-timedOut:
+		cli.ContainerKill(ctx, containerID, "KILL")
+		return err
+	case err := <-errCh:
+		if err != nil {
+			panic(err)
+		}
+	case status := <-statusCh:
+		if status.Error != nil {
+			statusErr = fmt.Errorf("%s", status.Error.Message)
+		} else if status.StatusCode != 0 {
+			statusErr = fmt.Errorf("container exited with status %d", status.StatusCode)
+		}
+	}
+
+	out, err := cli.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{ShowStdout: true})
 	if err != nil {
 		panic(err)
 	}
 
+	stdcopy.StdCopy(os.Stdout, os.Stderr, out)
+
+	return statusErr
+}
+
+// createRecordContainer creates a container that uses Good Bot's record
+// command on the project saved at hostPath. Only the provided scenes are
+// mounted in the container, or every scene if scenes is empty. See
+// getProjectMounts for more information on the mounts.
+//
+// If the project contains read statements, the TTS credentials are
+// mounted in the container and the language settings are provided to
+// Good Bot. The program exits if there is something to read but no
+// credentials file has been configured.
+//
+// The ID of the created container is returned. The container still needs
+// to be started.
+func createRecordContainer(ctx context.Context, cli *client.Client, hostPath string, ttsFile string, envVars []string, settings *languageSettings, scenes []int) (string, error) {
+	isRead, err := isReadStatement(hostPath)
+	if err != nil {
+		return "", err
+	}
+	var containerTtsPath string
+	var credentialsEnv string
+	var resp container.ContainerCreateCreatedBody
+
+	stats, err := os.Stat(hostPath)
+	if err != nil {
+		return "", err
+	}
+
 	projectName := stats.Name()
 
 	containerProjectPath := "/project" + "/" + projectName
 
+	projectMounts, err := getProjectMounts(hostPath, containerProjectPath, scenes)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 
+	mounts := append(projectMounts, mount.Mount{
+		Type:   mount.TypeBind,
+		Source: getDir(ttsFile),
+		Target: "/credentials",
+	})
+
 	if isRead && len(ttsFile) < 1 {
 
 		//////////////////////////////////////////////////////////////////
@@ -198,7 +607,7 @@ func runRecordCommand(hostPath string, ttsFile string, envVars []string, setting
 
 		ttyFileStats, err := os.Stat(ttsFile)
 		if err != nil {
-			panic(err)
+			return "", err
 		}
 		ttsFileName := ttyFileStats.Name()
 
@@ -217,21 +626,10 @@ func runRecordCommand(hostPath string, ttsFile string, envVars []string, setting
 			Image:        "trickytroll/good-bot:latest",
 			Volumes:      map[string]struct{}{},
 		}, &container.HostConfig{
-			Mounts: []mount.Mount{
-				{
-					Type:   mount.TypeBind,
-					Source: getDir(hostPath),
-					Target: "/project",
-				},
-				{
-					Type:   mount.TypeBind,
-					Source: getDir(ttsFile),
-					Target: "/credentials",
-				},
-			},
+			Mounts: mounts,
 		}, nil, nil, "")
 		if err != nil {
-			panic(err)
+			return "", err
 		}
 
 	} else {
@@ -251,99 +649,138 @@ func runRecordCommand(hostPath string, ttsFile string, envVars []string, setting
 			Image:        "trickytroll/good-bot:latest",
 			Volumes:      map[string]struct{}{},
 		}, &container.HostConfig{
-			Mounts: []mount.Mount{
-				{
-					Type:   mount.TypeBind,
-					Source: getDir(hostPath),
-					Target: "/project",
-				},
-				{
-					Type:   mount.TypeBind,
-					Source: getDir(ttsFile),
-					Target: "/credentials",
-				},
-			},
+			Mounts: mounts,
 		}, nil, nil, "")
 		if err != nil {
-			panic(err)
+			return "", err
 		}
 	}
 
+	return resp.ID, nil
+}
 
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		panic(err)
+// isDirectory checks whether or not a path is a directory. It uses
+// os.Stat to get information on the provided path, and then uses
+// IsDir on the information provided.
+func isDirectory(path string) (bool, error) {
+	// path should be valid since it's been checked by validatePath()
+	info, err := os.Stat(path)
+	if err != nil {
+		// If path is not valid, it means that there is a missing
+		// validatePath() somewhere.
+		return false, err
 	}
-	// Need to attach since the user will be interacting with the container
-	waiter, err := cli.ContainerAttach(ctx, resp.ID, types.ContainerAttachOptions{
-		Stderr: true,
-		Stdout: true,
-		Stdin:  true,
-		Stream: true,
-	})
+	return info.IsDir(), nil
+}
 
-	// Starting a goroutine for copying. Copies container output to stdout.
-	go io.Copy(os.Stdout, waiter.Reader)
-	go io.Copy(os.Stderr, waiter.Reader)
+// getProjectMounts creates the mounts required to give Good Bot's
+// container access to the project saved at hostPath. The project is
+// available under containerProjectPath in the container.
+//
+// If scenes is empty, the directory that contains the project is
+// mounted as "/project", like it always has been. Otherwise, every
+// item of the project that isn't a scene is mounted individually, along
+// with the selected scenes. An error is returned if one of the selected
+// scenes cannot be found in the project.
+func getProjectMounts(hostPath string, containerProjectPath string, scenes []int) ([]mount.Mount, error) {
+	if len(scenes) == 0 {
+		return []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: getDir(hostPath),
+				Target: "/project",
+			},
+		}, nil
+	}
 
+	selected, err := selectScenes(hostPath, scenes)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	go func() { // In a goroutine
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() { // Write terminal input to inout channel
-			inout <- []byte(scanner.Text())
-		}
-	}()
-
-	go func(w io.WriteCloser) { // In another goroutine
-		for {
-			data, ok := <-inout // Get terminal input from channel
-			if !ok {
-				fmt.Println("!ok")
-				w.Close()
-				return
-			}
+	isSelected := make(map[string]bool)
+	for _, scene := range selected {
+		isSelected[scene] = true
+	}
 
-			w.Write(append(data, '\n')) // Write input to `w`. `w` is a Conn interface.
-			// See https://pkg.go.dev/net#Conn
-		}
-	}(waiter.Conn)
+	projectContents, err := os.ReadDir(hostPath)
+	if err != nil {
+		return nil, err
+	}
 
-	statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
-	select {
-	case err := <-errCh:
-		if err != nil {
-			panic(err)
+	var mounts []mount.Mount
+	for _, item := range projectContents {
+		if isScene(item) && !isSelected[item.Name()] {
+			continue
 		}
-	case <-statusCh:
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: filepath.Join(hostPath, item.Name()),
+			Target: containerProjectPath + "/" + item.Name(),
+		})
 	}
+	return mounts, nil
+}
 
-	out, err := cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true})
-	if err != nil {
-		panic(err)
+// parseSceneSelection parses a list of scenes such as "2,5-7". Items
+// are separated by commas, and each item is either a scene number or
+// an inclusive range of scene numbers. The scene numbers are returned
+// sorted and without duplicates.
+//
+// An empty selection returns an empty slice, which means that every
+// scene should be used. An error is returned if one of the items is
+// not a positive number or a valid range.
+func parseSceneSelection(selection string) ([]int, error) {
+	var scenes []int
+	seen := make(map[int]bool)
+
+	if strings.TrimSpace(selection) == "" {
+		return scenes, nil
 	}
 
-	stdcopy.StdCopy(os.Stdout, os.Stderr, out)
-}
+	for _, item := range strings.Split(selection, ",") {
+		item = strings.TrimSpace(item)
+		bounds := strings.SplitN(item, "-", 2)
 
-// isDirectory checks whether or not a path is a directory. It uses
-// os.Stat to get information on the provided path, and then uses
-// IsDir on the information provided.
-func isDirectory(path string) (bool, error) {
-	// path should be valid since it's been checked by validatePath()
-	info, err := os.Stat(path)
-	if err != nil {
-		// If path is not valid, it means that there is a missing
-		// validatePath() somewhere.
-		return false, err
+		first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil || first < 1 {
+			return nil, fmt.Errorf("'%s' is not a valid scene number", item)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil || last < first {
+				return nil, fmt.Errorf("'%s' is not a valid range of scenes", item)
+			}
+		}
+
+		for scene := first; scene <= last; scene++ {
+			if !seen[scene] {
+				seen[scene] = true
+				scenes = append(scenes, scene)
+			}
+		}
 	}
-	return info.IsDir(), nil
+	sort.Ints(scenes)
+
+	return scenes, nil
 }
 
-// parsePasswords reads a password file and stores its values in an array.
-// Using the provided passwordsPath, it reads the file and trims newline
-// characters. The processed lines are then returned.
+// envVarName matches the names that can be used in a passwords file.
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parsePasswords reads a passwords file that uses the dotenv format, and
+// returns its values as "NAME=value" strings that can be used as a
+// container's environment.
+//
+// Blank lines and lines starting with "#" are ignored, and each variable
+// can be prefixed by "export". Values can be surrounded by single quotes,
+// which are kept as is, or by double quotes, in which "\n", "\t", "\""
+// and "\\" are unescaped. Unquoted values end at the first " #", which
+// starts a comment.
+//
+// An error that contains the line number is returned if a line is not
+// a valid variable, or if a variable is defined more than once.
 func parsePasswords(passwordsPath string) ([]string, error) {
 	file, err := os.Open(passwordsPath)
 	if err != nil {
@@ -351,23 +788,177 @@ func parsePasswords(passwordsPath string) ([]string, error) {
 	}
 	defer file.Close()
 
-	var lines []string
+	var passwords []string
+	definedOn := make(map[string]int)
+	lineNumber := 0
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		lines = append(lines, strings.Trim(scanner.Text(), "\n"))
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, err := parseDotenvLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s, line %d: %s", passwordsPath, lineNumber, err)
+		}
+		if previous, ok := definedOn[name]; ok {
+			return nil, fmt.Errorf("%s, line %d: %s is already defined on line %d", passwordsPath, lineNumber, name, previous)
+		}
+		definedOn[name] = lineNumber
+		passwords = append(passwords, name+"="+value)
 	}
-	return lines, scanner.Err()
+	return passwords, scanner.Err()
+}
+
+// parseDotenvLine parses a single variable from a dotenv file. The line
+// should not be blank or a comment. The variable's name and value are
+// returned.
+func parseDotenvLine(line string) (string, string, error) {
+	if strings.HasPrefix(line, "export ") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+	}
+
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("expected NAME=value, got %q", line)
+	}
+	name := strings.TrimSpace(parts[0])
+	if !envVarName.MatchString(name) {
+		return "", "", fmt.Errorf("%q is not a valid variable name", name)
+	}
+
+	value := strings.TrimSpace(parts[1])
+	if value == "" {
+		return name, "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'', '"':
+		end := -1
+		for i := 1; i < len(value); i++ {
+			if quote == '"' && value[i] == '\\' {
+				// Skipping the escaped character.
+				i++
+			} else if value[i] == quote {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return "", "", fmt.Errorf("the value of %s is missing a closing quote", name)
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", "", fmt.Errorf("unexpected %q after the value of %s", rest, name)
+		}
+		value = value[1:end]
+		if quote == '"' {
+			value = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value)
+		}
+	default:
+		if comment := strings.Index(value, " #"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+	}
+	return name, value, nil
+}
+
+// referencesPasswords checks whether or not a script of the provided
+// scenes uses a password.
+func referencesPasswords(projectPath string, scenes []string) (bool, error) {
+	for _, scene := range scenes {
+		actions, err := parseSceneActions(filepath.Join(projectPath, scene))
+		if err != nil {
+			return false, err
+		}
+		for _, action := range actions {
+			for _, command := range action.commands {
+				if command.password != "" {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// checkPasswordReferences makes sure that every password used in the
+// provided scenes is defined in the passwords. Passwords are used in
+// scripts with "password: NAME".
+//
+// An error that lists every password that is not defined is returned.
+func checkPasswordReferences(projectPath string, scenes []string, passwords []string) error {
+	defined := make(map[string]bool)
+	for _, password := range passwords {
+		defined[strings.SplitN(password, "=", 2)[0]] = true
+	}
+
+	var missing []string
+	for _, scene := range scenes {
+		actions, err := parseSceneActions(filepath.Join(projectPath, scene))
+		if err != nil {
+			return err
+		}
+		for _, action := range actions {
+			for _, command := range action.commands {
+				if command.password != "" && !defined[command.password] {
+					missing = append(missing, fmt.Sprintf("%s/%s uses password %s", scene, action.name, command.password))
+				}
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("some passwords are not defined in your passwords file or secrets store:\n%s", strings.Join(missing, "\n"))
+	}
+	return nil
 }
 
 // copyCredentials unpacks the TTS credentials and passwords from
 // Viper strings into a credentials structure. It returns an instance
 // of credentials filled with values from Viper.
+//
+// The secrets store is not opened, since it can ask for a passphrase.
+// See loadStoredPasswords.
+//
+// The program exits if the passwords file cannot be parsed.
 func copyCredentials() *credentials {
 
 	ttsCredentials := viper.GetString("ttsCredentials")
 	passwordsEnv := viper.GetString("passwordsEnv")
 
-	allPasswords, _ := parsePasswords(passwordsEnv)
+	var allPasswords []string
+	if passwordsEnv != "" {
+		var err error
+		allPasswords, err = parsePasswords(passwordsEnv)
+		if err != nil {
+			log.Fatalf("Could not read your passwords file. Error was:\n%s", err)
+		}
+	}
+
+	return &credentials{passwords: allPasswords, ttsFile: ttsCredentials}
+}
 
-	return &credentials{allPasswords, ttsCredentials}
+// loadStoredPasswords adds the secrets from the encrypted secrets store,
+// if there is one, to the passwords. They are only decrypted in memory.
+// The store is only opened once.
+//
+// An error is returned if the secrets store cannot be decrypted, or if a
+// password is defined in both.
+func (c *credentials) loadStoredPasswords() error {
+	if c.storeLoaded {
+		return nil
+	}
+	stored, err := storePasswords()
+	if err != nil {
+		return fmt.Errorf("could not read your secrets store: %s", err)
+	}
+	merged, err := mergePasswords(c.passwords, stored)
+	if err != nil {
+		return err
+	}
+	c.passwords = merged
+	c.storeLoaded = true
+	return nil
 }
@@ -0,0 +1,368 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// sceneResult stores the outcome of the recording of a single scene.
+type sceneResult struct {
+	scene string
+	err   error
+}
+
+// jobSettings controls how scenes are recorded when each scene is
+// recorded in its own container.
+type jobSettings struct {
+	// How many scenes can be recorded at the same time.
+	jobs int
+	// Whether or not the other scenes should stop when one fails.
+	failFast bool
+	// How many times a failed scene is recorded again.
+	retries int
+	// How long Good Bot can wait for what it expects, unless an
+	// action sets its own timeout. Zero means no timeout.
+	timeout time.Duration
+}
+
+// modTimeSlack accounts for file systems that don't save modification
+// times precisely. A file written right after a recording has started
+// can otherwise look older than the recording.
+const modTimeSlack = time.Second
+
+// retryDelay is the time to wait before the first retry of a scene. The
+// delay doubles after each attempt.
+var retryDelay = 2 * time.Second
+
+// recordScenes records every selected scene of a project in its own
+// container. Up to options.jobs containers are running at the same time. Since
+// every container only has access to its own scene, each run only
+// writes in its own scene directory.
+//
+// The output of each container is printed to stdout, and each line is
+// prefixed by the name of the scene that produced it.
+//
+// A scene that fails is recorded again up to options.retries times.
+// See recordSceneWithRetries for more information.
+//
+// A failure in one scene does not stop the other scenes from being
+// recorded, unless options.failFast is true. In that case, the running
+// containers are killed and the scenes that haven't started yet are
+// skipped.
+//
+// The result of each scene is returned once all the scenes are done,
+// along with an error listing every scene that failed.
+func recordScenes(hostPath string, ttsFile string, envVars []string, settings *languageSettings, scenes []int, options *jobSettings) ([]sceneResult, error) {
+	selected, err := selectScenes(hostPath, scenes)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := options.jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+
+	if !imageExists("trickytroll/good-bot:latest", ctx, cli) {
+		reader, err := cli.ImagePull(ctx, "trickytroll/good-bot:latest", types.ImagePullOptions{})
+		if err != nil {
+			return nil, err
+		}
+		io.Copy(os.Stdout, reader)
+	}
+
+	// Shared by every prefixWriter so that lines don't get mixed up.
+	var outputLock sync.Mutex
+	toRecord := make(chan int)
+	results := make([]sceneResult, len(selected))
+
+	var workers sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for index := range toRecord {
+				scene := selected[index]
+				if ctx.Err() != nil {
+					results[index] = sceneResult{scene, fmt.Errorf("skipped after another scene failed")}
+					continue
+				}
+				out := newPrefixWriter(os.Stdout, fmt.Sprintf("[%s] ", scene), &outputLock)
+				err := recordSceneWithRetries(ctx, cli, hostPath, ttsFile, envVars, settings, scene, options, out)
+				out.Flush()
+				results[index] = sceneResult{scene, err}
+				if err != nil && options.failFast {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for index := range selected {
+		toRecord <- index
+	}
+	close(toRecord)
+	workers.Wait()
+
+	return results, summarizeScenes(results)
+}
+
+// recordSceneWithRetries records a scene, and records it again if it
+// fails. A scene fails if its container exits with a non-zero status, or
+// if one of its asciicasts is missing or truncated after the recording.
+// See checkSceneCasts for more information.
+//
+// The scene is recorded at most options.retries + 1 times. The delay
+// between two attempts starts at retryDelay and doubles after each
+// attempt.
+//
+// The output of each attempt is also written in the scene's "logs"
+// directory, as record_N.log where N is the attempt number. The error of
+// the last attempt is returned.
+func recordSceneWithRetries(ctx context.Context, cli *client.Client, hostPath string, ttsFile string, envVars []string, settings *languageSettings, scene string, options *jobSettings, out io.Writer) error {
+	scenePath := filepath.Join(hostPath, scene)
+	logsPath := filepath.Join(scenePath, "logs")
+	if err := os.MkdirAll(logsPath, 0777); err != nil {
+		return err
+	}
+
+	delay := retryDelay
+	var err error
+	for attempt := 1; attempt <= options.retries+1; attempt++ {
+		if attempt > 1 {
+			fmt.Fprintf(out, "Attempt %d failed: %s\nRetrying in %s.\n", attempt-1, err, delay)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		logFile, createErr := os.Create(filepath.Join(logsPath, fmt.Sprintf("record_%d.log", attempt)))
+		if createErr != nil {
+			return createErr
+		}
+
+		started := time.Now().Add(-modTimeSlack)
+		err = recordScene(ctx, cli, hostPath, ttsFile, envVars, settings, scene, options.timeout, io.MultiWriter(out, logFile))
+		if err == nil {
+			err = checkSceneCasts(scenePath, started)
+		}
+		if err != nil {
+			fmt.Fprintf(logFile, "\nAttempt %d failed: %s\n", attempt, err)
+		}
+		logFile.Close()
+
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// checkSceneCasts makes sure that every command file of a scene has been
+// recorded in a valid asciicast. An error is returned if one of the
+// asciicasts is missing, was not written since the provided time, or is
+// truncated.
+func checkSceneCasts(scenePath string, since time.Time) error {
+	commands, err := listFiles(filepath.Join(scenePath, "commands"))
+	if err != nil {
+		return err
+	}
+
+	for _, command := range commands {
+		castPath := filepath.Join(scenePath, recordingsPath, command+".cast")
+		info, err := os.Stat(castPath)
+		if err != nil {
+			return fmt.Errorf("asciicast %s is missing", castPath)
+		}
+		if info.ModTime().Before(since) {
+			return fmt.Errorf("asciicast %s was not recorded again", castPath)
+		}
+		if err := validateAsciicast(castPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordScene records a single scene of a project in its own container.
+// The container's output is copied to out.
+//
+// An error is returned if the container could not be created or if it
+// exits with a non-zero status. If ctx is cancelled before the recording
+// is done, the container is killed and ctx's error is returned.
+//
+// The recording is also watched for timeouts, using timeout as the
+// default timeout of the scene's actions. See watchRecording for more
+// information. If the recording times out, the container is killed and
+// a recordTimeoutError is returned.
+func recordScene(ctx context.Context, cli *client.Client, hostPath string, ttsFile string, envVars []string, settings *languageSettings, scene string, timeout time.Duration, out io.Writer) error {
+	number, err := sceneNumber(scene)
+	if err != nil {
+		return err
+	}
+
+	containerID, err := createRecordContainer(ctx, cli, hostPath, ttsFile, envVars, settings, []int{number})
+	if err != nil {
+		return err
+	}
+	// Using a new context since ctx might be cancelled by then.
+	defer cli.ContainerRemove(context.Background(), containerID, types.ContainerRemoveOptions{Force: true})
+
+	waiter, err := cli.ContainerAttach(ctx, containerID, types.ContainerAttachOptions{
+		Stderr: true,
+		Stdout: true,
+		Stream: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer waiter.Close()
+
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(out, waiter.Reader)
+		close(copied)
+	}()
+
+	if err := cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
+		return err
+	}
+
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	timedOut := watchRecording(watchCtx, []string{filepath.Join(hostPath, scene)}, timeout)
+
+	statusCh, errCh := cli.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case err := <-timedOut:
+		cli.ContainerKill(context.Background(), containerID, "KILL")
+		return err
+	case err := <-errCh:
+		if ctx.Err() != nil {
+			cli.ContainerKill(context.Background(), containerID, "KILL")
+			return ctx.Err()
+		}
+		return err
+	case status := <-statusCh:
+		<-copied
+		if status.Error != nil {
+			return fmt.Errorf("%s", status.Error.Message)
+		}
+		if status.StatusCode != 0 {
+			return fmt.Errorf("container exited with status %d", status.StatusCode)
+		}
+	}
+
+	return nil
+}
+
+// summarizeScenes prints how many scenes were recorded and which ones
+// failed. If at least one scene failed, an error that lists the failed
+// scenes is returned.
+func summarizeScenes(results []sceneResult) error {
+	var failed []string
+	for _, result := range results {
+		if result.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", result.scene, result.err))
+		}
+	}
+
+	fmt.Printf("Recorded %d of %d scene(s).\n", len(results)-len(failed), len(results))
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d scene(s) could not be recorded:\n%s", len(failed), strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+// prefixWriter adds a prefix at the start of each line written to out.
+// Lines are only written once they are complete, and the lock is shared
+// between writers to make sure that lines from different writers are
+// never mixed together.
+type prefixWriter struct {
+	out    io.Writer
+	prefix string
+	lock   *sync.Mutex
+	buffer bytes.Buffer
+}
+
+// newPrefixWriter creates a prefixWriter that writes to out.
+func newPrefixWriter(out io.Writer, prefix string, lock *sync.Mutex) *prefixWriter {
+	return &prefixWriter{out: out, prefix: prefix, lock: lock}
+}
+
+// Write buffers p and writes every complete line to the underlying
+// writer, each one starting with the writer's prefix.
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buffer.Write(p)
+
+	for {
+		line := w.buffer.Bytes()
+		end := bytes.IndexByte(line, '\n')
+		if end < 0 {
+			break
+		}
+		if err := w.writeLine(line[:end+1]); err != nil {
+			return 0, err
+		}
+		w.buffer.Next(end + 1)
+	}
+	return len(p), nil
+}
+
+// Flush writes what's left in the buffer, even if the line is not
+// complete. A newline is added at the end of the line.
+func (w *prefixWriter) Flush() error {
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	line := append(w.buffer.Bytes(), '\n')
+	w.buffer.Reset()
+	return w.writeLine(line)
+}
+
+// writeLine writes a single line, with the prefix, to the underlying
+// writer.
+func (w *prefixWriter) writeLine(line []byte) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, err := fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+	return err
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPrefixWriter writes partial and complete lines to a prefixWriter
+// and checks that each line is prefixed once.
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var lock sync.Mutex
+	writer := newPrefixWriter(&out, "[scene_1] ", &lock)
+
+	writer.Write([]byte("hello "))
+	writer.Write([]byte("world\nsecond"))
+	writer.Write([]byte(" line\nlast"))
+	writer.Flush()
+
+	want := "[scene_1] hello world\n[scene_1] second line\n[scene_1] last\n"
+	if out.String() != want {
+		t.Errorf("prefixWriter wrote %q, want %q", out.String(), want)
+	}
+}
+
+// TestSummarizeScenes makes sure that summarizeScenes only returns an
+// error when at least one of the scenes failed.
+func TestSummarizeScenes(t *testing.T) {
+	succeeded := []sceneResult{{"scene_1", nil}, {"scene_2", nil}}
+	if err := summarizeScenes(succeeded); err != nil {
+		t.Errorf("summarizeScenes returned error %s when every scene succeeded", err)
+	}
+
+	failed := []sceneResult{{"scene_1", nil}, {"scene_2", errors.New("container exited with status 1")}}
+	if err := summarizeScenes(failed); err == nil {
+		t.Errorf("summarizeScenes did not return an error when scene_2 failed")
+	}
+}
+
+// TestCheckSceneCasts checks a scene that has been recorded. The check
+// should fail if the asciicasts are older than the recording.
+func TestCheckSceneCasts(t *testing.T) {
+	scenePath := filepath.Join(testData.testProject1, "scene_1")
+
+	if err := checkSceneCasts(scenePath, time.Time{}); err != nil {
+		t.Errorf("checkSceneCasts(%s) returned error:\n%s", scenePath, err)
+	}
+
+	if err := checkSceneCasts(scenePath, time.Now().Add(time.Hour)); err == nil {
+		t.Errorf("checkSceneCasts(%s) should fail on asciicasts older than the recording", scenePath)
+	}
+
+	notRecorded := filepath.Join(testData.noAudio, "scene_1")
+	if err := checkSceneCasts(notRecorded, time.Time{}); err == nil {
+		t.Errorf("checkSceneCasts(%s) should fail on a scene without asciicasts", notRecorded)
+	}
+}
@@ -1,6 +1,10 @@
 package cmd
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -24,3 +28,174 @@ func TestIsDirectoryOnFile(t *testing.T) {
 	}
 
 }
+
+// TestParseSceneSelection checks the scenes returned by
+// parseSceneSelection for lists, ranges and invalid selections.
+func TestParseSceneSelection(t *testing.T) {
+	var testCases = []struct {
+		input   string
+		want    []int
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"3", []int{3}, false},
+		{"2,5-7", []int{2, 5, 6, 7}, false},
+		{"7-5", nil, true},
+		{"4, 1-2, 2", []int{1, 2, 4}, false},
+		{"0", nil, true},
+		{"foo", nil, true},
+	}
+	for _, test := range testCases {
+		got, err := parseSceneSelection(test.input)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseSceneSelection(%s) returned error %v, want error: %t", test.input, err, test.wantErr)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("parseSceneSelection(%s) = %v, want %v", test.input, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("parseSceneSelection(%s) = %v, want %v", test.input, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+// TestGetProjectMountsSelection makes sure that only the selected
+// scenes of a project are mounted, along with the other items of the
+// project.
+func TestGetProjectMountsSelection(t *testing.T) {
+	mounts, err := getProjectMounts(testData.testProject1, "/project/project_1", []int{2, 4})
+	if err != nil {
+		t.Fatalf("getProjectMounts(%s) returned error:\n%s", testData.testProject1, err)
+	}
+
+	mounted := make(map[string]bool)
+	for _, item := range mounts {
+		mounted[filepath.Base(item.Target)] = true
+	}
+
+	for _, want := range []string{"scene_2", "scene_4", "instructions.txt", "croptests"} {
+		if !mounted[want] {
+			t.Errorf("getProjectMounts(%s) did not mount %s", testData.testProject1, want)
+		}
+	}
+	for _, notWant := range []string{"scene_1", "scene_3"} {
+		if mounted[notWant] {
+			t.Errorf("getProjectMounts(%s) mounted %s, which was not selected", testData.testProject1, notWant)
+		}
+	}
+}
+
+// writePasswords writes a passwords file in the temporary test directory
+// and returns its path.
+func writePasswords(t *testing.T, contents string) string {
+	file, err := ioutil.TempFile(testData.dir, "passwords")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+// TestParsePasswords parses a passwords file that contains comments,
+// blank lines, export prefixes and quoted values.
+func TestParsePasswords(t *testing.T) {
+	passwordsPath := writePasswords(t, `# Passwords for the demo
+
+SSH_TRICKY=hunter2
+export DB_PASSWORD = "multi\nline \"quoted\"" # a comment
+API_TOKEN='single # not a comment'
+PLAIN=value # a comment
+EMPTY=
+`)
+	defer os.Remove(passwordsPath)
+
+	got, err := parsePasswords(passwordsPath)
+	if err != nil {
+		t.Fatalf("parsePasswords(%s) returned error:\n%s", passwordsPath, err)
+	}
+
+	want := []string{
+		"SSH_TRICKY=hunter2",
+		"DB_PASSWORD=multi\nline \"quoted\"",
+		"API_TOKEN=single # not a comment",
+		"PLAIN=value",
+		"EMPTY=",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parsePasswords(%s) = %q, want %q", passwordsPath, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parsePasswords(%s)[%d] = %q, want %q", passwordsPath, i, got[i], want[i])
+		}
+	}
+}
+
+// TestParsePasswordsErrors makes sure that invalid passwords files
+// return an error that contains the faulty line number.
+func TestParsePasswordsErrors(t *testing.T) {
+	var testCases = []struct {
+		contents string
+		line     string
+	}{
+		{"FIRST=1\nFIRST=2\n", "line 2"},
+		{"# comment\nnot a variable\n", "line 2"},
+		{"1NAME=value\n", "line 1"},
+		{"NAME=\"unterminated\n", "line 1"},
+		{"NAME='value' trailing\n", "line 1"},
+	}
+	for _, test := range testCases {
+		passwordsPath := writePasswords(t, test.contents)
+		_, err := parsePasswords(passwordsPath)
+		os.Remove(passwordsPath)
+		if err == nil {
+			t.Errorf("parsePasswords on %q should return an error", test.contents)
+		} else if !strings.Contains(err.Error(), test.line) {
+			t.Errorf("parsePasswords on %q returned %q, want an error on %s", test.contents, err, test.line)
+		}
+	}
+}
+
+// TestCheckPasswordReferences uses a scene that needs the SSH_TRICKY
+// password. The check should only pass if the password is defined.
+func TestCheckPasswordReferences(t *testing.T) {
+	scenePath := writeTestScene(t, "commands:\n- ssh tricky@server\n- password: SSH_TRICKY\nexpect:\n- assword\n- prompt\n")
+	defer os.RemoveAll(scenePath)
+	projectPath, scene := filepath.Dir(scenePath), filepath.Base(scenePath)
+
+	if err := checkPasswordReferences(projectPath, []string{scene}, []string{"SSH_TRICKY=hunter2"}); err != nil {
+		t.Errorf("checkPasswordReferences returned error:\n%s", err)
+	}
+
+	err := checkPasswordReferences(projectPath, []string{scene}, []string{"OTHER=hunter2"})
+	if err == nil || !strings.Contains(err.Error(), "SSH_TRICKY") {
+		t.Errorf("checkPasswordReferences returned %v, want an error about SSH_TRICKY", err)
+	}
+}
+
+// TestReferencesPasswords finds the scenes that use a password, which
+// are the only ones that need the secrets store.
+func TestReferencesPasswords(t *testing.T) {
+	withPassword := writeTestScene(t, "commands:\n- ssh tricky@server\n- password: SSH_TRICKY\nexpect:\n- assword\n- prompt\n")
+	defer os.RemoveAll(withPassword)
+	without := writeTestScene(t, "commands:\n- ls\nexpect:\n- prompt\n")
+	defer os.RemoveAll(without)
+	projectPath := filepath.Dir(withPassword)
+
+	uses, err := referencesPasswords(projectPath, []string{filepath.Base(without)})
+	if err != nil || uses {
+		t.Errorf("referencesPasswords on a scene without passwords = %v, %v", uses, err)
+	}
+	uses, err = referencesPasswords(projectPath, []string{filepath.Base(without), filepath.Base(withPassword)})
+	if err != nil || !uses {
+		t.Errorf("referencesPasswords on a scene with a password = %v, %v", uses, err)
+	}
+}
@@ -0,0 +1,393 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// redactCmd represents the redact command
+var redactCmd = &cobra.Command{
+	Use:   "redact [path to project or asciicast]",
+	Short: "Hides secrets from recorded asciicasts.",
+	Long: `Redact replaces secrets printed in asciicasts with a mask.
+
+Every value from your passwords file is redacted, along with
+everything that matches one of the provided patterns. Patterns
+are regular expressions, and can be used to hide tokens or IP
+addresses. For example:
+
+good-bot-cli redact my-project -p 'ghp_[A-Za-z0-9]+' -p '\d+\.\d+\.\d+\.\d+'
+
+The argument can be a project directory, in which case every
+asciicast and recording log of the project is redacted, or a
+single asciicast.
+Gifs and videos need to be rendered again afterwards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		processedPath, err := processPath(args[0])
+		if err != nil {
+			log.Fatalf("Got error trying to process the agrument '%s'. Error was:\n%s", args[0], err)
+		}
+
+		// Passwords are only redacted if a configuration file exists.
+		var rules []redaction
+		if err := viper.ReadInConfig(); err == nil {
+			creds := copyCredentials()
+			if err := creds.loadStoredPasswords(); err != nil {
+				log.Fatal(err)
+			}
+			rules = passwordRedactions(creds.passwords)
+		}
+		for _, pattern := range redactPatterns {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				log.Fatalf("Could not use the pattern '%s'. Error was:\n%s", pattern, err)
+			}
+			rules = append(rules, redaction{"pattern " + pattern, compiled})
+		}
+		if len(rules) == 0 {
+			log.Fatal("Nothing to redact. Please provide a pattern or configure a passwords file.")
+		}
+
+		isDir, err := isDirectory(processedPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var report []castRedactions
+		if isDir {
+			report, err = redactCasts(getRecsPaths(processedPath), rules, redactMask)
+			if err == nil {
+				var logsReport []castRedactions
+				logsReport, err = redactLogs(getLogsPaths(processedPath), rules, redactMask)
+				report = append(report, logsReport...)
+			}
+		} else {
+			report, err = redactCasts([]string{processedPath}, rules, redactMask)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		printRedactionReport(report)
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("requires at least one argument")
+		} else if len(args) > 1 {
+			return errors.New("requires at most one argument")
+		} else if !validatePath(args[0]) {
+			return errors.New("not a valid path")
+		} else {
+			return nil
+		}
+	},
+}
+
+var (
+	redactPatterns []string
+	redactMask     string
+)
+
+// defaultMask replaces secrets when no other mask is provided.
+const defaultMask string = "********"
+
+func init() {
+	rootCmd.AddCommand(redactCmd)
+
+	redactCmd.Flags().StringArrayVarP(&redactPatterns, "pattern", "p", nil, `A regular expression that matches what should be redacted.
+Can be used more than once.`)
+	redactCmd.Flags().StringVar(&redactMask, "mask", defaultMask, "What secrets are replaced with.")
+}
+
+// redaction is something that should be hidden from asciicasts. The
+// label is used in reports, so it should never contain the secret.
+type redaction struct {
+	label   string
+	pattern *regexp.Regexp
+}
+
+// castRedactions stores how many times each redaction was applied to
+// an asciicast.
+type castRedactions struct {
+	castPath string
+	counts   map[string]int
+}
+
+// minPasswordLength is the length, in characters, under which passwords
+// are not redacted. Short values such as "1" or "yes" are printed all
+// the time, so redacting them would hide unrelated output and hint at
+// the password.
+const minPasswordLength = 4
+
+// passwordRedactions creates a redaction for each password. Passwords
+// are provided as "NAME=value" strings, like the ones returned by
+// parsePasswords. Passwords with an empty value are ignored, and a
+// warning is printed for passwords shorter than minPasswordLength, which
+// are not redacted.
+func passwordRedactions(passwords []string) []redaction {
+	var rules []redaction
+	for _, password := range passwords {
+		parts := strings.SplitN(password, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			continue
+		}
+		if utf8.RuneCountInString(parts[1]) < minPasswordLength {
+			log.Printf("Password %s is shorter than %d characters, so it is not redacted.", parts[0], minPasswordLength)
+			continue
+		}
+		rules = append(rules, redaction{"password " + parts[0], regexp.MustCompile(regexp.QuoteMeta(parts[1]))})
+	}
+	return rules
+}
+
+// redactProject redacts the passwords from every asciicast and
+// recording log of the provided scenes, or of every scene if scenes is
+// empty. A report is printed if something was redacted.
+func redactProject(projectPath string, scenes []int, passwords []string) error {
+	rules := passwordRedactions(passwords)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	report, err := redactCasts(filterRecsPaths(getRecsPaths(projectPath), scenes), rules, defaultMask)
+	if err != nil {
+		return err
+	}
+	logsReport, err := redactLogs(filterRecsPaths(getLogsPaths(projectPath), scenes), rules, defaultMask)
+	report = append(report, logsReport...)
+	if err != nil {
+		return err
+	}
+	if len(report) > 0 {
+		printRedactionReport(report)
+	}
+	return nil
+}
+
+// redactCasts uses redactCast on each asciicast. The copies kept next to
+// an asciicast by cropRec and editRec are redacted too, since they can
+// become the asciicast again. Only the asciicasts in which something was
+// redacted are part of the returned report.
+func redactCasts(castPaths []string, rules []redaction, mask string) ([]castRedactions, error) {
+	var report []castRedactions
+	for _, castPath := range castPaths {
+		for _, path := range []string{castPath, castPath + uncroppedExtension, castPath + backupExtension} {
+			if path != castPath && !validatePath(path) {
+				continue
+			}
+			counts, err := redactCast(path, rules, mask)
+			if err != nil {
+				return report, fmt.Errorf("could not redact %s: %s", path, err)
+			}
+			if len(counts) > 0 {
+				report = append(report, castRedactions{path, counts})
+			}
+		}
+	}
+	return report, nil
+}
+
+// getLogsPaths finds the files written in the "logs" directory of each
+// scene while recording. These are the output of each recording attempt,
+// saved as record_N.log, and the partial asciicasts kept by
+// keepPartialCast.
+func getLogsPaths(projectPath string) []string {
+	var logsPaths []string
+	for _, pattern := range []string{"*.log", "*.cast"} {
+		matches, err := filepath.Glob(filepath.Join(projectPath, "scene_*", "logs", pattern))
+		if err != nil {
+			log.Panic(err)
+		}
+		logsPaths = append(logsPaths, matches...)
+	}
+	sort.Strings(logsPaths)
+	return logsPaths
+}
+
+// redactLogs redacts the files found by getLogsPaths. Partial asciicasts
+// are redacted with redactCast, and other logs with redactLog. Only the
+// files in which something was redacted are part of the returned report.
+func redactLogs(logsPaths []string, rules []redaction, mask string) ([]castRedactions, error) {
+	var report []castRedactions
+	for _, logPath := range logsPaths {
+		var counts map[string]int
+		var err error
+		if filepath.Ext(logPath) == ".cast" {
+			counts, err = redactCast(logPath, rules, mask)
+		} else {
+			counts, err = redactLog(logPath, rules, mask)
+		}
+		if err != nil {
+			return report, fmt.Errorf("could not redact %s: %s", logPath, err)
+		}
+		if len(counts) > 0 {
+			report = append(report, castRedactions{logPath, counts})
+		}
+	}
+	return report, nil
+}
+
+// redactLog replaces everything that matches one of the redactions in a
+// text file with the mask. The file is only written again if something
+// was redacted. The number of matches for each redaction's label is
+// returned.
+func redactLog(logPath string, rules []redaction, mask string) (map[string]int, error) {
+	contents, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	text := []string{string(contents)}
+	for _, rule := range rules {
+		var matches int
+		text, matches = redactStream(text, rule.pattern, mask)
+		if matches > 0 {
+			counts[rule.label] += matches
+		}
+	}
+
+	if len(counts) == 0 {
+		return counts, nil
+	}
+	return counts, ioutil.WriteFile(logPath, []byte(text[0]), 0644)
+}
+
+// redactCast replaces everything that matches one of the redactions in
+// an asciicast's events with the mask. Output and input events are
+// searched separately. Since a secret can be split between many events,
+// each type of event is joined before being searched. The mask is put in
+// the event where the secret starts, and the rest of the secret is
+// removed from the following events.
+//
+// Event times and unknown fields are kept as they were. The asciicast
+// is only written again if something was redacted. The number of
+// matches for each redaction's label is returned.
+func redactCast(castPath string, rules []redaction, mask string) (map[string]int, error) {
+	cast, err := asciicast.ReadFile(castPath)
+	if err != nil {
+		return nil, err
+	}
+
+	byType := make(map[asciicast.EventType][]int)
+	for i, event := range cast.Events {
+		if event.Type == asciicast.Output || event.Type == asciicast.Input {
+			byType[event.Type] = append(byType[event.Type], i)
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, indexes := range byType {
+		for _, rule := range rules {
+			data := make([]string, len(indexes))
+			for i, index := range indexes {
+				data[i] = cast.Events[index].Data
+			}
+			redacted, matches := redactStream(data, rule.pattern, mask)
+			if matches == 0 {
+				continue
+			}
+			counts[rule.label] += matches
+			for i, index := range indexes {
+				cast.Events[index].Data = redacted[i]
+			}
+		}
+	}
+
+	if len(counts) == 0 {
+		return counts, nil
+	}
+	return counts, cast.WriteFile(castPath)
+}
+
+// redactStream searches the joined pieces of a stream for a pattern,
+// and replaces each match with the mask. The pieces are returned with
+// the mask in the piece where a match starts, and without the rest of
+// the match. The number of matches is also returned.
+func redactStream(pieces []string, pattern *regexp.Regexp, mask string) ([]string, int) {
+	joined := strings.Join(pieces, "")
+	matches := pattern.FindAllStringIndex(joined, -1)
+	// Empty matches can't be redacted.
+	var kept [][]int
+	for _, match := range matches {
+		if match[1] > match[0] {
+			kept = append(kept, match)
+		}
+	}
+	if len(kept) == 0 {
+		return pieces, 0
+	}
+
+	redacted := make([]string, len(pieces))
+	offset := 0
+	current := 0
+	for i, piece := range pieces {
+		var builder strings.Builder
+		for position := offset; position < offset+len(piece); position++ {
+			for current < len(kept) && position >= kept[current][1] {
+				current++
+			}
+			if current < len(kept) && position >= kept[current][0] {
+				if position == kept[current][0] {
+					builder.WriteString(mask)
+				}
+				continue
+			}
+			builder.WriteByte(joined[position])
+		}
+		redacted[i] = builder.String()
+		offset += len(piece)
+	}
+	return redacted, len(kept)
+}
+
+// printRedactionReport prints what was redacted in each asciicast.
+// Secrets are never printed, only the labels of the redactions.
+func printRedactionReport(report []castRedactions) {
+	if len(report) == 0 {
+		fmt.Println("Nothing was redacted.")
+		return
+	}
+
+	for _, cast := range report {
+		var labels []string
+		for label := range cast.counts {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+
+		name := cast.castPath
+		if scenePath, err := getScenePath(cast.castPath); err == nil {
+			name = filepath.Join(filepath.Base(scenePath), strings.TrimPrefix(cast.castPath, scenePath+string(os.PathSeparator)))
+		}
+		fmt.Printf("Redacted in %s:\n", name)
+		for _, label := range labels {
+			fmt.Printf("  %d x %s\n", cast.counts[label], label)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestRedactStream redacts a secret that is split between many pieces
+// of a stream.
+func TestRedactStream(t *testing.T) {
+	pieces := []string{"my password is hun", "ter", "2, and hunter2 again", "."}
+	redacted, matches := redactStream(pieces, regexp.MustCompile("hunter2"), "***")
+
+	if matches != 2 {
+		t.Errorf("redactStream found %d matches, want 2", matches)
+	}
+	want := []string{"my password is ***", "", ", and *** again", "."}
+	for i := range want {
+		if redacted[i] != want[i] {
+			t.Errorf("redactStream piece %d = %q, want %q", i, redacted[i], want[i])
+		}
+	}
+}
+
+// TestRedactCast redacts a password and a pattern from a copy of an
+// asciicast from the test project. The asciicast types "hello world" one
+// character at a time, so the secret is split between many events.
+func TestRedactCast(t *testing.T) {
+	castPath := filepath.Join(testData.testProject1, "scene_1/asciicasts/commands_1.cast")
+	contents, err := os.ReadFile(castPath)
+	if err != nil {
+		t.Fatalf("Test error: could not read file %s.\n%s", castPath, err)
+	}
+
+	copyPath := filepath.Join(testData.dir, "redacted.cast")
+	if err := ioutil.WriteFile(copyPath, contents, 0644); err != nil {
+		t.Fatalf("Test error: could not write to file.\n%s", err)
+	}
+	defer os.Remove(copyPath)
+
+	rules := passwordRedactions([]string{"SECRET=hello world", "EMPTY="})
+	rules = append(rules, redaction{"pattern ebead[0-9a-f]+", regexp.MustCompile("ebead[0-9a-f]+")})
+
+	counts, err := redactCast(copyPath, rules, "****")
+	if err != nil {
+		t.Fatalf("redactCast(%s) returned error:\n%s", copyPath, err)
+	}
+
+	// "hello world" is typed once and printed once by echo.
+	if counts["password SECRET"] != 2 {
+		t.Errorf("redactCast(%s) redacted the password %d times, want 2", copyPath, counts["password SECRET"])
+	}
+	if counts["pattern ebead[0-9a-f]+"] == 0 {
+		t.Errorf("redactCast(%s) did not redact the pattern", copyPath)
+	}
+	if _, ok := counts["password EMPTY"]; ok {
+		t.Errorf("redactCast(%s) should ignore empty passwords", copyPath)
+	}
+
+	output := castOutput(copyPath)
+	if strings.Contains(output, "hello world") || strings.Contains(output, "ebead") {
+		t.Errorf("redactCast(%s) left secrets in the output:\n%s", copyPath, output)
+	}
+	if err := validateAsciicast(copyPath); err != nil {
+		t.Errorf("redactCast(%s) produced an invalid asciicast:\n%s", copyPath, err)
+	}
+}
+
+// TestPasswordRedactionsShort makes sure that short passwords are not
+// redacted, and that a warning names them without their value.
+func TestPasswordRedactionsShort(t *testing.T) {
+	var warnings bytes.Buffer
+	log.SetOutput(&warnings)
+	defer log.SetOutput(os.Stderr)
+
+	rules := passwordRedactions([]string{"PIN=123", "SECRET=hunter2", "ACCENTS=été!"})
+	var labels []string
+	for _, rule := range rules {
+		labels = append(labels, rule.label)
+	}
+	if want := []string{"password SECRET", "password ACCENTS"}; strings.Join(labels, ",") != strings.Join(want, ",") {
+		t.Errorf("passwordRedactions created %v, want %v", labels, want)
+	}
+	if !strings.Contains(warnings.String(), "PIN") || strings.Contains(warnings.String(), "123") {
+		t.Errorf("passwordRedactions warned %q, want a warning about PIN without its value", warnings.String())
+	}
+}
+
+// TestRedactCroppedCast redacts an asciicast that was cropped, and crops
+// it again at another size. The secret should not come back from the
+// uncropped copy.
+func TestRedactCroppedCast(t *testing.T) {
+	castPath := filepath.Join(t.TempDir(), "commands_1.cast")
+	cast := "{\"version\": 2, \"width\": 100, \"height\": 5}\n[0.5, \"o\", \"$ echo hunter2\\r\\nhunter2\\r\\n\"]\n"
+	if err := ioutil.WriteFile(castPath, []byte(cast), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cropRec(castPath, 40, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := passwordRedactions([]string{"SECRET=hunter2"})
+	if _, err := redactCasts([]string{castPath}, rules, "****"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cropRec(castPath, 60, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{castPath, castPath + uncroppedExtension} {
+		if output := castOutput(path); strings.Contains(output, "hunter2") || !strings.Contains(output, "****") {
+			t.Errorf("%s was not redacted:\n%s", path, output)
+		}
+	}
+}
+
+// TestRedactProjectLogs makes sure that passwords are also redacted from
+// the recording logs and the partial asciicasts of a scene.
+func TestRedactProjectLogs(t *testing.T) {
+	projectPath := copyTestScene(t)
+	logsPath := filepath.Join(projectPath, "scene_1", "logs")
+	if err := os.MkdirAll(logsPath, 0777); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(logsPath, "record_1.log")
+	if err := ioutil.WriteFile(logPath, []byte("$ echo hunter2\nhunter2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	partialPath := filepath.Join(logsPath, "commands_1.partial.cast")
+	partial := "{\"version\": 2, \"width\": 80, \"height\": 24}\n[0.5, \"o\", \"hunter2\\r\\n\"]\n"
+	if err := ioutil.WriteFile(partialPath, []byte(partial), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := redactProject(projectPath, nil, []string{"SECRET=hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "$ echo " + defaultMask + "\n" + defaultMask + "\n"; string(contents) != want {
+		t.Errorf("record_1.log = %q, want %q", contents, want)
+	}
+	if output := castOutput(partialPath); strings.Contains(output, "hunter2") {
+		t.Errorf("the partial asciicast was not redacted:\n%s", output)
+	}
+}
@@ -18,16 +18,19 @@ package cmd
 import (
 	"bufio"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/TrickyTroll/good-bot-cli/render"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
@@ -47,16 +50,42 @@ The --no-render flag can be used to speed up the recording
 process. Once you are happy with the result, the video can be
 rendered afterwards using this command.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if err := checkRenderer(); err != nil {
+			log.Fatal(err)
+		}
+		if err := checkLengthFix(); err != nil {
+			log.Fatal(err)
+		}
+		if err := checkVideoEngine(); err != nil {
+			log.Fatal(err)
+		}
 		setConfigInteraction()
-		dockerCheck()
+		// Only gifs need Docker, to be rendered by Asciicast2gif or to
+		// make the final video with the container engine.
+		if (rendersGifs() && renderer == dockerRenderer) || (makesFinalVideo() && videoEngine == containerEngine) {
+			dockerCheck()
+		}
 		processedPath, err := processPath(args[0])
 		if err != nil {
 			log.Fatalf("Got error trying to process the agrument '%s'. Error was:\n%s", args[0], err)
 		}
+		scenes, err := parseSceneSelection(sceneSelection)
+		if err != nil {
+			log.Fatalf("Could not use the scenes '%s'. Error was:\n%s", sceneSelection, err)
+		}
 		// First argument should be the project path.
-		renderAllRecordings(processedPath)
-		if !gifsOnly {
-			renderVideo(processedPath)
+		// Narrations are only added to the mp4 files.
+		if makesFinalVideo() || hasFormat(mp4Format) {
+			if err := checkLengths(processedPath, scenes); err != nil {
+				log.Printf("Could not compare the length of the narrations and asciicasts.\n%s", err)
+			}
+		}
+		if err := renderAllRecordings(processedPath, scenes); err != nil {
+			log.Fatal(err)
+		}
+		// Videos are made from the gifs.
+		if makesFinalVideo() {
+			makeVideo(processedPath)
 		}
 	},
 	Args: func(cmd *cobra.Command, args []string) error {
@@ -86,93 +115,218 @@ func init() {
 
 	// gifsOnly is defined in record.go
 	renderCmd.Flags().BoolVar(&gifsOnly, "gifs-only", false, "Only produce gifs. No mp4 files will be created.")
+	// sceneSelection is defined in record.go
+	renderCmd.Flags().StringVar(&sceneSelection, "scenes", "", `Only render the provided scenes, e.g. "2,5-7". Every scene is
+rendered by default.`)
+	// idleLimit is defined in record.go
+	renderCmd.Flags().DurationVar(&idleLimit, "idle-limit", 0, `Shorten the pauses of the recordings that are longer than
+this, e.g. "2s". Pauses are kept as they are by default.`)
+	// renderFormats is also set by --format, which only accepted a
+	// single format.
+	renderCmd.Flags().StringSliceVar(&renderFormats, "formats", []string{gifFormat}, formatsHelp)
+	renderCmd.Flags().StringSliceVar(&renderFormats, "format", []string{gifFormat}, formatsHelp)
+	renderCmd.Flags().MarkDeprecated("format", "use --formats instead")
+	// recordJobs is defined in record.go
+	renderCmd.Flags().IntVarP(&recordJobs, "jobs", "j", 1, "How many asciicasts can be rendered at the same time.")
+	// forceRender is defined in record.go
+	renderCmd.Flags().BoolVar(&forceRender, "force", false, `Render every asciicast and video, even the ones that are up
+to date.`)
+	// renderer and renderScale are defined in record.go
+	renderCmd.Flags().StringVar(&renderer, "renderer", dockerRenderer, `How gifs are rendered. "asciicast2gif" uses Asciicast2gif's
+Docker image, and "native" renders them without Docker.`)
+	renderCmd.Flags().IntVar(&renderScale, "scale", 1, `How much bigger the gifs of the native renderer are. A scale
+of 1 uses 7x13 pixels per character.`)
+	// muxSubtitles is defined in record.go
+	renderCmd.Flags().BoolVar(&muxSubtitles, "subtitles", false, `Add the subtitles of the narration to the final video.
+They are always written in the final directory.`)
+	// fixLengths is defined in record.go
+	renderCmd.Flags().StringVar(&fixLengths, "fix-lengths", "", `Make the asciicasts whose narration is longer as long as
+their narration. "pad" adds a pause at their end, and "slow"
+slows down their typing first. They are only reported by
+default.`)
+	// videoEngine, videoCodec, videoCRF, videoFPS, videoResolution and
+	// normalizeAudio are defined in record.go
+	renderCmd.Flags().StringVar(&videoEngine, "video-engine", containerEngine, `How the final video is made from the gifs. "container" uses
+Good Bot's Docker image, and "ffmpeg" uses a local FFmpeg.`)
+	renderCmd.Flags().StringVar(&videoCodec, "codec", "libx264", "Which video codec the ffmpeg video engine and the mp4 format use.")
+	renderCmd.Flags().IntVar(&videoCRF, "crf", 23, `The quality of the videos made with FFmpeg, from 0 to 51. Lower
+values look better, but make bigger files.`)
+	renderCmd.Flags().IntVar(&videoFPS, "fps", 25, "How many frames per second the videos made with FFmpeg have.")
+	renderCmd.Flags().StringVar(&videoResolution, "resolution", "1280x720", `The size of the videos of the ffmpeg video engine and the mp4
+format. The gifs are scaled to fit it.`)
+	renderCmd.Flags().BoolVar(&normalizeAudio, "normalize", false, "Normalize the loudness of the narration.")
 }
 
 const recordingsPath string = "/asciicasts/"
 const renderPath string = "/gifs/"
+const svgPath string = "/svg/"
+const apngPath string = "/apng/"
+const webmPath string = "/webm/"
+const mp4Path string = "/mp4/"
+
+// Formats that can be selected with --formats. Every format but mp4 is
+// rendered for each asciicast. The mp4 format makes a video of each
+// scene, from its gifs.
+const (
+	gifFormat  = "gif"
+	svgFormat  = "svg"
+	apngFormat = "apng"
+	webmFormat = "webm"
+	mp4Format  = "mp4"
+)
 
-// Settings that should be found in an asciicast v2 file.
-type asciicastEnv struct {
-	Shell string   `json:"SHELL"`
-	Term  string `json:"TERM"`
-}
-type asciicastSettings struct {
-	Version int `json:"version"`
-	Width   int `json:"width"`
-	Height  int `json:"height"`
-	Time    int `json:"timestamp"`
-	Env		*asciicastEnv `json:"env"`
-}
+// renderFormats are the formats of the recordings made by render and
+// record.
+var renderFormats []string
+
+// formatsHelp is the help of the --formats flag.
+const formatsHelp = `Which formats the recordings are converted to, e.g.
+"gif,webm". "gif" also renders the final video. "svg", "apng"
+and "webm" are rendered for each asciicast, and "mp4" makes a
+video of each scene. Each format is written in its own
+directory of each scene.`
+
+// Renderers that can be selected with --renderer. The Docker renderer
+// uses Asciicast2gif's image, and the native one renders gifs in
+// good-bot-cli itself.
+const (
+	dockerRenderer = "asciicast2gif"
+	nativeRenderer = "native"
+)
+
+// nativeMaxFPS is the highest number of frames per second of the gifs
+// made by the native renderer.
+const nativeMaxFPS = 30
+
+// renderAllRecordings renders each Asciinema recording from a project in
+// the formats selected with --formats. It uses getRecsPaths to get an
+// array of paths towards each asciicast. Gifs are rendered with
+// renderRecording, which uses Asciicast2gif's Docker image. This function
+// pulls the image, and provides a client and context to renderRecording.
+//
+// If the native renderer is selected with --renderer, renderRecordingNative
+// is used instead, and Docker is not needed. The other formats do not
+// need Docker either. Gifs are only rendered when the gif or mp4 format
+// is selected.
+//
+// Up to --jobs asciicasts are rendered at the same time. See renderCasts
+// for more information. The videos of the mp4 format are then rendered
+// for each scene.
+//
+// If scenes is not empty, only the recordings from the scenes with those
+// numbers are rendered. An error listing every asciicast that could not
+// be rendered is returned.
+func renderAllRecordings(projectPath string, scenes []int) error {
+	toRecord := filterRecsPaths(getRecsPaths(projectPath), scenes)
 
-// renderAllRecordings uses renderRecording on each Asciinema recording from
-// a project. It uses getRecsPaths to get an array of paths towards each
-// asciicast. This function also pulls Asciicast2gif's Docker image, and
-// provides a client and context  to renderRecording.
-func renderAllRecordings(projectPath string) {
 	// Spawning it only once
 	// Normal context with no timeout.
 	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil { // cli fails nothing else will work. Should panic.
-		panic(err)
+	var cli *client.Client
+	if rendersGifs() && renderer == dockerRenderer {
+		var err error
+		cli, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			return err
+		}
+		if !imageExists("asciinema/asciicast2gif", ctx, cli) {
+			reader, err := cli.ImagePull(ctx, "asciinema/asciicast2gif", types.ImagePullOptions{})
+			if err != nil {
+				return err
+			}
+			io.Copy(os.Stdout, reader) // Print container info to stdout.
+		}
 	}
 
-	if !imageExists("asciinema/asciicast2gif", ctx, cli) {
-		reader, err := cli.ImagePull(ctx, "asciinema/asciicast2gif", types.ImagePullOptions{})
-		if err != nil { // If no reader the rest of the program won't work.
-			panic(err)
+	results := renderCasts(toRecord, recordJobs, os.Stdout, func(asciicastPath string, out io.Writer) ([]string, error) {
+		return renderCastFormats(asciicastPath, cli, ctx, out)
+	})
+	err := summarizeRenders(results)
+	if hasFormat(mp4Format) {
+		renderSceneVideos(projectPath, scenes)
+	}
+	return err
+}
+
+// renderCastFormats renders an asciicast in each format selected with
+// --formats, one after the other, starting with its gif. The output of
+// Asciicast2gif is written to out.
+//
+// Renders that are up to date are kept, unless --force is used. See
+// isUpToDate for more information. The settings of each new render are
+// saved next to it, and its path is returned. The other formats are not
+// rendered once one of them fails.
+func renderCastFormats(asciicastPath string, cli *client.Client, ctx context.Context, out io.Writer) ([]string, error) {
+	var formats []string
+	if rendersGifs() {
+		formats = append(formats, gifFormat)
+	}
+	for _, format := range renderFormats {
+		if format != gifFormat && format != mp4Format {
+			formats = append(formats, format)
 		}
-		io.Copy(os.Stdout, reader) // Print container info to stdout.
 	}
 
-	toRecord := getRecsPaths(projectPath)
-	for _, item := range toRecord {
-		renderRecording(item, cli, ctx)
+	var rendered []string
+	for _, format := range formats {
+		outputPath, settings, err := renderOutput(asciicastPath, format)
+		if err != nil {
+			return rendered, err
+		}
+		if !forceRender && isUpToDate(asciicastPath, outputPath, settings) {
+			continue
+		}
+
+		switch format {
+		case gifFormat:
+			if renderer == nativeRenderer {
+				outputPath, err = renderRecordingNative(asciicastPath)
+			} else {
+				outputPath, err = renderRecording(asciicastPath, cli, ctx, out)
+			}
+		case svgFormat:
+			outputPath, err = renderRecordingSVG(asciicastPath)
+		case apngFormat:
+			outputPath, err = renderRecordingAPNG(asciicastPath)
+		case webmFormat:
+			outputPath, err = renderRecordingWebM(asciicastPath)
+		}
+		if err != nil {
+			return rendered, err
+		}
+		if err := saveRenderSettings(outputPath, settings); err != nil {
+			return rendered, err
+		}
+		rendered = append(rendered, outputPath)
 	}
+	return rendered, nil
 }
 
 // renderRecording uses Asciicast2gif's Docker image to convert an
 // asciicast to the gif format. This function does not pull the
 // Docker image, so it needs the client and context passed as arguments.
 // Asciicast2gif is used with the "-S1" flag to reduce the gif's
-// resolution.
+// resolution. The output of the container is written to out.
 //
-// This function returns the path towards the rendered recoring. If
-// no render is produced, an empty string is returned.
-func renderRecording(asciicastPath string, cli *client.Client, ctx context.Context) string {
-
-	stat, err := os.Stat(asciicastPath)
-
-	// TODO: Return error instead
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Cropping to 24x80
-	cropRec(asciicastPath)
-
-	fileName := strings.TrimSuffix(stat.Name(), filepath.Ext(stat.Name()))
+// This function returns the path towards the rendered recoring.
+func renderRecording(asciicastPath string, cli *client.Client, ctx context.Context, out io.Writer) (string, error) {
+	fileName := strings.TrimSuffix(filepath.Base(asciicastPath), filepath.Ext(asciicastPath))
 
 	// scenePath is an absolute path
-	scenePath, err := getScenePath(asciicastPath)
-
+	scenePath, err := prepareRecording(asciicastPath)
 	if err != nil {
-		log.Printf("Could not render file: %s\n%s", asciicastPath, err)
-		return ""
+		return "", err
 	}
 
-	outputPath := filepath.Join(".", renderPath, fileName + ".gif")
-	castFromMount := filepath.Join(".", recordingsPath, fileName + ".cast")
+	outputPath := filepath.Join(".", renderPath, fileName+".gif")
+	castFromMount := filepath.Join(".", recordingsPath, fileName+".cast")
 
 	// Making sure that the output directory exists
 	gifsDir := filepath.Join(scenePath, renderPath)
-	if _, err := os.Stat(gifsDir); os.IsNotExist(err) {
-		os.Mkdir(gifsDir, 0777)
+	if err := os.MkdirAll(gifsDir, 0777); err != nil {
+		return "", err
 	}
 
-	// Used later for i/o between container and shell
-	inout := make(chan []byte)
-
 	resp, err := cli.ContainerCreate(ctx, &container.Config{
 		Cmd:   []string{"-S1", castFromMount, outputPath},
 		Image: "asciinema/asciicast2gif",
@@ -181,74 +335,225 @@ func renderRecording(asciicastPath string, cli *client.Client, ctx context.Conte
 			{
 				Type:   mount.TypeBind,
 				Source: scenePath, // scenePath is mounted as /data in the container
-				Target: "/data",           // Specified in asciicast2gif's README.
+				Target: "/data",   // Specified in asciicast2gif's README.
 			},
 		},
 	}, nil, nil, "")
-
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		panic(err)
+		return "", err
 	}
 
-	// Need to attach since the user will be interacting with the container
-	waiter, err := cli.ContainerAttach(ctx, resp.ID, types.ContainerAttachOptions{
-		Stderr: true,
-		Stdout: true,
-		Stdin:  true,
-		Stream: true,
-	})
+	statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+	var status int64
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return "", err
+		}
+	case result := <-statusCh:
+		status = result.StatusCode
+	}
 
-	// Starting a goroutine for copying. Copies container output to stdout.
-	go io.Copy(os.Stdout, waiter.Reader)
-	go io.Copy(os.Stderr, waiter.Reader)
+	logs, err := cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return "", err
+	}
+	stdcopy.StdCopy(out, out, logs)
+	logs.Close()
+
+	if status != 0 {
+		return "", fmt.Errorf("asciicast2gif exited with status %d", status)
+	}
+	return filepath.Join(scenePath, outputPath), nil
+}
 
+// prepareRecording gets an asciicast ready to be rendered. The asciicast
+// is cropped to the project's terminal size, and its pauses are shortened
+// if --idle-limit is used.
+//
+// The path of the asciicast's scene is returned.
+func prepareRecording(asciicastPath string) (string, error) {
+	// scenePath is an absolute path
+	scenePath, err := getScenePath(asciicastPath)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	go func() { // In a goroutine
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() { // Write terminal input to inout channel
-			inout <- []byte(scanner.Text())
+	// Cropping to the project's terminal size.
+	settings, err := loadProjectSettings(filepath.Dir(scenePath))
+	if err != nil {
+		return "", err
+	}
+	if err := cropRec(asciicastPath, settings.Terminal.Width, settings.Terminal.Height); err != nil {
+		return "", fmt.Errorf("could not crop %s: %s", asciicastPath, err)
+	}
+	if idleLimit > 0 {
+		if _, err := compressRec(asciicastPath, idleLimit); err != nil {
+			return "", fmt.Errorf("could not compress %s: %s", asciicastPath, err)
 		}
-	}()
+	}
+	return scenePath, nil
+}
 
-	go func(w io.WriteCloser) { // In another goroutine
-		for {
-			data, ok := <-inout // Get terminal input from channel
-			if !ok {
-				fmt.Println("!ok")
-				w.Close()
-				return
-			}
+// renderRecordingNative converts an asciicast to the gif format without
+// Docker. The asciicast is replayed in a virtual terminal, and each
+// screen is drawn with a bundled font. See render.Gif for more
+// information. The gif is written at the same path as the one made by
+// renderRecording, and is scaled with --scale.
+//
+// This function returns the path towards the rendered recording.
+func renderRecordingNative(asciicastPath string) (string, error) {
+	return renderCast(asciicastPath, renderPath, ".gif", func(cast *asciicast.Cast, outputPath string) error {
+		return render.GifFile(cast, outputPath, render.GifOptions{Scale: renderScale, MaxFPS: nativeMaxFPS})
+	})
+}
 
-			w.Write(append(data, '\n')) // Write input to `w`. `w` is a Conn interface.
-			// See https://pkg.go.dev/net#Conn
-		}
-	}(waiter.Conn)
+// renderRecordingSVG converts an asciicast to an animated svg, which is
+// written in the scene's svg directory. See render.SVG for more
+// information.
+//
+// This function returns the path towards the rendered recording.
+func renderRecordingSVG(asciicastPath string) (string, error) {
+	return renderCast(asciicastPath, svgPath, ".svg", func(cast *asciicast.Cast, outputPath string) error {
+		return render.SVGFile(cast, outputPath, render.SVGOptions{MaxFPS: nativeMaxFPS})
+	})
+}
 
-	statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
-	select {
-	case err := <-errCh:
+// renderRecordingAPNG converts an asciicast to an animated png, which is
+// written in the scene's apng directory. See render.APNG for more
+// information.
+//
+// This function returns the path towards the rendered recording.
+func renderRecordingAPNG(asciicastPath string) (string, error) {
+	return renderCast(asciicastPath, apngPath, ".png", func(cast *asciicast.Cast, outputPath string) error {
+		return render.APNGFile(cast, outputPath, render.APNGOptions{Scale: renderScale, MaxFPS: nativeMaxFPS})
+	})
+}
+
+// renderRecordingWebM converts an asciicast to a WebM video, which is
+// written in the scene's webm directory. The asciicast is drawn as an
+// animated png first, which FFmpeg then encodes with the VP9 codec, at
+// the frame rate and quality selected with --fps and --crf.
+//
+// This function returns the path towards the rendered recording.
+func renderRecordingWebM(asciicastPath string) (string, error) {
+	return renderCast(asciicastPath, webmPath, ".webm", func(cast *asciicast.Cast, outputPath string) error {
+		animation, err := ioutil.TempFile(filepath.Dir(outputPath), filepath.Base(outputPath)+".*.png")
 		if err != nil {
-			panic(err)
+			return err
 		}
-	case status := <-statusCh:
-		fmt.Printf("status.StatusCode: %#+v\n", status.StatusCode)
+		animation.Close()
+		defer os.Remove(animation.Name())
+		options := render.APNGOptions{Scale: renderScale, MaxFPS: nativeMaxFPS}
+		if err := render.APNGFile(cast, animation.Name(), options); err != nil {
+			return err
+		}
+		output, err := exec.Command("ffmpeg", webmArgs(animation.Name(), outputPath, videoFPS, videoCRF)...).CombinedOutput()
+		if err != nil {
+			os.Remove(outputPath)
+			return fmt.Errorf("%s\n%s", err, output)
+		}
+		return nil
+	})
+}
+
+// webmArgs returns FFmpeg's arguments to encode an animation as a WebM
+// video. The size of the video is rounded down to even numbers, which
+// is what most players expect.
+func webmArgs(inputPath string, outputPath string, fps int, crf int) []string {
+	return []string{
+		"-y", "-v", "error",
+		"-i", inputPath,
+		"-vf", fmt.Sprintf("fps=%d,scale=trunc(iw/2)*2:trunc(ih/2)*2", fps),
+		"-c:v", "libvpx-vp9",
+		"-crf", strconv.Itoa(crf),
+		"-b:v", "0",
+		"-pix_fmt", "yuv420p",
+		outputPath,
 	}
+}
 
-	out, err := cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true})
+// renderCast prepares an asciicast with prepareRecording, and renders it
+// with the provided function. The render is written in outputDir, a
+// directory of the asciicast's scene, and is named after the asciicast
+// with the provided extension.
+//
+// This function returns the path towards the render.
+func renderCast(asciicastPath string, outputDir string, extension string, write func(*asciicast.Cast, string) error) (string, error) {
+	scenePath, err := prepareRecording(asciicastPath)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	stdcopy.StdCopy(os.Stdout, os.Stderr, out)
+	cast, err := asciicast.ReadFile(asciicastPath)
+	if err != nil {
+		return "", err
+	}
 
-	return filepath.Join(scenePath, outputPath)
+	outputDir = filepath.Join(scenePath, outputDir)
+	if err := os.MkdirAll(outputDir, 0777); err != nil {
+		return "", err
+	}
+	fileName := strings.TrimSuffix(filepath.Base(asciicastPath), filepath.Ext(asciicastPath))
+	outputPath := filepath.Join(outputDir, fileName+extension)
+
+	if err := write(cast, outputPath); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// checkRenderer makes sure that the renderer selected with --renderer
+// and the formats selected with --formats exist. The webm and mp4
+// formats also need FFmpeg.
+func checkRenderer() error {
+	if len(renderFormats) == 0 {
+		return errors.New("at least one format is needed")
+	}
+	for _, format := range renderFormats {
+		switch format {
+		case gifFormat, svgFormat, apngFormat:
+		case webmFormat, mp4Format:
+			if _, err := exec.LookPath("ffmpeg"); err != nil {
+				return fmt.Errorf("FFmpeg could not be found, it is needed by the %s format", format)
+			}
+		default:
+			return fmt.Errorf("unknown format '%s', use '%s', '%s', '%s', '%s' or '%s'", format, gifFormat, svgFormat, apngFormat, webmFormat, mp4Format)
+		}
+	}
+	if renderer != dockerRenderer && renderer != nativeRenderer {
+		return fmt.Errorf("unknown renderer '%s', use '%s' or '%s'", renderer, dockerRenderer, nativeRenderer)
+	}
+	if renderScale < 1 {
+		return errors.New("the scale should be at least 1")
+	}
+	return nil
+}
+
+// hasFormat checks whether or not a format was selected with --formats.
+func hasFormat(format string) bool {
+	for _, selected := range renderFormats {
+		if selected == format {
+			return true
+		}
+	}
+	return false
+}
+
+// rendersGifs checks whether or not gifs are rendered. The videos of
+// the mp4 format are made from the gifs.
+func rendersGifs() bool {
+	return hasFormat(gifFormat) || hasFormat(mp4Format)
+}
+
+// makesFinalVideo checks whether or not the final video of the project
+// is rendered.
+func makesFinalVideo() bool {
+	return hasFormat(gifFormat) && !gifsOnly
 }
 
 // renderVideo uses Good Bot's Docker image to render a previously
@@ -376,96 +681,49 @@ func renderVideo(projectPath string) string {
 	return finalPath
 }
 
-// cropRec "crops" an Asciinema recording to the standard 24x80
-// format. The "cropping" is done by changing the width and height
-// parameters from the asciicast's json recording file.
-func cropRec(recPath string) error {
-
-	var linesBytes [][]byte
+// getAsciicastConfig gets an asciicast's configuration information.
+// The settings are read from the asciicast's header, without reading
+// the rest of the file. The settings of v1 asciicasts are converted to
+// v2 settings.
+//
+// An error is returned if the file cannot be opened or if its header
+// is invalid.
+func getAsciicastConfig(recPath string) (*asciicast.Header, error) {
 
 	file, err := os.Open(recPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		linesBytes = append(linesBytes, scanner.Bytes())
-	}
-
-	config, err := getAsciicastConfig(linesBytes)
-
+	header, err := asciicast.ReadHeader(file)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("asciicast %s: %w", recPath, err)
 	}
 
-	config.Height = 24
-	config.Width = 80
-
-	newFirstLine, err := json.Marshal(config)
+	return &header, nil
+}
 
+// validateAsciicast makes sure that an asciicast is complete. The first
+// line should contain the asciicast's settings, and every other line
+// should be an event. An asciicast is considered truncated if it has no
+// events, if one of the events cannot be unmarshalled, or if the file
+// does not end with a newline.
+//
+// The returned error contains the number of the faulty line.
+func validateAsciicast(recPath string) error {
+	file, err := os.Open(recPath)
 	if err != nil {
 		return err
 	}
-
-	linesBytes[0] = newFirstLine
-
-	// moving old file as backup
-	backup := recPath + ".backup"
-	os.Rename(recPath, backup)
-	defer os.Remove(backup)
-
-	NewFile, err := os.Create(recPath)
 	defer file.Close()
 
-	if err != nil {
-		os.Rename(backup, recPath)
-		return err
+	if err := asciicast.Validate(file); err != nil {
+		return fmt.Errorf("asciicast %s is invalid: %w", recPath, err)
 	}
-
-	writer := bufio.NewWriter(NewFile)
-
-	for _, line := range(linesBytes) {
-		_, err := fmt.Fprint(writer, string(line) + "\n")
-		if err != nil {
-			os.Rename(backup, recPath)
-			return err
-		}
-	}
-	writer.Flush()
-
 	return nil
 }
 
-// getAsciicastConfig gets an asciicast's configuration information.
-// The settings are unmarshalled from the asciicast's first line.
-//
-// The settings are unmarshalled in a struct type defined as
-// asciicastSettings.
-//
-// An error is returned if there was an error returned by os.Open or
-// json.Unmarshal.
-func getAsciicastConfig(fileLines [][]byte) (*asciicastSettings, error) {
-
-	// Check if fileLines is empty
-	if len(fileLines) == 0 {
-		err := errors.New("getAsciicastConfig: no lines provided")
-		return nil, err
-	}
-
-	var settings asciicastSettings
-
-	err := json.Unmarshal(fileLines[0], &settings)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &settings, err
-}
-
 // getRecsPaths fetches every recording for a project.
 // It gets a list of every scene and then it uses
 // getSceneCasts to get each Asciinema recording from
@@ -487,7 +745,7 @@ func getRecsPaths(projectPath string) []string {
 		// Make sure that it is a scene
 		var sceneRecordings []string
 		var isScene bool = false
-		if strings.Contains(dir.Name(), "scene_"){
+		if strings.Contains(dir.Name(), "scene_") {
 			sceneRecordings, err = getSceneCasts(scenePath)
 			if err != nil {
 				log.Printf("Got error trying to find recordings in scene %s.\n%s", scenePath, err)
@@ -502,6 +760,35 @@ func getRecsPaths(projectPath string) []string {
 	return allPaths
 }
 
+// filterRecsPaths only keeps the recordings that are saved in one of
+// the provided scenes. If no scene is provided, every recording is
+// kept.
+func filterRecsPaths(recPaths []string, scenes []int) []string {
+	if len(scenes) == 0 {
+		return recPaths
+	}
+
+	var filtered []string
+	for _, recPath := range recPaths {
+		scenePath, err := getScenePath(recPath)
+		if err != nil {
+			log.Printf("Could not find the scene of recording %s.\n%s", recPath, err)
+			continue
+		}
+		number, err := sceneNumber(filepath.Base(scenePath))
+		if err != nil {
+			continue
+		}
+		for _, scene := range scenes {
+			if scene == number {
+				filtered = append(filtered, recPath)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
 // getSceneCasts looks for each Asciinema recording saved under
 // the provided scene path. For each file contained in the
 // recordings path of a scene, this function checks if the file's
@@ -0,0 +1,128 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// castResult stores the outcome of the render of a single asciicast.
+type castResult struct {
+	asciicastPath string
+	rendered      []string
+	err           error
+	// output is what was printed while rendering the asciicast.
+	output bytes.Buffer
+	done   bool
+}
+
+// renderCasts renders every provided asciicast with the provided
+// function. Up to jobs asciicasts are rendered at the same time, since
+// each one is rendered on its own.
+//
+// A progress line is written to out as soon as each render is done. What
+// a render prints is kept until it is done, and is written in the order
+// of the asciicasts, no matter which one finishes first, so that the
+// output of different asciicasts is never mixed. A failed render doesn't
+// stop the others.
+//
+// The result of each asciicast is returned, in the same order.
+func renderCasts(asciicastPaths []string, jobs int, out io.Writer, render func(string, io.Writer) ([]string, error)) []*castResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+	results := make([]*castResult, len(asciicastPaths))
+	for i, asciicastPath := range asciicastPaths {
+		results[i] = &castResult{asciicastPath: asciicastPath}
+	}
+
+	var outputLock sync.Mutex
+	finished, next := 0, 0
+	report := func(index int) {
+		outputLock.Lock()
+		defer outputLock.Unlock()
+		finished++
+		printCastProgress(out, results[index], finished, len(results))
+		results[index].done = true
+		for next < len(results) && results[next].done {
+			out.Write(results[next].output.Bytes())
+			next++
+		}
+	}
+
+	toRender := make(chan int)
+	var workers sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for index := range toRender {
+				result := results[index]
+				result.rendered, result.err = render(result.asciicastPath, &result.output)
+				report(index)
+			}
+		}()
+	}
+
+	for index := range asciicastPaths {
+		toRender <- index
+	}
+	close(toRender)
+	workers.Wait()
+	return results
+}
+
+// printCastProgress writes a line that shows how many asciicasts have
+// been rendered so far, and what was rendered, if anything.
+func printCastProgress(out io.Writer, result *castResult, number int, total int) {
+	name := filepath.Join(filepath.Base(filepath.Dir(filepath.Dir(result.asciicastPath))), filepath.Base(result.asciicastPath))
+	if result.err != nil {
+		fmt.Fprintf(out, "[%d/%d] Could not render %s: %s\n", number, total, name, result.err)
+		return
+	}
+	if len(result.rendered) == 0 {
+		fmt.Fprintf(out, "[%d/%d] %s is up to date\n", number, total, name)
+		return
+	}
+	fmt.Fprintf(out, "[%d/%d] Rendered %s\n", number, total, strings.Join(result.rendered, ", "))
+}
+
+// summarizeRenders prints how many asciicasts were rendered, and how
+// many were already up to date. If at least one of them failed, an error
+// that lists every failed asciicast is returned.
+func summarizeRenders(results []*castResult) error {
+	var failed []string
+	upToDate := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", result.asciicastPath, result.err))
+		} else if len(result.rendered) == 0 {
+			upToDate++
+		}
+	}
+
+	fmt.Printf("Rendered %d of %d asciicast(s), %d were up to date.\n", len(results)-len(failed)-upToDate, len(results), upToDate)
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d asciicast(s) could not be rendered:\n%s", len(failed), strings.Join(failed, "\n"))
+	}
+	return nil
+}
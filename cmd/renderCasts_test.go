@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRenderCasts renders fake asciicasts at the same time, and makes
+// sure that progress is reported as renders finish, that what they print
+// is written in order, and that a failure doesn't stop the others.
+func TestRenderCasts(t *testing.T) {
+	paths := []string{
+		"/project/scene_1/asciicasts/commands_1.cast",
+		"/project/scene_1/asciicasts/commands_2.cast",
+		"/project/scene_2/asciicasts/commands_1.cast",
+		"/project/scene_2/asciicasts/commands_2.cast",
+	}
+
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	render := func(asciicastPath string, out io.Writer) ([]string, error) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		defer func() {
+			lock.Lock()
+			running--
+			lock.Unlock()
+		}()
+
+		// With two jobs, the asciicasts finish in the order 2, 3, 1, 4,
+		// 30ms apart.
+		for i, path := range paths {
+			if path == asciicastPath {
+				time.Sleep(time.Duration([]int{3, 1, 1, 2}[i]) * 30 * time.Millisecond)
+			}
+		}
+		fmt.Fprintf(out, "rendering %s\n", asciicastPath)
+		if strings.Contains(asciicastPath, "scene_1/asciicasts/commands_2") {
+			return nil, errors.New("broken")
+		}
+		return []string{strings.Replace(asciicastPath, ".cast", ".gif", 1)}, nil
+	}
+
+	var output bytes.Buffer
+	results := renderCasts(paths, 2, &output, render)
+	if maxRunning != 2 {
+		t.Errorf("%d asciicasts were rendered at the same time, want 2", maxRunning)
+	}
+
+	want := strings.Join([]string{
+		"[1/4] Could not render scene_1/commands_2.cast: broken",
+		"[2/4] Rendered /project/scene_2/asciicasts/commands_1.gif",
+		"[3/4] Rendered /project/scene_1/asciicasts/commands_1.gif",
+		"rendering /project/scene_1/asciicasts/commands_1.cast",
+		"rendering /project/scene_1/asciicasts/commands_2.cast",
+		"rendering /project/scene_2/asciicasts/commands_1.cast",
+		"[4/4] Rendered /project/scene_2/asciicasts/commands_2.gif",
+		"rendering /project/scene_2/asciicasts/commands_2.cast",
+		"",
+	}, "\n")
+	if output.String() != want {
+		t.Errorf("renderCasts printed:\n%s\nwant:\n%s", output.String(), want)
+	}
+
+	err := summarizeRenders(results)
+	if err == nil {
+		t.Fatal("summarizeRenders did not return an error for a failed asciicast")
+	}
+	if !strings.Contains(err.Error(), "1 asciicast(s)") || !strings.Contains(err.Error(), paths[1]) {
+		t.Errorf("summarizeRenders returned %q, want it to list %s", err, paths[1])
+	}
+}
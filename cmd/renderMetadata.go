@@ -0,0 +1,239 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// renderSettings are the settings that change what is rendered from an
+// asciicast. They are saved next to each render, so that a render is
+// only done again when its asciicast or its settings change.
+type renderSettings struct {
+	Format    string `json:"format"`
+	Renderer  string `json:"renderer,omitempty"`
+	Scale     int    `json:"scale,omitempty"`
+	IdleLimit string `json:"idle_limit,omitempty"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	FPS       int    `json:"fps,omitempty"`
+	CRF       int    `json:"crf,omitempty"`
+}
+
+// videoMetadata is saved next to a video made from the gifs of one or
+// more scenes. Scenes are saved by name, along with the hash of every
+// file that is used to make the video. See hashSceneRender for more
+// information.
+type videoMetadata struct {
+	Settings map[string]string `json:"settings"`
+	Scenes   map[string]string `json:"scenes"`
+}
+
+// finalMetadataName is the name of the file, in the final directory,
+// that describes what the final video was made from.
+const finalMetadataName string = ".video.json"
+
+// metadataPath returns the path of the file that describes how a
+// render was made. The file is hidden, next to the render.
+func metadataPath(outputPath string) string {
+	return filepath.Join(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".json")
+}
+
+// renderOutput returns where an asciicast is rendered in a format, along
+// with the current settings of that format.
+func renderOutput(asciicastPath string, format string) (string, renderSettings, error) {
+	scenePath, err := getScenePath(asciicastPath)
+	if err != nil {
+		return "", renderSettings{}, err
+	}
+	project, err := loadProjectSettings(filepath.Dir(scenePath))
+	if err != nil {
+		return "", renderSettings{}, err
+	}
+
+	settings := renderSettings{Format: format, Width: project.Terminal.Width, Height: project.Terminal.Height}
+	if idleLimit > 0 {
+		settings.IdleLimit = idleLimit.String()
+	}
+	var outputDir, extension string
+	switch format {
+	case gifFormat:
+		outputDir, extension = renderPath, ".gif"
+		settings.Renderer = renderer
+		if renderer == nativeRenderer {
+			settings.Scale = renderScale
+		}
+	case svgFormat:
+		outputDir, extension = svgPath, ".svg"
+	case apngFormat:
+		outputDir, extension = apngPath, ".png"
+		settings.Scale = renderScale
+	case webmFormat:
+		outputDir, extension = webmPath, ".webm"
+		settings.Scale, settings.FPS, settings.CRF = renderScale, videoFPS, videoCRF
+	default:
+		return "", renderSettings{}, fmt.Errorf("%s is not rendered for each asciicast", format)
+	}
+
+	fileName := strings.TrimSuffix(filepath.Base(asciicastPath), filepath.Ext(asciicastPath))
+	return filepath.Join(scenePath, outputDir, fileName+extension), settings, nil
+}
+
+// isUpToDate checks whether or not a render can be kept. It can if it
+// exists, if it is newer than its asciicast, and if it was made with the
+// same settings.
+func isUpToDate(asciicastPath string, outputPath string, settings renderSettings) bool {
+	output, err := os.Stat(outputPath)
+	if err != nil {
+		return false
+	}
+	cast, err := os.Stat(asciicastPath)
+	if err != nil || output.ModTime().Before(cast.ModTime()) {
+		return false
+	}
+
+	contents, err := os.ReadFile(metadataPath(outputPath))
+	if err != nil {
+		return false
+	}
+	var saved renderSettings
+	if err := json.Unmarshal(contents, &saved); err != nil {
+		return false
+	}
+	return saved == settings
+}
+
+// saveRenderSettings writes the settings of a render next to it.
+func saveRenderSettings(outputPath string, settings renderSettings) error {
+	return writeMetadata(metadataPath(outputPath), settings)
+}
+
+// currentVideoMetadata describes the current state of the provided
+// scenes of a project, and the settings that change what a video made
+// from them looks like. Settings that only apply to the FFmpeg engine
+// are only saved when ffmpeg is true.
+func currentVideoMetadata(projectPath string, scenes []string, ffmpeg bool) (*videoMetadata, error) {
+	metadata := &videoMetadata{
+		Settings: map[string]string{"normalize": fmt.Sprint(normalizeAudio)},
+		Scenes:   make(map[string]string),
+	}
+	if ffmpeg {
+		metadata.Settings["codec"] = videoCodec
+		metadata.Settings["crf"] = fmt.Sprint(videoCRF)
+		metadata.Settings["fps"] = fmt.Sprint(videoFPS)
+		metadata.Settings["resolution"] = videoResolution
+	}
+	for _, scene := range scenes {
+		hash, err := hashSceneRender(filepath.Join(projectPath, scene))
+		if err != nil {
+			return nil, err
+		}
+		metadata.Scenes[scene] = hash
+	}
+	return metadata, nil
+}
+
+// changedScenes compares the metadata saved at metadataPath with the
+// current one. The scenes that changed since then are returned, sorted
+// by name. If the settings changed, or if nothing was saved, every
+// scene is returned.
+func changedScenes(metadataPath string, current *videoMetadata) []string {
+	var all []string
+	for scene := range current.Scenes {
+		all = append(all, scene)
+	}
+	sort.Strings(all)
+
+	contents, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return all
+	}
+	var saved videoMetadata
+	if err := json.Unmarshal(contents, &saved); err != nil || !sameSettings(saved.Settings, current.Settings) {
+		return all
+	}
+
+	var changed []string
+	for _, scene := range all {
+		if saved.Scenes[scene] != current.Scenes[scene] {
+			changed = append(changed, scene)
+		}
+	}
+	// Scenes that were removed also change the video.
+	for scene := range saved.Scenes {
+		if _, ok := current.Scenes[scene]; !ok {
+			changed = append(changed, scene)
+		}
+	}
+	return changed
+}
+
+// sameSettings checks whether or not two sets of settings are the same.
+func sameSettings(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// hashSceneRender computes a hash of every file of a scene that is used
+// to make a video: its asciicasts, gifs, narration and the text that is
+// read. Files are hashed by name, size and modification time, since
+// gifs can be large.
+func hashSceneRender(scenePath string) (string, error) {
+	hash := sha256.New()
+	for _, dir := range []string{"asciicasts", "gifs", "audio", "read"} {
+		files, err := listFiles(filepath.Join(scenePath, dir))
+		if err != nil {
+			return "", err
+		}
+		for _, file := range files {
+			// Hidden files, such as the settings of renders, are not
+			// used to make the video.
+			if strings.HasPrefix(file, ".") {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(scenePath, dir, file))
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(hash, "%s/%s %d %d\n", dir, file, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeMetadata writes a value as indented JSON.
+func writeMetadata(path string, value interface{}) error {
+	contents, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(contents, '\n'), 0644)
+}
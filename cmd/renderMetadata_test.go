@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRenderCastFormatsIncremental renders an asciicast twice, and makes
+// sure that it is only rendered again when it or its settings change.
+func TestRenderCastFormatsIncremental(t *testing.T) {
+	defer func(formats []string, name string, scale int) {
+		renderFormats, renderer, renderScale = formats, name, scale
+	}(renderFormats, renderer, renderScale)
+	renderFormats, renderer, renderScale = []string{gifFormat, svgFormat}, nativeRenderer, 1
+
+	projectPath := copyTestScene(t)
+	castPath := filepath.Join(projectPath, "scene_1", "asciicasts", "commands_1.cast")
+	renderTwice := func() []string {
+		rendered, err := renderCastFormats(castPath, nil, context.Background(), ioutil.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rendered
+	}
+
+	if rendered := renderTwice(); len(rendered) != 2 {
+		t.Fatalf("first render made %v, want a gif and an svg", rendered)
+	}
+	if rendered := renderTwice(); len(rendered) != 0 {
+		t.Errorf("renders that are up to date were rendered again: %v", rendered)
+	}
+
+	// Settings are saved next to each render.
+	gifPath := filepath.Join(projectPath, "scene_1", "gifs", "commands_1.gif")
+	if _, err := os.Stat(filepath.Join(projectPath, "scene_1", "gifs", ".commands_1.gif.json")); err != nil {
+		t.Errorf("the settings of %s were not saved: %s", gifPath, err)
+	}
+
+	// Only the gif depends on the scale.
+	renderScale = 2
+	if rendered := renderTwice(); len(rendered) != 1 || rendered[0] != gifPath {
+		t.Errorf("changing the scale rendered %v, want only %s", rendered, gifPath)
+	}
+
+	// An asciicast that is newer than its renders is rendered again.
+	earlier := time.Now().Add(-time.Hour)
+	for _, outputPath := range []string{gifPath, filepath.Join(projectPath, "scene_1", "svg", "commands_1.svg")} {
+		if err := os.Chtimes(outputPath, earlier, earlier); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rendered := renderTwice(); len(rendered) != 2 {
+		t.Errorf("a newer asciicast rendered %v, want a gif and an svg", rendered)
+	}
+
+	// Renders that were removed are rendered again.
+	if err := os.Remove(gifPath); err != nil {
+		t.Fatal(err)
+	}
+	if rendered := renderTwice(); len(rendered) != 1 || rendered[0] != gifPath {
+		t.Errorf("removing the gif rendered %v, want only %s", rendered, gifPath)
+	}
+}
+
+// TestChangedScenes finds which scenes changed since a video was made.
+func TestChangedScenes(t *testing.T) {
+	defer func(normalize bool) { normalizeAudio = normalize }(normalizeAudio)
+	normalizeAudio = false
+
+	projectPath := copyTestScene(t)
+	if err := copyDir(filepath.Join(projectPath, "scene_1"), filepath.Join(projectPath, "scene_2")); err != nil {
+		t.Fatal(err)
+	}
+	scenes := []string{"scene_1", "scene_2"}
+	metadataPath := filepath.Join(projectPath, finalMetadataName)
+
+	metadata, err := currentVideoMetadata(projectPath, scenes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed := changedScenes(metadataPath, metadata); len(changed) != 2 {
+		t.Errorf("changedScenes without metadata returned %v, want every scene", changed)
+	}
+	if err := writeMetadata(metadataPath, metadata); err != nil {
+		t.Fatal(err)
+	}
+	if changed := changedScenes(metadataPath, metadata); len(changed) != 0 {
+		t.Errorf("changedScenes returned %v for scenes that did not change", changed)
+	}
+
+	later := time.Now().Add(time.Hour)
+	audioPath := filepath.Join(projectPath, "scene_2", "audio", "read_1.mp3")
+	if err := os.Chtimes(audioPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err = currentVideoMetadata(projectPath, scenes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed := changedScenes(metadataPath, metadata); len(changed) != 1 || changed[0] != "scene_2" {
+		t.Errorf("changedScenes returned %v, want scene_2", changed)
+	}
+
+	// Changing the settings changes every scene.
+	normalizeAudio = true
+	metadata, err = currentVideoMetadata(projectPath, scenes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed := changedScenes(metadataPath, metadata); len(changed) != 2 {
+		t.Errorf("changedScenes returned %v after changing the settings, want every scene", changed)
+	}
+}
@@ -1,12 +1,14 @@
 package cmd
 
 import (
-	"bufio"
+	"image/gif"
+	"image/png"
 	"io/ioutil"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"testing"
@@ -57,7 +59,10 @@ func TestRenderRecording(t *testing.T) {
 	}
 	io.Copy(os.Stdout, reader) // Print container info to stdout.
 
-	render := renderRecording(castPath, cli, ctx)
+	render, err := renderRecording(castPath, cli, ctx, os.Stdout)
+	if err != nil {
+		t.Errorf("renderRecording on file %s returned error: %s", castPath, err)
+	}
 
 	// Checking if file has been properly created.
 	_, err = os.Stat(render)
@@ -91,31 +96,19 @@ func TestCropRec(t *testing.T) {
 
 	err = ioutil.WriteFile(newCastPath, contents, 0644)
 	defer os.Remove(newCastPath)
+	defer os.Remove(newCastPath + uncroppedExtension)
 
 	if err != nil {
 		t.Errorf("Test  error: could not write to file.\n%s", err)
 	}
 
 	// Cropping the new test file.
-	cropRec(newCastPath)
-
-	// Getting lines from new file
-	file, err := os.Open(newCastPath)
-	if err != nil {
-		t.Errorf("Test error: could not open file %s\n%s", newCastPath, err)
-	}
-	defer file.Close()
-
-	var fileLines [][]byte
-
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		fileLines = append(fileLines, scanner.Bytes())
+	if err := cropRec(newCastPath, 80, 24); err != nil {
+		t.Errorf("cropRec(%s) returned error:\n%s", newCastPath, err)
 	}
 
 	// Checking if new file is properly cropped.
-	info, err := getAsciicastConfig(fileLines)
+	info, err := getAsciicastConfig(newCastPath)
 
 	if err != nil {
 		t.Errorf("getAsciicastConfig running on %s and got error:\n%s", newCastPath, err)
@@ -129,9 +122,126 @@ func TestCropRec(t *testing.T) {
 		t.Errorf("cropRec error: cropped file %s has width %d, want %d", newCastPath, info.Width, 80)
 	}
 
+	// Other settings should be kept.
+	if info.Timestamp != 1625778960 || info.Env["TERM"] != "linux" {
+		t.Errorf("cropRec error: cropped file %s did not keep its other settings: %+v", newCastPath, info)
+	}
+
+	// The original recording should be kept next to the cropped one.
+	uncropped, err := ioutil.ReadFile(newCastPath + uncroppedExtension)
+	if err != nil || string(uncropped) != string(contents) {
+		t.Errorf("cropRec did not keep the original recording: %v", err)
+	}
+
 	// Files are closed with defer statements.
 }
 
+// TestNativeRecording renders an asciicast with the native renderer,
+// and checks that the gif is written where renderRecording writes it.
+func TestNativeRecording(t *testing.T) {
+	projectPath := copyTestScene(t)
+	castPath := filepath.Join(projectPath, "scene_1", "asciicasts", "commands_1.cast")
+
+	gifPath, err := renderRecordingNative(castPath)
+	if err != nil {
+		t.Fatalf("renderRecordingNative(%s) returned error: %s", castPath, err)
+	}
+	if want := filepath.Join(projectPath, "scene_1", "gifs", "commands_1.gif"); gifPath != want {
+		t.Fatalf("renderRecordingNative(%s) returned %q, want %q", castPath, gifPath, want)
+	}
+	file, err := os.Open(gifPath)
+	if err != nil {
+		t.Fatalf("renderRecordingNative(%s) did not write a gif: %s", castPath, err)
+	}
+	defer file.Close()
+
+	// The asciicast is cropped to the project's size before rendering.
+	config, err := gif.DecodeConfig(file)
+	if err != nil {
+		t.Fatalf("Could not decode the gif %s: %s", gifPath, err)
+	}
+	if config.Width != 80*7 || config.Height != 24*13 {
+		t.Errorf("renderRecordingNative rendered a %dx%d gif, want %dx%d", config.Width, config.Height, 80*7, 24*13)
+	}
+}
+
+// TestSVGRecording renders an asciicast as an svg, which is written in
+// the scene's svg directory.
+func TestSVGRecording(t *testing.T) {
+	projectPath := copyTestScene(t)
+	castPath := filepath.Join(projectPath, "scene_1", "asciicasts", "commands_1.cast")
+
+	svgPath, err := renderRecordingSVG(castPath)
+	if err != nil {
+		t.Fatalf("renderRecordingSVG(%s) returned error: %s", castPath, err)
+	}
+	if want := filepath.Join(projectPath, "scene_1", "svg", "commands_1.svg"); svgPath != want {
+		t.Fatalf("renderRecordingSVG(%s) returned %q, want %q", castPath, svgPath, want)
+	}
+	contents, err := os.ReadFile(svgPath)
+	if err != nil {
+		t.Fatalf("renderRecordingSVG(%s) did not write an svg: %s", castPath, err)
+	}
+	if !strings.Contains(string(contents), "root@ebead59c7311:/app#") {
+		t.Errorf("renderRecordingSVG(%s) wrote an svg without the recording's text", castPath)
+	}
+}
+
+// TestAPNGRecording renders an asciicast as an animated png, which is
+// written in the scene's apng directory.
+func TestAPNGRecording(t *testing.T) {
+	projectPath := copyTestScene(t)
+	castPath := filepath.Join(projectPath, "scene_1", "asciicasts", "commands_1.cast")
+
+	pngPath, err := renderRecordingAPNG(castPath)
+	if err != nil {
+		t.Fatalf("renderRecordingAPNG(%s) returned error: %s", castPath, err)
+	}
+	if want := filepath.Join(projectPath, "scene_1", "apng", "commands_1.png"); pngPath != want {
+		t.Fatalf("renderRecordingAPNG(%s) returned %q, want %q", castPath, pngPath, want)
+	}
+	file, err := os.Open(pngPath)
+	if err != nil {
+		t.Fatalf("renderRecordingAPNG(%s) did not write a png: %s", castPath, err)
+	}
+	defer file.Close()
+	config, err := png.DecodeConfig(file)
+	if err != nil {
+		t.Fatalf("Could not decode the png %s: %s", pngPath, err)
+	}
+	if config.Width != 80*7 || config.Height != 24*13 {
+		t.Errorf("renderRecordingAPNG rendered a %dx%d png, want %dx%d", config.Width, config.Height, 80*7, 24*13)
+	}
+}
+
+// TestCheckFormats accepts known formats and rejects unknown ones. The
+// formats that need FFmpeg are not checked, since it may not be
+// installed.
+func TestCheckFormats(t *testing.T) {
+	defer func(formats []string) { renderFormats = formats }(renderFormats)
+
+	var testCases = []struct {
+		formats []string
+		valid   bool
+	}{
+		{[]string{gifFormat}, true},
+		{[]string{svgFormat, apngFormat}, true},
+		{[]string{"avi"}, false},
+		{nil, false},
+	}
+	for _, tc := range testCases {
+		renderFormats = tc.formats
+		if err := checkRenderer(); (err == nil) != tc.valid {
+			t.Errorf("checkRenderer() with formats %v returned error %v, want valid: %v", tc.formats, err, tc.valid)
+		}
+	}
+
+	renderFormats = []string{svgFormat, mp4Format}
+	if !rendersGifs() || makesFinalVideo() {
+		t.Errorf("formats %v should render gifs, but not the final video", renderFormats)
+	}
+}
+
 // TestGetRecPaths checks the amount of asciicasts found in a project
 // by getRecsPaths. The project used for those tests contains dummy
 // files in one of the scene's asciicast directory.
@@ -187,21 +297,7 @@ func TestGetSceneCastsContents(t *testing.T) {
 
 	// Checking contents of each file.
 	for _, file := range casts {
-		var fileLines [][]byte
-
-		openFile, err := os.Open(file)
-
-		if err != nil {
-			t.Errorf("test: error reading file %s.\n%s", file, err)
-		}
-
-		scanner := bufio.NewScanner(openFile)
-
-		for scanner.Scan() {
-			fileLines = append(fileLines, scanner.Bytes())
-		}
-
-		_, err = getAsciicastConfig(fileLines)
+		_, err = getAsciicastConfig(file)
 
 		if err != nil {
 			t.Errorf("parsing json from asciicast %s returned an error:\n%s\n", file, err)
@@ -220,22 +316,12 @@ func TestGetAsciicastConfig(t *testing.T) {
 		t.Errorf("Error finding file: %s", err)
 	}
 
-	var fileLines [][]byte
-
-	openFile, err := os.Open(recPath)
+	recSettings, err := getAsciicastConfig(recPath)
 
 	if err != nil {
-		t.Errorf("test: error reading file %s.\n%s", recPath, err)
-	}
-
-	scanner := bufio.NewScanner(openFile)
-
-	for scanner.Scan() {
-		fileLines = append(fileLines, scanner.Bytes())
+		t.Fatalf("getAsciicastConfig(%s) returned error:\n%s", recPath, err)
 	}
 
-	recSettings, err := getAsciicastConfig(fileLines)
-
 	// Checking each param in the config. Th json looks
 	// like this:
 	// {
@@ -245,7 +331,13 @@ func TestGetAsciicastConfig(t *testing.T) {
 	// 	"timestamp": 1625778960,
 	// 	"env": {"SHELL": null, "TERM": "linux"}
 	// }
-	wantSettings := &asciicastSettings{2, 219, 8, 1625778960, &asciicastEnv{"", "linux"}}
+	wantSettings := &asciicast.Header{
+		Version:   2,
+		Width:     219,
+		Height:    8,
+		Timestamp: 1625778960,
+		Env:       map[string]string{"SHELL": "", "TERM": "linux"},
+	}
 
 	if recSettings.Version != wantSettings.Version {
 		t.Errorf("getAsciicastConfig on file %s found version %d, want %d.", recPath, recSettings.Version, wantSettings.Version)
@@ -259,41 +351,41 @@ func TestGetAsciicastConfig(t *testing.T) {
 		t.Errorf("getAsciicastConfig on file %s found height of %d, want %d.", recPath, recSettings.Height, wantSettings.Height)
 	}
 
-	if recSettings.Time != wantSettings.Time {
-		t.Errorf("getAsciicastConfig on file %s found timestamp of %d, want %d.", recPath, recSettings.Time, wantSettings.Time)
+	if recSettings.Timestamp != wantSettings.Timestamp {
+		t.Errorf("getAsciicastConfig on file %s found timestamp of %d, want %d.", recPath, recSettings.Timestamp, wantSettings.Timestamp)
 	}
 
-	if recSettings.Env.Shell != wantSettings.Env.Shell {
+	if recSettings.Env["SHELL"] != wantSettings.Env["SHELL"] {
 		// null is clearer when printed than an empty string.
 		var got string
 		var want string
 
-		if recSettings.Env.Shell == "" {
+		if recSettings.Env["SHELL"] == "" {
 			got = "null"
 		} else {
-			got = recSettings.Env.Shell
+			got = recSettings.Env["SHELL"]
 		}
-		if wantSettings.Env.Shell == "" {
+		if wantSettings.Env["SHELL"] == "" {
 			want = "null"
 		} else {
-			want = wantSettings.Env.Shell
+			want = wantSettings.Env["SHELL"]
 		}
 		t.Errorf("getAsciicastConfig on file %s found shell %s, want %s.", recPath, got, want)
 	}
-	if recSettings.Env.Term != wantSettings.Env.Term {
+	if recSettings.Env["TERM"] != wantSettings.Env["TERM"] {
 		// null is clearer when printed than an empty string.
 		var got string
 		var want string
 
-		if recSettings.Env.Term == "" {
+		if recSettings.Env["TERM"] == "" {
 			got = "null"
 		} else {
-			got = recSettings.Env.Term
+			got = recSettings.Env["TERM"]
 		}
-		if wantSettings.Env.Term == "" {
+		if wantSettings.Env["TERM"] == "" {
 			want = "null"
 		} else {
-			want = wantSettings.Env.Term
+			want = wantSettings.Env["TERM"]
 		}
 		t.Errorf("getAsciicastConfig on file %s found term %s, want %s.", recPath, got, want)
 	}
@@ -462,3 +554,55 @@ func TestGetScenePathErr(t *testing.T) {
 		t.Errorf("getScenePath(%s) should raise an error.", falsePath)
 	}
 }
+
+// TestFilterRecsPaths makes sure that only the recordings from the
+// selected scenes are kept by filterRecsPaths.
+func TestFilterRecsPaths(t *testing.T) {
+	projectPath, err := filepath.Abs(testData.testProject1)
+
+	if err != nil {
+		t.Errorf("Error finding testdata: %s", err)
+	}
+
+	recPaths := filterRecsPaths(getRecsPaths(projectPath), []int{1, 3})
+
+	// scene_1 contains 2 asciicasts and scene_3 contains 1.
+	want := 3
+	got := len(recPaths)
+
+	if got != want {
+		t.Errorf("filterRecsPaths returns an array of length %d, want %d", got, want)
+	}
+
+	for _, recPath := range recPaths {
+		if strings.Contains(recPath, "scene_2") || strings.Contains(recPath, "scene_4") {
+			t.Errorf("filterRecsPaths kept %s, which is not in the selected scenes", recPath)
+		}
+	}
+}
+
+// TestValidateAsciicast checks a valid asciicast from the testdata and
+// a truncated copy of it.
+func TestValidateAsciicast(t *testing.T) {
+	castPath := filepath.Join(testData.testProject1, "scene_1/asciicasts/commands_1.cast")
+
+	if err := validateAsciicast(castPath); err != nil {
+		t.Errorf("validateAsciicast(%s) returned error:\n%s", castPath, err)
+	}
+
+	contents, err := os.ReadFile(castPath)
+	if err != nil {
+		t.Fatalf("Test error: could not read file %s.\n%s", castPath, err)
+	}
+
+	truncatedPath := filepath.Join(testData.dir, "truncated.cast")
+	err = ioutil.WriteFile(truncatedPath, contents[:len(contents)-10], 0644)
+	if err != nil {
+		t.Fatalf("Test error: could not write to file.\n%s", err)
+	}
+	defer os.Remove(truncatedPath)
+
+	if err := validateAsciicast(truncatedPath); err == nil {
+		t.Errorf("validateAsciicast(%s) should fail on a truncated asciicast", truncatedPath)
+	}
+}
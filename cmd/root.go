@@ -18,11 +18,14 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -310,3 +313,111 @@ func isReadStatement(projectPath string) (bool, error) {
 
 	return false, nil
 }
+
+// isScene checks whether or not an item from a project directory is
+// a scene. Scenes are directories named "scene_" followed by the
+// scene's number.
+func isScene(item fs.DirEntry) bool {
+	_, err := sceneNumber(item.Name())
+	return item.IsDir() && err == nil
+}
+
+// sceneNumber returns the number of a scene from the name of its
+// directory. An error is returned if the name does not follow the
+// "scene_N" format used by Good Bot.
+func sceneNumber(sceneName string) (int, error) {
+	if !strings.HasPrefix(sceneName, "scene_") {
+		return 0, fmt.Errorf("%s is not the name of a scene", sceneName)
+	}
+	number, err := strconv.Atoi(strings.TrimPrefix(sceneName, "scene_"))
+	if err != nil {
+		return 0, fmt.Errorf("%s is not the name of a scene", sceneName)
+	}
+	return number, nil
+}
+
+// getProjectScenes lists the name of every scene in a project. The
+// scenes are sorted by their number, so "scene_10" comes after
+// "scene_2".
+//
+// If there is an error returned when reading the project directory,
+// it is returned.
+func getProjectScenes(projectPath string) ([]string, error) {
+	projectContents, err := os.ReadDir(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var scenes []string
+	for _, item := range projectContents {
+		if isScene(item) {
+			scenes = append(scenes, item.Name())
+		}
+	}
+
+	sort.Slice(scenes, func(i, j int) bool {
+		first, _ := sceneNumber(scenes[i])
+		second, _ := sceneNumber(scenes[j])
+		return first < second
+	})
+
+	return scenes, nil
+}
+
+// selectScenes returns the name of the scenes from a project that match
+// the provided scene numbers. An empty list of numbers selects every
+// scene of the project.
+//
+// An error is returned if one of the numbers does not match any scene.
+func selectScenes(projectPath string, numbers []int) ([]string, error) {
+	scenes, err := getProjectScenes(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(numbers) == 0 {
+		return scenes, nil
+	}
+
+	var selected []string
+	for _, number := range numbers {
+		sceneName := fmt.Sprintf("scene_%d", number)
+		found := false
+		for _, scene := range scenes {
+			if scene == sceneName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("project %s does not contain %s", projectPath, sceneName)
+		}
+		selected = append(selected, sceneName)
+	}
+	return selected, nil
+}
+
+// copyDir copies every file from the source directory to the destination
+// directory. Subdirectories are copied recursively, and the destination
+// is created if it does not exist. Existing files are overwritten.
+func copyDir(source string, destination string) error {
+	return filepath.WalkDir(source, func(path string, item fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relative)
+
+		if item.IsDir() {
+			return os.MkdirAll(target, 0777)
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, contents, 0644)
+	})
+}
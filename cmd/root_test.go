@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -56,3 +58,43 @@ func TestIsReadStatementNoRead(t *testing.T) {
 		t.Errorf("isReadStatement(%s) returned %t, should be %t", testData.noAudio, isRead, !isRead)
 	}
 }
+
+// TestGetProjectScenes checks that every scene of the test project is
+// found, in order, and that other directories are ignored.
+func TestGetProjectScenes(t *testing.T) {
+	scenes, err := getProjectScenes(testData.testProject1)
+	if err != nil {
+		t.Fatalf("getProjectScenes(%s) returned error:\n%s", testData.testProject1, err)
+	}
+	want := []string{"scene_1", "scene_2", "scene_3", "scene_4"}
+	if strings.Join(scenes, ",") != strings.Join(want, ",") {
+		t.Errorf("getProjectScenes(%s) = %v, want %v", testData.testProject1, scenes, want)
+	}
+}
+
+// TestSelectScenesMissing uses selectScenes with a scene that does not
+// exist in the project. An error should be returned.
+func TestSelectScenesMissing(t *testing.T) {
+	_, err := selectScenes(testData.testProject1, []int{1, 9})
+	if err == nil {
+		t.Errorf("selectScenes(%s) should return an error for scene_9", testData.testProject1)
+	}
+}
+
+// TestCopyDir copies a scene from the test project and makes sure that
+// the files from its subdirectories have been copied.
+func TestCopyDir(t *testing.T) {
+	source := filepath.Join(testData.testProject1, "scene_1")
+	destination := filepath.Join(testData.dir, "copied")
+	defer os.RemoveAll(destination)
+
+	if err := copyDir(source, destination); err != nil {
+		t.Fatalf("copyDir(%s, %s) returned error:\n%s", source, destination, err)
+	}
+
+	for _, file := range []string{"commands/commands_1", "read/read_2.txt", "audio/read_1.mp3"} {
+		if _, err := os.Stat(filepath.Join(destination, file)); err != nil {
+			t.Errorf("copyDir(%s, %s) did not copy %s", source, destination, file)
+		}
+	}
+}
@@ -0,0 +1,534 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// secretsCmd represents the secrets command
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manages passwords in an encrypted secrets store.",
+	Long: `Secrets manages passwords in an encrypted store, as an
+alternative to the plaintext passwords file.
+
+The store is encrypted with a passphrase, or with a key file
+created by the keygen subcommand. The passphrase is asked
+interactively, unless it is set in the GOOD_BOT_PASSPHRASE
+environment variable. The store keeps its encryption when it
+is changed. Use --key-file or --passphrase with set or rm to
+switch to a key file or to a passphrase.
+
+Secrets from the store are decrypted when recording, and
+are only given to Good Bot's container as environment
+variables. They are never written to disk in plaintext.`,
+}
+
+var secretsSetCmd = &cobra.Command{
+	Use:   "set [name] [value]",
+	Short: "Adds or replaces a secret.",
+	Long: `Adds a secret to the store, or replaces it if it already
+exists. If no value is provided, it is asked interactively so
+that it doesn't end up in your shell's history.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !envVarName.MatchString(args[0]) {
+			log.Fatalf("%q is not a valid secret name. Names can only contain letters, digits and underscores.", args[0])
+		}
+		store := getSecretsStore()
+		secrets, err := store.load(true)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var value string
+		if len(args) == 2 {
+			value = args[1]
+		} else {
+			prompt := &survey.Password{Message: fmt.Sprintf("Value of %s:", args[0])}
+			if err := survey.AskOne(prompt, &value); err != nil {
+				log.Fatalf("Prompt failed %v\n", err)
+			}
+		}
+
+		secrets[args[0]] = value
+		if err := store.save(secrets); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Saved %s in %s.\n", args[0], store.path)
+	},
+}
+
+var secretsGetCmd = &cobra.Command{
+	Use:   "get [name]",
+	Short: "Prints the value of a secret.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		secrets, err := getSecretsStore().load(false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		value, ok := secrets[args[0]]
+		if !ok {
+			log.Fatalf("There is no secret named %s.", args[0])
+		}
+		fmt.Println(value)
+	},
+}
+
+var secretsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the name of every secret.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		secrets, err := getSecretsStore().load(false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, name := range sortedSecretNames(secrets) {
+			fmt.Println(name)
+		}
+	},
+}
+
+var secretsRmCmd = &cobra.Command{
+	Use:   "rm [name]",
+	Short: "Removes a secret.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store := getSecretsStore()
+		secrets, err := store.load(false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, ok := secrets[args[0]]; !ok {
+			log.Fatalf("There is no secret named %s.", args[0])
+		}
+		delete(secrets, args[0])
+		if err := store.save(secrets); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Removed %s from %s.\n", args[0], store.path)
+	},
+}
+
+var secretsKeygenCmd = &cobra.Command{
+	Use:   "keygen [path to key file]",
+	Short: "Creates a key file to encrypt the store.",
+	Long: `Creates a new random key file that can be used instead of
+a passphrase to encrypt the secrets store. Use it with the
+--key-file flag, or set "secretsKeyFile" in your configuration
+file. Anyone with this file can decrypt your secrets.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		keyPath, err := processPath(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if validatePath(keyPath) {
+			log.Fatalf("%s already exists.", keyPath)
+		}
+		if err := writeKeyFile(keyPath); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Key file has been written as %s.\n", keyPath)
+	},
+}
+
+var (
+	secretsStorePath  string
+	secretsKeyFile    string
+	secretsPassphrase bool
+)
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsSetCmd, secretsGetCmd, secretsListCmd, secretsRmCmd, secretsKeygenCmd)
+
+	secretsCmd.PersistentFlags().StringVar(&secretsStorePath, "store", "", "secrets store (default is $HOME/.good-bot-secrets)")
+	secretsCmd.PersistentFlags().StringVar(&secretsKeyFile, "key-file", "", "Key file used to encrypt the store instead of a passphrase.")
+	secretsCmd.PersistentFlags().BoolVar(&secretsPassphrase, "passphrase", false, `Encrypt the store with a passphrase. Use it with --key-file
+to stop using a key file.`)
+}
+
+const (
+	// passphraseEnv is the environment variable that can contain the
+	// store's passphrase.
+	passphraseEnv string = "GOOD_BOT_PASSPHRASE"
+	// keyFilePrefix starts the line that contains the key in key files.
+	keyFilePrefix string = "GOOD-BOT-SECRET-KEY-"
+	// Parameters used to derive a key from a passphrase.
+	scryptN int = 1 << 15
+	scryptR int = 8
+	scryptP int = 1
+)
+
+// secretsEnvelope is how the store is saved on disk. Secrets are
+// marshalled as a JSON object, and then encrypted with
+// ChaCha20-Poly1305. The key is either derived from a passphrase with
+// scrypt, or read from a key file.
+type secretsEnvelope struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt,omitempty"`
+	N          int    `json:"n,omitempty"`
+	R          int    `json:"r,omitempty"`
+	P          int    `json:"p,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// secretsStore is an encrypted file that contains secrets. New stores
+// are encrypted with keyFile, or with a passphrase if keyFile is empty.
+type secretsStore struct {
+	path    string
+	keyFile string
+	// kdf is how the store is encrypted, either "scrypt" or "key-file".
+	// It is set by load, so that saving keeps the store's encryption,
+	// unless it was chosen explicitly.
+	kdf string
+	// Only asked once, when the store is first used.
+	passphrase string
+}
+
+// getSecretsStore creates a secretsStore from the flags, or from the
+// "secretsStore" and "secretsKeyFile" values of the configuration file.
+// The --passphrase and --key-file flags choose how the store is
+// encrypted when it is saved. The configuration file doesn't, so that
+// setting a key file there doesn't change the encryption of a store
+// that uses a passphrase.
+func getSecretsStore() *secretsStore {
+	// Reading the configuration file if there is one.
+	viper.ReadInConfig()
+
+	store := &secretsStore{path: secretsStorePath, keyFile: secretsKeyFile}
+	if secretsPassphrase {
+		store.kdf = "scrypt"
+	} else if secretsKeyFile != "" {
+		store.kdf = "key-file"
+	}
+	if store.path == "" {
+		store.path = viper.GetString("secretsStore")
+	}
+	if store.path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatalf("Got an error trying to find the home directory.\n%s", err)
+		}
+		store.path = filepath.Join(home, ".good-bot-secrets")
+	}
+	if store.keyFile == "" {
+		store.keyFile = viper.GetString("secretsKeyFile")
+	}
+	return store
+}
+
+// exists checks whether or not the store has been created.
+func (s *secretsStore) exists() bool {
+	_, err := os.Stat(s.path)
+	return err == nil
+}
+
+// load decrypts the secrets saved in the store. If the store does not
+// exist and create is true, an empty store is returned. Otherwise, an
+// error is returned.
+//
+// The store's encryption is remembered, unless another one was chosen.
+func (s *secretsStore) load(create bool) (map[string]string, error) {
+	contents, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		if create {
+			return make(map[string]string), nil
+		}
+		return nil, fmt.Errorf("there is no secrets store at %s. Use 'secrets set' to create one", s.path)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var envelope secretsEnvelope
+	if err := json.Unmarshal(contents, &envelope); err != nil {
+		return nil, fmt.Errorf("could not read the secrets store %s: %s", s.path, err)
+	}
+
+	key, err := s.key(&envelope, false)
+	if err != nil {
+		return nil, err
+	}
+	if s.kdf == "" {
+		s.kdf = envelope.KDF
+	}
+	return decryptSecrets(&envelope, key)
+}
+
+// save encrypts the secrets and writes them in the store. The store is
+// encrypted the way it was when it was loaded, unless another way was
+// chosen. New stores use the key file if there is one, or a passphrase.
+// A passphrase that was not used to load the store has to be confirmed.
+// The store is only readable by its owner.
+func (s *secretsStore) save(secrets map[string]string) error {
+	kdf := s.kdf
+	if kdf == "" {
+		kdf = "scrypt"
+		if s.keyFile != "" {
+			kdf = "key-file"
+		}
+	}
+	envelope := &secretsEnvelope{Version: 1, KDF: kdf}
+	if kdf == "scrypt" {
+		envelope.Salt = make([]byte, 16)
+		if _, err := rand.Read(envelope.Salt); err != nil {
+			return err
+		}
+		envelope.N, envelope.R, envelope.P = scryptN, scryptR, scryptP
+	}
+
+	key, err := s.key(envelope, s.passphrase == "")
+	if err != nil {
+		return err
+	}
+	if err := encryptSecrets(envelope, secrets, key); err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporary := s.path + ".tmp"
+	if err := ioutil.WriteFile(temporary, append(contents, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporary, s.path)
+}
+
+// key returns the key used to encrypt or decrypt an envelope. If the
+// envelope uses a key file, the store's key file is read. Otherwise, the
+// key is derived from the passphrase. The passphrase is read from the
+// GOOD_BOT_PASSPHRASE environment variable or asked interactively, and
+// has to be confirmed if confirm is true.
+func (s *secretsStore) key(envelope *secretsEnvelope, confirm bool) ([]byte, error) {
+	switch envelope.KDF {
+	case "key-file":
+		if s.keyFile == "" {
+			return nil, fmt.Errorf("the secrets store %s is encrypted with a key file. Please provide it with --key-file or secretsKeyFile", s.path)
+		}
+		return readKeyFile(s.keyFile)
+	case "scrypt":
+		if s.passphrase == "" {
+			passphrase, err := askPassphrase(confirm)
+			if err != nil {
+				return nil, err
+			}
+			s.passphrase = passphrase
+		}
+		return scrypt.Key([]byte(s.passphrase), envelope.Salt, envelope.N, envelope.R, envelope.P, chacha20poly1305.KeySize)
+	default:
+		return nil, fmt.Errorf("the secrets store %s uses an unknown encryption %q", s.path, envelope.KDF)
+	}
+}
+
+// askPassphrase returns the passphrase from the GOOD_BOT_PASSPHRASE
+// environment variable, or prompts the user for it. If confirm is true,
+// the user has to type the passphrase twice.
+func askPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	var passphrase string
+	if err := survey.AskOne(&survey.Password{Message: "Passphrase of the secrets store:"}, &passphrase, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+	if confirm {
+		var confirmation string
+		if err := survey.AskOne(&survey.Password{Message: "Confirm the passphrase:"}, &confirmation); err != nil {
+			return "", err
+		}
+		if confirmation != passphrase {
+			return "", errors.New("the passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+// encryptSecrets marshals the secrets and encrypts them with the key.
+// The envelope's settings are used as additional data, so that they
+// can't be changed without failing the decryption. The nonce and the
+// ciphertext are saved in the envelope.
+func encryptSecrets(envelope *secretsEnvelope, secrets map[string]string, key []byte) error {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+
+	envelope.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(envelope.Nonce); err != nil {
+		return err
+	}
+	envelope.Ciphertext = aead.Seal(nil, envelope.Nonce, plaintext, envelopeData(envelope))
+	return nil
+}
+
+// decryptSecrets decrypts the secrets saved in an envelope. An error is
+// returned if the key is wrong or if the envelope has been modified.
+func decryptSecrets(envelope *secretsEnvelope, key []byte) (map[string]string, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != aead.NonceSize() {
+		return nil, errors.New("the secrets store is corrupted")
+	}
+
+	plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, envelopeData(envelope))
+	if err != nil {
+		return nil, errors.New("could not decrypt the secrets store. Is the passphrase or key file right?")
+	}
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// envelopeData returns the settings of an envelope, which are
+// authenticated along with the secrets.
+func envelopeData(envelope *secretsEnvelope) []byte {
+	return []byte(fmt.Sprintf("good-bot-secrets v%d %s %s %d %d %d", envelope.Version, envelope.KDF, base64.StdEncoding.EncodeToString(envelope.Salt), envelope.N, envelope.R, envelope.P))
+}
+
+// writeKeyFile creates a key file that contains a new random key. The
+// file is only readable by its owner. Lines starting with "#" are
+// comments.
+func writeKeyFile(keyPath string) error {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	var contents bytes.Buffer
+	fmt.Fprintf(&contents, "# created: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintln(&contents, "# good-bot-cli secrets key. Anyone with this file can decrypt your secrets.")
+	fmt.Fprintf(&contents, "%s%s\n", keyFilePrefix, base64.RawURLEncoding.EncodeToString(key))
+
+	return ioutil.WriteFile(keyPath, contents.Bytes(), 0600)
+}
+
+// readKeyFile reads the key saved in a key file created by writeKeyFile.
+func readKeyFile(keyPath string) ([]byte, error) {
+	processed, err := processPath(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(processed)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, keyFilePrefix) {
+			continue
+		}
+		key, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(line, keyFilePrefix))
+		if err != nil || len(key) != chacha20poly1305.KeySize {
+			return nil, fmt.Errorf("key file %s contains an invalid key", keyPath)
+		}
+		return key, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("key file %s does not contain a key", keyPath)
+}
+
+// sortedSecretNames returns the name of every secret, sorted.
+func sortedSecretNames(secrets map[string]string) []string {
+	var names []string
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// storePasswords decrypts the secrets from the store and returns them as
+// "NAME=value" strings, like the ones returned by parsePasswords. If the
+// store does not exist, no password is returned.
+func storePasswords() ([]string, error) {
+	store := getSecretsStore()
+	if !store.exists() {
+		return nil, nil
+	}
+
+	secrets, err := store.load(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var passwords []string
+	for _, name := range sortedSecretNames(secrets) {
+		passwords = append(passwords, name+"="+secrets[name])
+	}
+	return passwords, nil
+}
+
+// mergePasswords adds the passwords from the secrets store to the ones
+// from the passwords file. An error is returned if a password is defined
+// in both, since it's not clear which one should be used.
+func mergePasswords(passwords []string, stored []string) ([]string, error) {
+	defined := make(map[string]bool)
+	for _, password := range passwords {
+		defined[strings.SplitN(password, "=", 2)[0]] = true
+	}
+
+	merged := append([]string(nil), passwords...)
+	for _, password := range stored {
+		name := strings.SplitN(password, "=", 2)[0]
+		if defined[name] {
+			return nil, fmt.Errorf("password %s is defined in both your passwords file and your secrets store", name)
+		}
+		merged = append(merged, password)
+	}
+	return merged, nil
+}
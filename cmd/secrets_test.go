@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSecretsStorePassphrase saves secrets with a passphrase, and checks
+// that they can only be loaded again with the same passphrase.
+func TestSecretsStorePassphrase(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "secrets")
+	secrets := map[string]string{"DB_PASSWORD": "hunter2", "API_TOKEN": "t0k3n"}
+
+	os.Setenv(passphraseEnv, "correct horse")
+	defer os.Unsetenv(passphraseEnv)
+	if err := (&secretsStore{path: storePath}).save(secrets); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(contents), "hunter2") {
+		t.Error("the store contains a secret in plaintext")
+	}
+
+	got, err := (&secretsStore{path: storePath}).load(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, secrets) {
+		t.Errorf("load() = %v, want %v", got, secrets)
+	}
+
+	os.Setenv(passphraseEnv, "wrong horse")
+	if _, err := (&secretsStore{path: storePath}).load(false); err == nil {
+		t.Error("load() with the wrong passphrase did not return an error")
+	}
+}
+
+// TestSecretsStoreKeyFile saves secrets with a key file, and checks that
+// another key file can't load them.
+func TestSecretsStoreKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key.txt")
+	otherKeyPath := filepath.Join(dir, "other.txt")
+	for _, path := range []string{keyPath, otherKeyPath} {
+		if err := writeKeyFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	storePath := filepath.Join(dir, "secrets")
+	secrets := map[string]string{"DB_PASSWORD": "hunter2"}
+	if err := (&secretsStore{path: storePath, keyFile: keyPath}).save(secrets); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := (&secretsStore{path: storePath, keyFile: keyPath}).load(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, secrets) {
+		t.Errorf("load() = %v, want %v", got, secrets)
+	}
+
+	if _, err := (&secretsStore{path: storePath, keyFile: otherKeyPath}).load(false); err == nil {
+		t.Error("load() with the wrong key file did not return an error")
+	}
+	if _, err := (&secretsStore{path: storePath}).load(false); err == nil {
+		t.Error("load() without a key file did not return an error")
+	}
+}
+
+// TestSecretsStoreMissing checks that a store that does not exist is
+// only created when asked to.
+func TestSecretsStoreMissing(t *testing.T) {
+	store := &secretsStore{path: filepath.Join(t.TempDir(), "secrets")}
+	if _, err := store.load(false); err == nil {
+		t.Error("load(false) on a missing store did not return an error")
+	}
+	secrets, err := store.load(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 0 {
+		t.Errorf("load(true) on a missing store = %v, want an empty store", secrets)
+	}
+}
+
+// TestReadKeyFile checks that key files with comments are read, and that
+// invalid key files are rejected.
+func TestReadKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	var testCases = []struct {
+		name     string
+		contents string
+		wantErr  bool
+	}{
+		{"valid", "# a comment\n" + keyFilePrefix + "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\n", false},
+		{"short", keyFilePrefix + "AAAA\n", true},
+		{"empty", "# no key here\n", true},
+	}
+
+	for _, tc := range testCases {
+		keyPath := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(keyPath, []byte(tc.contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		key, err := readKeyFile(keyPath)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("readKeyFile(%s) error = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+		if !tc.wantErr && len(key) != 32 {
+			t.Errorf("readKeyFile(%s) returned a key of %d bytes", tc.name, len(key))
+		}
+	}
+}
+
+// TestMergePasswords checks that passwords from the store are added to
+// the ones from the passwords file, unless they are defined twice.
+func TestMergePasswords(t *testing.T) {
+	merged, err := mergePasswords([]string{"A=1"}, []string{"B=2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"A=1", "B=2"}; !reflect.DeepEqual(merged, want) {
+		t.Errorf("mergePasswords() = %v, want %v", merged, want)
+	}
+
+	if _, err := mergePasswords([]string{"A=1"}, []string{"A=2"}); err == nil {
+		t.Error("mergePasswords() with a duplicate did not return an error")
+	}
+}
+
+// TestSecretsStoreKeepsEncryption saves a store that uses a passphrase
+// with a key file configured, and checks that the store still uses a
+// passphrase unless a key file is chosen explicitly.
+func TestSecretsStoreKeepsEncryption(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key.txt")
+	if err := writeKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	storePath := filepath.Join(dir, "secrets")
+
+	os.Setenv(passphraseEnv, "correct horse")
+	defer os.Unsetenv(passphraseEnv)
+	if err := (&secretsStore{path: storePath}).save(map[string]string{"A": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &secretsStore{path: storePath, keyFile: keyPath}
+	secrets, err := store.load(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets["B"] = "2"
+	if err := store.save(secrets); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&secretsStore{path: storePath}).load(false); err != nil {
+		t.Errorf("the store does not use its passphrase anymore: %s", err)
+	}
+
+	// Choosing a key file switches the store to it.
+	store = &secretsStore{path: storePath, keyFile: keyPath, kdf: "key-file"}
+	if _, err := store.load(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.save(secrets); err != nil {
+		t.Fatal(err)
+	}
+	got, err := (&secretsStore{path: storePath, keyFile: keyPath}).load(false)
+	if err != nil || !reflect.DeepEqual(got, secrets) {
+		t.Errorf("load() with the key file = %v, %v, want %v", got, err, secrets)
+	}
+}
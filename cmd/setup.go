@@ -47,7 +47,11 @@ This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		dockerCheck()
-		runSetupCommand(args[0], "/project")
+		saveInfo, err := getProjectPath()
+		if err != nil {
+			log.Fatal(err)
+		}
+		runSetupCommand(args[0], "/project", saveInfo, true)
 	},
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
@@ -86,16 +90,19 @@ type projectSaveInfo struct {
 
 // runSetupCommand uses Good Bot's Docker image to set up the project. It pulls
 // the image on each run. The container's output is copied to the shell's
-// stdout and the container is started interactively. This allows the user to
-// answer the prompt when Good Bot asks for the name of the project.
+// stdout. If interactive is true, the container is started interactively.
+// This allows the user to answer Good Bot's prompts.
 //
 // filePath is the path towards the script file, and containerPath is the path
-// towards the file once it is mounted in the container.
+// towards the file once it is mounted in the container. The project is
+// written in saveInfo.Path, under saveInfo.Name.
 //
 // This function also uses the Docker SDK to mount the directory where the
-// configuration file is located.This is also where the project directory
-// will be created.
-func runSetupCommand(filePath string, containerPath string) {
+// configuration file is located, and the directory where the project will
+// be created.
+//
+// The path towards the project on the host is returned.
+func runSetupCommand(filePath string, containerPath string, saveInfo projectSaveInfo, interactive bool) string {
 
 	// Used later for i/o between container and shell
 	inout := make(chan []byte)
@@ -125,14 +132,9 @@ func runSetupCommand(filePath string, containerPath string) {
 
 	containerScriptPath := containerPath + "/" + scriptName
 	writeLoc := "/users-cwd"
-	projectPath, err := getProjectPath()
-
-	if err != nil {
-		log.Fatal(err)
-	}
 
-	containerWritePath := filepath.Join(writeLoc, projectPath.Name)
-	hostWritePath, err := filepath.Abs(projectPath.Path)
+	containerWritePath := filepath.Join(writeLoc, saveInfo.Name)
+	hostWritePath, err := filepath.Abs(saveInfo.Path)
 
 	if err != nil {
 		log.Fatal(err)
@@ -140,11 +142,11 @@ func runSetupCommand(filePath string, containerPath string) {
 
 	resp, err := cli.ContainerCreate(ctx, &container.Config{
 
-		AttachStdin:  true,
+		AttachStdin:  interactive,
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          true,
-		OpenStdin:    true,
+		OpenStdin:    interactive,
 		Cmd:          []string{"setup", "--project-path",containerWritePath, containerScriptPath},
 		Image:        "trickytroll/good-bot:latest",
 	}, &container.HostConfig{
@@ -172,11 +174,11 @@ func runSetupCommand(filePath string, containerPath string) {
 		panic(err)
 	}
 
-	// Need to attach since the user will be interacting with the container
+	// Need to attach since the user might be interacting with the container
 	waiter, err := cli.ContainerAttach(ctx, resp.ID, types.ContainerAttachOptions{
 		Stderr: true,
 		Stdout: true,
-		Stdin:  true,
+		Stdin:  interactive,
 		Stream: true,
 	})
 
@@ -188,26 +190,28 @@ func runSetupCommand(filePath string, containerPath string) {
 		panic(err)
 	}
 
-	go func() { // In a goroutine
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() { // Write terminal input to inout channel
-			inout <- []byte(scanner.Text())
-		}
-	}()
-
-	go func(w io.WriteCloser) { // In another goroutine
-		for {
-			data, ok := <-inout // Get terminal input from channel
-			if !ok {
-				fmt.Println("!ok")
-				w.Close()
-				return
+	if interactive {
+		go func() { // In a goroutine
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() { // Write terminal input to inout channel
+				inout <- []byte(scanner.Text())
 			}
+		}()
 
-			w.Write(append(data, '\n')) // Write input to `w`. `w` is a Conn interface.
-			// See https://pkg.go.dev/net#Conn
-		}
-	}(waiter.Conn)
+		go func(w io.WriteCloser) { // In another goroutine
+			for {
+				data, ok := <-inout // Get terminal input from channel
+				if !ok {
+					fmt.Println("!ok")
+					w.Close()
+					return
+				}
+
+				w.Write(append(data, '\n')) // Write input to `w`. `w` is a Conn interface.
+				// See https://pkg.go.dev/net#Conn
+			}
+		}(waiter.Conn)
+	}
 
 	statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
 	select {
@@ -225,6 +229,8 @@ func runSetupCommand(filePath string, containerPath string) {
 	}
 
 	stdcopy.StdCopy(os.Stdout, os.Stderr, out)
+
+	return filepath.Join(hostWritePath, saveInfo.Name)
 }
 
 // getProjectPath prompts the user for a project save path and a project
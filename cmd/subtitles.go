@@ -0,0 +1,197 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// subtitle is a caption of the final video. Times are in seconds since
+// the start of the video.
+type subtitle struct {
+	Start float64
+	End   float64
+	// Text is at most captionLines lines long.
+	Text string
+}
+
+// subtitlesName is the name, without an extension, of the subtitle files
+// written in the final directory.
+const subtitlesName string = "subtitles"
+
+// Sizes of the captions. Lines are kept short enough to be read at a
+// glance, like in most subtitles.
+const (
+	captionLineLength = 42
+	captionLines      = 2
+	// minCaptionLength is the length a caption needs to end with a
+	// sentence. Short sentences, like "Hi.", are shown with the next
+	// one.
+	minCaptionLength = 12
+)
+
+// buildSubtitles splits the narration of each action of a project into
+// captions. The captions of an action share the length of its
+// narration, in proportion to their number of characters, starting when
+// the action starts.
+//
+// If the length of a narration is not known, the length of its action
+// is used instead. Actions that are not narrated have no captions.
+func buildSubtitles(projectPath string, timelines []*sceneTimeline) ([]subtitle, error) {
+	var subtitles []subtitle
+	for _, timeline := range timelines {
+		scenePath := filepath.Join(projectPath, timeline.Scene)
+		for _, action := range timeline.Actions {
+			if action.Audio == "" {
+				continue
+			}
+			number, err := actionNumber(action.Name)
+			if err != nil {
+				return nil, err
+			}
+			captions := splitCaptions(actionNarration(scenePath, number), captionLineLength*captionLines)
+			if len(captions) == 0 {
+				continue
+			}
+
+			length := action.AudioDuration
+			if length <= 0 {
+				length = action.Duration
+			}
+			characters := 0
+			for _, caption := range captions {
+				characters += len([]rune(caption))
+			}
+
+			start := action.Start
+			read := 0
+			for _, caption := range captions {
+				read += len([]rune(caption))
+				end := action.Start + length*float64(read)/float64(characters)
+				subtitles = append(subtitles, subtitle{start, end, wrapCaption(caption, captionLineLength)})
+				start = end
+			}
+		}
+	}
+	return subtitles, nil
+}
+
+// splitCaptions splits a text into captions of at most maxLength
+// characters. Captions end with a sentence when they are at least
+// minCaptionLength characters long, so that a new sentence doesn't start
+// at the end of a caption. Words are never split, even if they are
+// longer than maxLength.
+func splitCaptions(text string, maxLength int) []string {
+	var captions []string
+	var current []string
+	length := 0
+	for _, word := range strings.Fields(text) {
+		wordLength := len([]rune(word))
+		if len(current) > 0 && length+1+wordLength > maxLength {
+			captions = append(captions, strings.Join(current, " "))
+			current, length = nil, 0
+		}
+		if len(current) > 0 {
+			length++
+		}
+		current = append(current, word)
+		length += wordLength
+
+		if strings.ContainsAny(word[len(word)-1:], ".!?") && length >= minCaptionLength {
+			captions = append(captions, strings.Join(current, " "))
+			current, length = nil, 0
+		}
+	}
+	if len(current) > 0 {
+		captions = append(captions, strings.Join(current, " "))
+	}
+	return captions
+}
+
+// wrapCaption splits a caption that is longer than lineLength in two
+// lines of about the same length.
+func wrapCaption(caption string, lineLength int) string {
+	runes := []rune(caption)
+	if len(runes) <= lineLength {
+		return caption
+	}
+	middle := len(runes) / 2
+	best := -1
+	for i, r := range runes {
+		if r == ' ' && (best == -1 || absInt(i-middle) < absInt(best-middle)) {
+			best = i
+		}
+	}
+	if best == -1 {
+		return caption
+	}
+	return string(runes[:best]) + "\n" + string(runes[best+1:])
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// writeSRT writes subtitles in the SubRip format.
+func writeSRT(subtitles []subtitle, srtPath string) error {
+	var output strings.Builder
+	for i, caption := range subtitles {
+		fmt.Fprintf(&output, "%d\n%s --> %s\n%s\n\n", i+1, subtitleTime(caption.Start, ","), subtitleTime(caption.End, ","), caption.Text)
+	}
+	return ioutil.WriteFile(srtPath, []byte(output.String()), 0644)
+}
+
+// writeVTT writes subtitles in the WebVTT format, which is the one used
+// by web browsers.
+func writeVTT(subtitles []subtitle, vttPath string) error {
+	var output strings.Builder
+	output.WriteString("WEBVTT\n\n")
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	for _, caption := range subtitles {
+		fmt.Fprintf(&output, "%s --> %s\n%s\n\n", subtitleTime(caption.Start, "."), subtitleTime(caption.End, "."), escape.Replace(caption.Text))
+	}
+	return ioutil.WriteFile(vttPath, []byte(output.String()), 0644)
+}
+
+// subtitleTime writes a time as hours, minutes, seconds and milliseconds.
+// SubRip separates the milliseconds with a comma, and WebVTT with a
+// period.
+func subtitleTime(seconds float64, separator string) string {
+	total := milliseconds(seconds)
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", total/3600000, total/60000%60, total/1000%60, separator, total%1000)
+}
+
+// writeSubtitles writes the subtitles of a project in its final
+// directory, in the SubRip and WebVTT formats. The path of the SubRip
+// file is returned.
+func writeSubtitles(projectPath string, timelines []*sceneTimeline) (string, error) {
+	subtitles, err := buildSubtitles(projectPath, timelines)
+	if err != nil {
+		return "", err
+	}
+	finalPath := filepath.Join(projectPath, "final")
+	srtPath := filepath.Join(finalPath, subtitlesName+".srt")
+	if err := writeSRT(subtitles, srtPath); err != nil {
+		return "", err
+	}
+	return srtPath, writeVTT(subtitles, filepath.Join(finalPath, subtitlesName+".vtt"))
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSplitCaptions splits narrations into captions.
+func TestSplitCaptions(t *testing.T) {
+	var testCases = []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"Hello, world.", []string{"Hello, world."}},
+		{"One two three four five six", []string{"One two three", "four five six"}},
+		{"One sentence. Another one.", []string{"One sentence.", "Another one."}},
+		{"Hi. A sentence.", []string{"Hi. A sentence."}},
+		{"Supercalifragilistic word", []string{"Supercalifragilistic", "word"}},
+	}
+	for _, tc := range testCases {
+		got := splitCaptions(tc.text, 15)
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") || len(got) != len(tc.want) {
+			t.Errorf("splitCaptions(%q) returned %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+// TestWrapCaption splits long captions in two lines.
+func TestWrapCaption(t *testing.T) {
+	var testCases = []struct {
+		caption, want string
+	}{
+		{"short", "short"},
+		{"one two three four", "one two\nthree four"},
+		{"a bb ccccccccccccc", "a bb\nccccccccccccc"},
+		{"nospacesatallhere", "nospacesatallhere"},
+	}
+	for _, tc := range testCases {
+		if got := wrapCaption(tc.caption, 10); got != tc.want {
+			t.Errorf("wrapCaption(%q) returned %q, want %q", tc.caption, got, tc.want)
+		}
+	}
+}
+
+// TestBuildSubtitles times the captions of the test scene with the
+// lengths of its narrations.
+func TestBuildSubtitles(t *testing.T) {
+	projectPath := copyTestScene(t)
+	readPath := filepath.Join(projectPath, "scene_1", "read", "read_2.txt")
+	if err := os.WriteFile(readPath, []byte("I can run commands. And this caption is long enough to be shown on two lines."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	timelines := []*sceneTimeline{{
+		Scene: "scene_1",
+		Actions: []timelineAction{
+			{Name: "commands_1", Start: 1, Duration: 3, Audio: "read_1.mp3", AudioDuration: 2},
+			{Name: "commands_2", Start: 5, Duration: 10, Audio: "read_2.mp3"},
+		},
+	}}
+
+	subtitles, err := buildSubtitles(projectPath, timelines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []subtitle{
+		{1, 3, "Hello, world."},
+		{5, 7.5, "I can run commands."},
+		{7.5, 15, "And this caption is long enough\nto be shown on two lines."},
+	}
+	if len(subtitles) != len(want) {
+		t.Fatalf("buildSubtitles returned %+v, want %+v", subtitles, want)
+	}
+	for i := range want {
+		if subtitles[i] != want[i] {
+			t.Errorf("subtitle %d is %+v, want %+v", i, subtitles[i], want[i])
+		}
+	}
+}
+
+// TestWriteSubtitles checks both subtitle formats.
+func TestWriteSubtitles(t *testing.T) {
+	subtitles := []subtitle{{0.5, 2.25, "Hello, <world>."}, {3723.5, 3725, "Second\ncaption"}}
+	dir := t.TempDir()
+
+	srtPath := filepath.Join(dir, "subtitles.srt")
+	if err := writeSRT(subtitles, srtPath); err != nil {
+		t.Fatal(err)
+	}
+	want := "1\n00:00:00,500 --> 00:00:02,250\nHello, <world>.\n\n2\n01:02:03,500 --> 01:02:05,000\nSecond\ncaption\n\n"
+	if got, _ := os.ReadFile(srtPath); string(got) != want {
+		t.Errorf("writeSRT wrote %q, want %q", got, want)
+	}
+
+	vttPath := filepath.Join(dir, "subtitles.vtt")
+	if err := writeVTT(subtitles, vttPath); err != nil {
+		t.Fatal(err)
+	}
+	want = "WEBVTT\n\n00:00:00.500 --> 00:00:02.250\nHello, &lt;world&gt;.\n\n01:02:03.500 --> 01:02:05.000\nSecond\ncaption\n\n"
+	if got, _ := os.ReadFile(vttPath); string(got) != want {
+		t.Errorf("writeVTT wrote %q, want %q", got, want)
+	}
+}
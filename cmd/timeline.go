@@ -0,0 +1,418 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/TrickyTroll/good-bot-cli/mp3"
+)
+
+// timelineAction is a single action of a scene's timeline. Times are in
+// seconds since the start of the final video.
+type timelineAction struct {
+	Name string `json:"name"`
+	// Title is the narration of the action, or its first command if it
+	// isn't narrated.
+	Title    string  `json:"title"`
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
+	// Audio is the path of the action's narration, if it has one.
+	Audio         string  `json:"audio,omitempty"`
+	AudioDuration float64 `json:"audio_duration,omitempty"`
+}
+
+// sceneTimeline lists when each action of a scene starts. The scene is
+// shown for as long as its asciicasts last.
+type sceneTimeline struct {
+	Scene    string           `json:"scene"`
+	Start    float64          `json:"start"`
+	Duration float64          `json:"duration"`
+	Actions  []timelineAction `json:"actions"`
+}
+
+// timelineName is the name of the file, in the final directory, that
+// contains the timeline of the final video.
+const timelineName string = "timeline.json"
+
+// chaptersName is the name of the file, in the final directory, that
+// contains the chapters of the final video in FFmpeg's metadata format.
+const chaptersName string = "chapters.txt"
+
+// actionNumber returns the number of an action from the name of one of
+// its files, such as "commands_2.cast" or "read_2.mp3".
+func actionNumber(fileName string) (int, error) {
+	stem := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	index := strings.LastIndex(stem, "_")
+	if index == -1 {
+		return 0, fmt.Errorf("%s is not the file of an action", fileName)
+	}
+	number, err := strconv.Atoi(stem[index+1:])
+	if err != nil {
+		return 0, fmt.Errorf("%s is not the file of an action", fileName)
+	}
+	return number, nil
+}
+
+// markProjectActions uses markAction on every asciicast of the provided
+// scenes, or of every scene if scenes is empty.
+func markProjectActions(projectPath string, scenes []int) error {
+	for _, castPath := range filterRecsPaths(getRecsPaths(projectPath), scenes) {
+		if err := markAction(castPath); err != nil {
+			return fmt.Errorf("could not mark the start of %s: %s", castPath, err)
+		}
+	}
+	return nil
+}
+
+// markAction adds a marker event at the start of the action recorded in
+// an asciicast, which is the time of its first event. The marker's label
+// is the name of the action, e.g. "commands_1". Asciicasts that already
+// have a marker for their action are left as they are.
+//
+// Markers move with the rest of the asciicast when it is edited, which
+// makes them a more reliable way to find where each action starts than
+// adding up the length of each asciicast.
+func markAction(castPath string) error {
+	cast, err := asciicast.ReadFile(castPath)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(castPath), filepath.Ext(castPath))
+	if _, ok := findMarker(cast, name); ok {
+		return nil
+	}
+
+	marker := asciicast.Event{Type: asciicast.Marker, Data: name}
+	if len(cast.Events) > 0 {
+		marker.Time = cast.Events[0].Time
+	}
+	cast.Events = append([]asciicast.Event{marker}, cast.Events...)
+	return cast.WriteFile(castPath)
+}
+
+// findMarker returns the time of the marker with the provided label.
+// False is returned if the recording has no such marker.
+func findMarker(cast *asciicast.Cast, label string) (float64, bool) {
+	for _, event := range cast.Events {
+		if event.Type == asciicast.Marker && event.Data == label {
+			return event.Time, true
+		}
+	}
+	return 0, false
+}
+
+// castTiming reads the length of an asciicast, and the time of the
+// marker of its action, like findMarker. The events are read one at a
+// time, so the asciicast is never kept in memory.
+func castTiming(castPath string) (length float64, marker float64, err error) {
+	name := strings.TrimSuffix(filepath.Base(castPath), filepath.Ext(castPath))
+	found := false
+	_, err = asciicast.ReadFileEvents(castPath, func(event asciicast.Event) error {
+		length = event.Time
+		if !found && event.Type == asciicast.Marker && event.Data == name {
+			marker, found = event.Time, true
+		}
+		return nil
+	})
+	return length, marker, err
+}
+
+// buildSceneTimeline lists the actions of a scene in the order they are
+// shown, starting start seconds after the beginning of the video. Each
+// action starts at the marker added by markAction when it was recorded.
+// Only asciicasts without a marker fall back to the start of the
+// asciicast, which is the length of the asciicasts before it. Each
+// action lasts until the next action starts.
+//
+// The narration of an action is the "read" audio file that has the same
+// number as the action's asciicast. Narrations are not required. Their
+// length is read from the mp3 file.
+func buildSceneTimeline(scenePath string, start float64) (*sceneTimeline, error) {
+	casts, numbers, err := sortedSceneCasts(scenePath)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline := &sceneTimeline{Scene: filepath.Base(scenePath), Start: start}
+	offset := start
+	for _, castPath := range casts {
+		length, marker, err := castTiming(castPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", castPath, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(castPath), filepath.Ext(castPath))
+
+		action := timelineAction{
+			Name:  name,
+			Title: actionTitle(scenePath, name, numbers[castPath]),
+			Start: offset + marker,
+		}
+		audioPath := filepath.Join(scenePath, "audio", fmt.Sprintf("read_%d.mp3", numbers[castPath]))
+		if _, err := os.Stat(audioPath); err == nil {
+			action.Audio = audioPath
+			action.AudioDuration, _ = audioDuration(audioPath)
+		}
+		timeline.Actions = append(timeline.Actions, action)
+		offset += length
+	}
+
+	timeline.Duration = offset - start
+	for i := range timeline.Actions {
+		end := offset
+		if i+1 < len(timeline.Actions) {
+			end = timeline.Actions[i+1].Start
+		}
+		timeline.Actions[i].Duration = end - timeline.Actions[i].Start
+	}
+	return timeline, nil
+}
+
+// sortedSceneCasts returns the asciicasts of a scene in the order of
+// their actions, along with the number of each action by asciicast.
+func sortedSceneCasts(scenePath string) ([]string, map[string]int, error) {
+	casts, err := getSceneCasts(scenePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	numbers := make(map[string]int)
+	for _, castPath := range casts {
+		if numbers[castPath], err = actionNumber(filepath.Base(castPath)); err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.SliceStable(casts, func(i, j int) bool {
+		return numbers[casts[i]] < numbers[casts[j]]
+	})
+	return casts, numbers, nil
+}
+
+// buildProjectTimeline uses buildSceneTimeline on every scene of a
+// project. Scenes are shown one after the other.
+func buildProjectTimeline(projectPath string) ([]*sceneTimeline, error) {
+	scenes, err := getProjectScenes(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	var timelines []*sceneTimeline
+	var start float64
+	for _, scene := range scenes {
+		timeline, err := buildSceneTimeline(filepath.Join(projectPath, scene), start)
+		if err != nil {
+			return nil, err
+		}
+		timelines = append(timelines, timeline)
+		start += timeline.Duration
+	}
+	return timelines, nil
+}
+
+// actionTitle returns the title of an action's chapter. The title is the
+// action's narration if it has one, its first command otherwise, or its
+// name if neither can be read.
+func actionTitle(scenePath string, name string, number int) string {
+	if title := actionNarration(scenePath, number); title != "" {
+		return title
+	}
+	if actions, err := parseSceneActions(scenePath); err == nil {
+		for _, action := range actions {
+			if action.name == name && len(action.commands) > 0 {
+				return action.commands[0].text
+			}
+		}
+	}
+	return name
+}
+
+// actionNarration returns the text read during an action, on a single
+// line. An empty string is returned if the action is not narrated.
+func actionNarration(scenePath string, number int) string {
+	text, err := ioutil.ReadFile(filepath.Join(scenePath, "read", fmt.Sprintf("read_%d.txt", number)))
+	if err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(string(text)), " ")
+}
+
+// audioDuration finds the length of an mp3 file, in seconds.
+func audioDuration(audioPath string) (float64, error) {
+	info, err := mp3.ReadFile(audioPath)
+	if err != nil {
+		return 0, fmt.Errorf("could not find the length of %s: %s", audioPath, err)
+	}
+	return info.Duration, nil
+}
+
+// writeChapters writes one chapter per action in FFmpeg's metadata
+// format. Chapters use milliseconds.
+func writeChapters(timelines []*sceneTimeline, chaptersPath string) error {
+	var chapters strings.Builder
+	chapters.WriteString(";FFMETADATA1\n")
+	for _, timeline := range timelines {
+		for _, action := range timeline.Actions {
+			fmt.Fprintf(&chapters, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+				milliseconds(action.Start), milliseconds(action.Start+action.Duration), escapeMetadata(action.Title))
+		}
+	}
+	return ioutil.WriteFile(chaptersPath, []byte(chapters.String()), 0644)
+}
+
+// escapeMetadata escapes the characters that have a meaning in FFmpeg's
+// metadata format.
+func escapeMetadata(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n").Replace(value)
+}
+
+// milliseconds converts a number of seconds to milliseconds.
+func milliseconds(seconds float64) int64 {
+	return int64(seconds*1000 + 0.5)
+}
+
+// narrationArgs returns FFmpeg's arguments to replace the audio of a
+// video with the narration of each action, starting when the action
+// starts, and to add chapters to it. If subtitlesPath is not empty, the
+// subtitles are also added to the video. If normalize is true, the
+// loudness of the narration is normalized. The result is written as
+// output.
+func narrationArgs(videoPath string, chaptersPath string, subtitlesPath string, outputPath string, timelines []*sceneTimeline, normalize bool) []string {
+	args := []string{"-y", "-v", "error", "-i", videoPath, "-f", "ffmetadata", "-i", chaptersPath}
+	inputs, filter := narrationFilter(timelines, 2, normalize)
+	args = append(args, inputs...)
+
+	subtitlesInput := len(inputs)/2 + 2
+	if subtitlesPath != "" {
+		args = append(args, "-i", subtitlesPath)
+	}
+
+	args = append(args, "-map", "0:v")
+	if filter != "" {
+		args = append(args, "-filter_complex", filter, "-map", "[narration]", "-c:a", "aac")
+	}
+	if subtitlesPath != "" {
+		// Mp4 files can only contain subtitles in the mov_text format.
+		args = append(args, "-map", fmt.Sprintf("%d:s", subtitlesInput), "-c:s", "mov_text")
+	}
+	return append(args, "-map_metadata", "1", "-map_chapters", "1", "-c:v", "copy", outputPath)
+}
+
+// narrationFilter returns FFmpeg's input arguments for the narration of
+// each action, and a filter that delays each of them until their action
+// starts and mixes them in a stream labeled "narration". The first
+// narration is FFmpeg's input number firstInput.
+//
+// If no action is narrated, the filter is empty.
+func narrationFilter(timelines []*sceneTimeline, firstInput int, normalize bool) ([]string, string) {
+	var inputs, filters []string
+	var labels string
+	for _, timeline := range timelines {
+		for _, action := range timeline.Actions {
+			if action.Audio == "" {
+				continue
+			}
+			input := len(filters) + firstInput
+			label := fmt.Sprintf("[n%d]", len(filters))
+			inputs = append(inputs, "-i", action.Audio)
+			filters = append(filters, fmt.Sprintf("[%d:a]adelay=delays=%d:all=1%s", input, milliseconds(action.Start), label))
+			labels += label
+		}
+	}
+	if len(filters) == 0 {
+		return nil, ""
+	}
+
+	mix := fmt.Sprintf("%samix=inputs=%d:normalize=0:dropout_transition=0", labels, len(filters))
+	if normalize {
+		// EBU R128 loudness, at the level recommended for online videos.
+		mix += ",loudnorm=I=-16:TP=-1.5:LRA=11"
+	}
+	return inputs, strings.Join(append(filters, mix+"[narration]"), ";")
+}
+
+// findFinalVideo returns the path of the mp4 video in a final directory.
+func findFinalVideo(finalPath string) (string, error) {
+	files, err := listFiles(finalPath)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if filepath.Ext(file) == ".mp4" {
+			return filepath.Join(finalPath, file), nil
+		}
+	}
+	return "", fmt.Errorf("no video found in %s", finalPath)
+}
+
+// alignNarration writes the timeline, chapters and subtitles of a
+// project in its final directory. If FFmpeg is installed, the narration
+// of the final video is then aligned with the start of each action, and
+// the chapters are added to the video, along with the subtitles if
+// withSubtitles is true. The loudness of the narration is normalized if
+// normalize is true. Without FFmpeg, the video is left as it is.
+func alignNarration(projectPath string, withSubtitles bool, normalize bool) error {
+	timelines, err := buildProjectTimeline(projectPath)
+	if err != nil {
+		return err
+	}
+
+	finalPath := filepath.Join(projectPath, "final")
+	if err := os.MkdirAll(finalPath, 0755); err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(timelines, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(finalPath, timelineName), append(contents, '\n'), 0644); err != nil {
+		return err
+	}
+	chaptersPath := filepath.Join(finalPath, chaptersName)
+	if err := writeChapters(timelines, chaptersPath); err != nil {
+		return err
+	}
+	subtitlesPath, err := writeSubtitles(projectPath, timelines)
+	if err != nil {
+		return err
+	}
+	if !withSubtitles {
+		subtitlesPath = ""
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		fmt.Printf("FFmpeg could not be found. The chapters and subtitles have been written in %s, but were not added to the video.\n", finalPath)
+		return nil
+	}
+	videoPath, err := findFinalVideo(finalPath)
+	if err != nil {
+		return err
+	}
+	alignedPath := strings.TrimSuffix(videoPath, ".mp4") + ".aligned.mp4"
+	output, err := exec.Command("ffmpeg", narrationArgs(videoPath, chaptersPath, subtitlesPath, alignedPath, timelines, normalize)...).CombinedOutput()
+	if err != nil {
+		os.Remove(alignedPath)
+		return fmt.Errorf("could not align the narration of %s: %s\n%s", videoPath, err, output)
+	}
+	return os.Rename(alignedPath, videoPath)
+}
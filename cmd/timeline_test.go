@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+)
+
+// copyTestScene copies the first scene of the test project in a new
+// project, so that its asciicasts can be modified.
+func copyTestScene(t *testing.T) string {
+	projectPath := t.TempDir()
+	if err := copyDir(filepath.Join(testData.testProject1, "scene_1"), filepath.Join(projectPath, "scene_1")); err != nil {
+		t.Fatalf("Test error: could not copy the test scene.\n%s", err)
+	}
+	return projectPath
+}
+
+// TestActionNumber reads the number of action files.
+func TestActionNumber(t *testing.T) {
+	var testCases = []struct {
+		fileName string
+		want     int
+		valid    bool
+	}{
+		{"commands_1.cast", 1, true},
+		{"read_12.mp3", 12, true},
+		{"commands_2", 2, true},
+		{"README.md", 0, false},
+		{"commands_two.cast", 0, false},
+	}
+	for _, tc := range testCases {
+		got, err := actionNumber(tc.fileName)
+		if tc.valid && (err != nil || got != tc.want) {
+			t.Errorf("actionNumber(%s) = %d, %v, want %d", tc.fileName, got, err, tc.want)
+		} else if !tc.valid && err == nil {
+			t.Errorf("actionNumber(%s) did not return an error", tc.fileName)
+		}
+	}
+}
+
+// TestMarkAction adds markers to the asciicasts of a scene, and makes
+// sure that they are only added once.
+func TestMarkAction(t *testing.T) {
+	projectPath := copyTestScene(t)
+	for i := 0; i < 2; i++ {
+		if err := markProjectActions(projectPath, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	castPath := filepath.Join(projectPath, "scene_1", "asciicasts", "commands_2.cast")
+	cast, err := asciicast.ReadFile(castPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	markers := 0
+	for _, event := range cast.Events {
+		if event.Type == asciicast.Marker {
+			markers++
+		}
+	}
+	if markers != 1 || cast.Events[0].Type != asciicast.Marker || cast.Events[0].Data != "commands_2" {
+		t.Errorf("%s has %d markers, and starts with %+v", castPath, markers, cast.Events[0])
+	}
+	if cast.Events[0].Time != cast.Events[1].Time {
+		t.Errorf("marker is at %v, want %v", cast.Events[0].Time, cast.Events[1].Time)
+	}
+}
+
+// TestBuildSceneTimeline builds the timeline of a scene once its actions
+// have been marked.
+func TestBuildSceneTimeline(t *testing.T) {
+	projectPath := copyTestScene(t)
+	if err := markProjectActions(projectPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	scenePath := filepath.Join(projectPath, "scene_1")
+	first, err := asciicast.ReadFile(filepath.Join(scenePath, "asciicasts", "commands_1.cast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := asciicast.ReadFile(filepath.Join(scenePath, "asciicasts", "commands_2.cast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeline, err := buildSceneTimeline(scenePath, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeline.Actions) != 2 {
+		t.Fatalf("timeline has %d actions, want 2", len(timeline.Actions))
+	}
+	if timeline.Start != 10 || timeline.Duration != first.Length()+second.Length() {
+		t.Errorf("timeline starts at %v and lasts %v, want 10 and %v", timeline.Start, timeline.Duration, first.Length()+second.Length())
+	}
+
+	action := timeline.Actions[1]
+	if action.Name != "commands_2" || action.Title != "I can run commands." {
+		t.Errorf("second action is %+v", action)
+	}
+	if want := 10 + first.Length() + second.Events[0].Time; action.Start != want {
+		t.Errorf("second action starts at %v, want %v", action.Start, want)
+	}
+	if filepath.Base(action.Audio) != "read_2.mp3" || math.Abs(action.AudioDuration-1.368) > 1e-6 {
+		t.Errorf("second action has narration %s lasting %vs, want read_2.mp3 lasting 1.368s", action.Audio, action.AudioDuration)
+	}
+	if end := action.Start + action.Duration; end != timeline.Start+timeline.Duration {
+		t.Errorf("second action ends at %v, want %v", end, timeline.Start+timeline.Duration)
+	}
+}
+
+// TestNarrationFollowsMarkers marks the actions of a scene, and delays
+// the second action inside its asciicast. Its narration should start at
+// its marker rather than at the start of its asciicast.
+func TestNarrationFollowsMarkers(t *testing.T) {
+	projectPath := copyTestScene(t)
+	if err := markProjectActions(projectPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	scenePath := filepath.Join(projectPath, "scene_1")
+	first, err := asciicast.ReadFile(filepath.Join(scenePath, "asciicasts", "commands_1.cast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondPath := filepath.Join(scenePath, "asciicasts", "commands_2.cast")
+	second, err := asciicast.ReadFile(secondPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range second.Events {
+		second.Events[i].Time += 2
+	}
+	if err := second.WriteFile(secondPath); err != nil {
+		t.Fatal(err)
+	}
+
+	timeline, err := buildSceneTimeline(scenePath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker, ok := findMarker(second, "commands_2")
+	if !ok {
+		t.Fatal("the second asciicast was not marked")
+	}
+	want := first.Length() + marker
+	if start := timeline.Actions[1].Start; start != want {
+		t.Errorf("second action starts at %v, want its marker at %v", start, want)
+	}
+
+	_, filter := narrationFilter([]*sceneTimeline{timeline}, 1, false)
+	if delay := fmt.Sprintf("adelay=delays=%d:", milliseconds(want)); !strings.Contains(filter, delay) {
+		t.Errorf("narration filter %q does not contain %q", filter, delay)
+	}
+}
+
+// TestWriteChapters writes the chapters of a timeline.
+func TestWriteChapters(t *testing.T) {
+	timelines := []*sceneTimeline{{Actions: []timelineAction{
+		{Title: "Hello, world.", Start: 0, Duration: 1.5},
+		{Title: "echo a=b; ls", Start: 1.5, Duration: 2.25},
+	}}}
+	chaptersPath := filepath.Join(t.TempDir(), chaptersName)
+	if err := writeChapters(timelines, chaptersPath); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(chaptersPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `;FFMETADATA1
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=1500
+title=Hello, world.
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=1500
+END=3750
+title=echo a\=b\; ls
+`
+	if string(contents) != want {
+		t.Errorf("chapters are:\n%s\nwant:\n%s", contents, want)
+	}
+}
+
+// TestNarrationArgs makes sure that each narration is delayed until its
+// action starts.
+func TestNarrationArgs(t *testing.T) {
+	timelines := []*sceneTimeline{
+		{Actions: []timelineAction{{Start: 0.5, Audio: "read_1.mp3"}, {Start: 2}}},
+		{Actions: []timelineAction{{Start: 4.25, Audio: "read_3.mp3"}}},
+	}
+	args := strings.Join(narrationArgs("final.mp4", "chapters.txt", "", "out.mp4", timelines, false), " ")
+
+	for _, want := range []string{
+		"-i final.mp4 -f ffmetadata -i chapters.txt -i read_1.mp3 -i read_3.mp3",
+		"[2:a]adelay=delays=500:all=1[n0];[3:a]adelay=delays=4250:all=1[n1];[n0][n1]amix=inputs=2",
+		"-map 0:v",
+		"-map [narration]",
+		"-map_chapters 1",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("arguments %q do not contain %q", args, want)
+		}
+	}
+	if !strings.HasSuffix(args, "out.mp4") {
+		t.Errorf("arguments %q do not end with the output", args)
+	}
+	if strings.Contains(args, "mov_text") {
+		t.Errorf("arguments %q add subtitles that were not provided", args)
+	}
+
+	// Subtitles come after every narration.
+	args = strings.Join(narrationArgs("final.mp4", "chapters.txt", "subtitles.srt", "out.mp4", timelines, false), " ")
+	if want := "-i read_3.mp3 -i subtitles.srt -map 0:v"; !strings.Contains(args, want) {
+		t.Errorf("arguments %q do not contain %q", args, want)
+	}
+	if want := "-map 4:s -c:s mov_text"; !strings.Contains(args, want) {
+		t.Errorf("arguments %q do not contain %q", args, want)
+	}
+	// The loudness is normalized after the narrations are mixed.
+	args = strings.Join(narrationArgs("final.mp4", "chapters.txt", "", "out.mp4", timelines, true), " ")
+	if want := "dropout_transition=0,loudnorm=I=-16:TP=-1.5:LRA=11[narration]"; !strings.Contains(args, want) {
+		t.Errorf("arguments %q do not contain %q", args, want)
+	}
+}
@@ -0,0 +1,390 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Engines that can be selected with --video-engine to make the final
+// video from the gifs. The container engine uses Good Bot's Docker
+// image, and the FFmpeg engine calls a local ffmpeg binary.
+const (
+	containerEngine = "container"
+	ffmpegEngine    = "ffmpeg"
+)
+
+// videoSettings are the controls of the FFmpeg engine.
+type videoSettings struct {
+	Codec  string
+	CRF    int
+	FPS    int
+	Width  int
+	Height int
+}
+
+// videoClip is a gif shown in the final video, for as long as the
+// asciicast it was rendered from lasts.
+type videoClip struct {
+	Path     string
+	Duration float64
+}
+
+// makeVideo renders the final video of a project with the engine
+// selected with --video-engine, and then aligns its narration with
+// alignNarration. Errors are logged, since the gifs have already been
+// rendered.
+//
+// The final video is only rendered again when one of the scenes of the
+// project changed, or when the settings of the video changed, unless
+// --force is used. See currentVideoMetadata for more information.
+func makeVideo(projectPath string) {
+	finalPath := filepath.Join(projectPath, "final")
+	metadataPath := filepath.Join(finalPath, finalMetadataName)
+	if _, err := findFinalVideo(finalPath); err == nil && !forceRender {
+		metadata, err := finalVideoMetadata(projectPath)
+		if err != nil {
+			log.Printf("Could not check whether the final video is up to date.\n%s", err)
+		} else if changed := changedScenes(metadataPath, metadata); len(changed) == 0 {
+			fmt.Println("The final video is up to date.")
+			return
+		} else {
+			fmt.Printf("Rendering the final video again, since %s changed.\n", strings.Join(changed, ", "))
+		}
+	}
+
+	if videoEngine == ffmpegEngine {
+		if _, err := composeVideo(projectPath); err != nil {
+			log.Printf("Could not render the video.\n%s", err)
+			return
+		}
+	} else {
+		renderVideo(projectPath)
+	}
+	if err := alignNarration(projectPath, muxSubtitles, normalizeAudio); err != nil {
+		log.Printf("Could not align the narration of the video.\n%s", err)
+		return
+	}
+
+	// The scenes are described again, in case rendering the video
+	// changed one of their files.
+	metadata, err := finalVideoMetadata(projectPath)
+	if err == nil {
+		err = writeMetadata(metadataPath, metadata)
+	}
+	if err != nil {
+		log.Printf("Could not save what the final video was made from.\n%s", err)
+	}
+}
+
+// finalVideoMetadata describes the current state of every scene of a
+// project, and the settings of its final video.
+func finalVideoMetadata(projectPath string) (*videoMetadata, error) {
+	scenes, err := getProjectScenes(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := currentVideoMetadata(projectPath, scenes, videoEngine == ffmpegEngine)
+	if err != nil {
+		return nil, err
+	}
+	metadata.Settings["engine"] = videoEngine
+	metadata.Settings["subtitles"] = fmt.Sprint(muxSubtitles)
+	return metadata, nil
+}
+
+// composeVideo uses a local FFmpeg binary to render the final video of
+// a project from the gifs of its scenes. Each gif is scaled to the
+// resolution selected with --resolution, and is shown for as long as
+// its asciicast lasts. The video has no sound, since the narration is
+// added by alignNarration.
+//
+// The final video is written in the projectPath/final directory, and
+// its path is returned.
+func composeVideo(projectPath string) (string, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return "", errors.New("FFmpeg could not be found, it is needed by the ffmpeg video engine")
+	}
+	settings, err := currentVideoSettings()
+	if err != nil {
+		return "", err
+	}
+	clips, err := projectClips(projectPath)
+	if err != nil {
+		return "", err
+	}
+	if len(clips) == 0 {
+		return "", fmt.Errorf("found no gifs to put in the video of %s", projectPath)
+	}
+
+	absPath, err := filepath.Abs(projectPath)
+	if err != nil {
+		return "", err
+	}
+	finalPath := filepath.Join(absPath, "final")
+	if err := os.MkdirAll(finalPath, 0755); err != nil {
+		return "", err
+	}
+	outputPath := filepath.Join(finalPath, filepath.Base(absPath)+".mp4")
+
+	fmt.Printf("Rendering %s with FFmpeg\n", outputPath)
+	output, err := exec.Command("ffmpeg", videoArgs(clips, outputPath, settings)...).CombinedOutput()
+	if err != nil {
+		os.Remove(outputPath)
+		return "", fmt.Errorf("could not render %s: %s\n%s", outputPath, err, output)
+	}
+	fmt.Printf("Rendered %s\n", outputPath)
+	return outputPath, nil
+}
+
+// renderSceneVideos uses a local FFmpeg binary to render a video of
+// each scene of a project, with its narration, from the gifs of the
+// scene. The videos use the settings of the FFmpeg engine, and are
+// written in each scene's mp4 directory, named after the scene.
+//
+// A video is only rendered again when its scene or its settings
+// changed, unless --force is used. If scenes is not empty, only the
+// scenes with those numbers are rendered. Errors are logged, so that
+// one scene doesn't stop the others from being rendered.
+func renderSceneVideos(projectPath string, scenes []int) {
+	settings, err := currentVideoSettings()
+	if err != nil {
+		log.Printf("Could not render the videos of the scenes.\n%s", err)
+		return
+	}
+	selected, err := selectScenes(projectPath, scenes)
+	if err != nil {
+		log.Printf("Could not render the videos of the scenes.\n%s", err)
+		return
+	}
+	for _, scene := range selected {
+		scenePath := filepath.Join(projectPath, scene)
+		outputPath := filepath.Join(scenePath, mp4Path, scene+".mp4")
+		metadata, err := currentVideoMetadata(projectPath, []string{scene}, true)
+		if err != nil {
+			log.Printf("Could not render the video of %s.\n%s", scene, err)
+			continue
+		}
+		if _, err := os.Stat(outputPath); err == nil && !forceRender && len(changedScenes(metadataPath(outputPath), metadata)) == 0 {
+			fmt.Printf("%s is up to date\n", outputPath)
+			continue
+		}
+
+		if _, err := renderSceneVideo(scenePath, settings); err != nil {
+			log.Printf("Could not render the video of %s.\n%s", scene, err)
+			continue
+		}
+		if err := writeMetadata(metadataPath(outputPath), metadata); err != nil {
+			log.Printf("Could not save what the video of %s was made from.\n%s", scene, err)
+		}
+		fmt.Printf("Rendered %s\n", outputPath)
+	}
+}
+
+// renderSceneVideo renders the video of a single scene, and returns its
+// path. See renderSceneVideos for more information.
+func renderSceneVideo(scenePath string, settings videoSettings) (string, error) {
+	clips, err := sceneClips(scenePath)
+	if err != nil {
+		return "", err
+	}
+	if len(clips) == 0 {
+		return "", fmt.Errorf("found no gifs in %s", scenePath)
+	}
+	timeline, err := buildSceneTimeline(scenePath, 0)
+	if err != nil {
+		return "", err
+	}
+
+	outputDir := filepath.Join(scenePath, mp4Path)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", err
+	}
+	outputPath := filepath.Join(outputDir, filepath.Base(scenePath)+".mp4")
+	args := sceneVideoArgs(clips, timeline, outputPath, settings, normalizeAudio)
+	if output, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		os.Remove(outputPath)
+		return "", fmt.Errorf("could not render %s: %s\n%s", outputPath, err, output)
+	}
+	return outputPath, nil
+}
+
+// projectClips returns the gif of every action of a project, in the
+// order they are shown in the final video. See sceneClips for more
+// information.
+func projectClips(projectPath string) ([]videoClip, error) {
+	scenes, err := getProjectScenes(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	var clips []videoClip
+	for _, scene := range scenes {
+		found, err := sceneClips(filepath.Join(projectPath, scene))
+		if err != nil {
+			return nil, err
+		}
+		clips = append(clips, found...)
+	}
+	return clips, nil
+}
+
+// sceneClips returns the gif of every action of a scene, in order. Each
+// gif is found in the gifs directory of the scene, and is named after
+// its asciicast.
+func sceneClips(scenePath string) ([]videoClip, error) {
+	casts, _, err := sortedSceneCasts(scenePath)
+	if err != nil {
+		return nil, err
+	}
+	var clips []videoClip
+	for _, castPath := range casts {
+		length, _, err := castTiming(castPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", castPath, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(castPath), filepath.Ext(castPath))
+		gifPath := filepath.Join(scenePath, renderPath, name+".gif")
+		if _, err := os.Stat(gifPath); err != nil {
+			return nil, fmt.Errorf("could not find the gif of %s: %s", castPath, err)
+		}
+		clips = append(clips, videoClip{Path: gifPath, Duration: length})
+	}
+	return clips, nil
+}
+
+// videoArgs returns FFmpeg's arguments to put clips one after the other
+// in a video without sound, written as output. See videoFilter for more
+// information.
+func videoArgs(clips []videoClip, outputPath string, settings videoSettings) []string {
+	inputs, filter := videoFilter(clips, settings)
+	args := append([]string{"-y", "-v", "error"}, inputs...)
+	args = append(args, "-filter_complex", filter, "-map", "[video]")
+	return append(args, encodingArgs(settings, outputPath)...)
+}
+
+// sceneVideoArgs returns FFmpeg's arguments to put the clips of a scene
+// one after the other in a video, along with the narration of each
+// action, starting when the action starts. The loudness of the
+// narration is normalized if normalize is true.
+func sceneVideoArgs(clips []videoClip, timeline *sceneTimeline, outputPath string, settings videoSettings, normalize bool) []string {
+	inputs, filter := videoFilter(clips, settings)
+	narrationInputs, narration := narrationFilter([]*sceneTimeline{timeline}, len(clips), normalize)
+	args := append([]string{"-y", "-v", "error"}, inputs...)
+	args = append(args, narrationInputs...)
+	if narration != "" {
+		filter += ";" + narration
+	}
+	args = append(args, "-filter_complex", filter, "-map", "[video]")
+	if narration != "" {
+		args = append(args, "-map", "[narration]", "-c:a", "aac")
+	}
+	return append(args, encodingArgs(settings, outputPath)...)
+}
+
+// videoFilter returns FFmpeg's input arguments for each clip, and a
+// filter that puts them one after the other in a stream labeled
+// "video".
+//
+// Each clip is scaled to fit the video's resolution, and centered over
+// a black background. Clips that end before their duration keep showing
+// their last frame, so that the video stays aligned with the timeline.
+func videoFilter(clips []videoClip, settings videoSettings) ([]string, string) {
+	var inputs, filters []string
+	var labels string
+	for i, clip := range clips {
+		inputs = append(inputs, "-i", clip.Path)
+		label := fmt.Sprintf("[v%d]", i)
+		filters = append(filters, fmt.Sprintf(
+			"[%d:v]fps=%d,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,"+
+				"tpad=stop_mode=clone:stop=-1,trim=duration=%s,setpts=PTS-STARTPTS,format=yuv420p%s",
+			i, settings.FPS, settings.Width, settings.Height, settings.Width, settings.Height,
+			strconv.FormatFloat(clip.Duration, 'f', 3, 64), label,
+		))
+		labels += label
+	}
+	filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=0[video]", labels, len(clips)))
+	return inputs, strings.Join(filters, ";")
+}
+
+// encodingArgs returns FFmpeg's arguments to encode a video with the
+// provided settings, and write it as output.
+func encodingArgs(settings videoSettings, outputPath string) []string {
+	return []string{
+		"-c:v", settings.Codec,
+		"-crf", strconv.Itoa(settings.CRF),
+		"-pix_fmt", "yuv420p",
+		"-r", strconv.Itoa(settings.FPS),
+		"-movflags", "+faststart",
+		outputPath,
+	}
+}
+
+// currentVideoSettings returns the settings of the FFmpeg engine that
+// were selected with the command's flags.
+func currentVideoSettings() (videoSettings, error) {
+	width, height, err := parseResolution(videoResolution)
+	if err != nil {
+		return videoSettings{}, err
+	}
+	return videoSettings{Codec: videoCodec, CRF: videoCRF, FPS: videoFPS, Width: width, Height: height}, nil
+}
+
+// parseResolution reads a resolution such as "1280x720". Both sizes
+// should be even, since most codecs can't encode odd sizes.
+func parseResolution(resolution string) (int, int, error) {
+	parts := strings.Split(strings.ToLower(resolution), "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid resolution '%s', use WIDTHxHEIGHT", resolution)
+	}
+	width, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid resolution '%s', use WIDTHxHEIGHT", resolution)
+	}
+	height, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid resolution '%s', use WIDTHxHEIGHT", resolution)
+	}
+	if width <= 0 || height <= 0 || width%2 != 0 || height%2 != 0 {
+		return 0, 0, fmt.Errorf("invalid resolution '%s', both sizes should be even and positive", resolution)
+	}
+	return width, height, nil
+}
+
+// checkVideoEngine makes sure that the engine selected with
+// --video-engine exists, and that its settings can be used.
+func checkVideoEngine() error {
+	if videoEngine != containerEngine && videoEngine != ffmpegEngine {
+		return fmt.Errorf("unknown video engine '%s', use '%s' or '%s'", videoEngine, containerEngine, ffmpegEngine)
+	}
+	if videoCRF < 0 || videoCRF > 51 {
+		return errors.New("the CRF should be between 0 and 51")
+	}
+	if videoFPS < 1 {
+		return errors.New("the frame rate should be at least 1")
+	}
+	if videoCodec == "" {
+		return errors.New("the codec can't be empty")
+	}
+	_, _, err := parseResolution(videoResolution)
+	return err
+}
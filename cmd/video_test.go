@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestProjectClips finds the gif of each action, in order, and shows
+// them for as long as their asciicast lasts.
+func TestProjectClips(t *testing.T) {
+	projectPath := copyTestScene(t)
+	writeShortCast(t, projectPath)
+
+	if _, err := projectClips(projectPath); err == nil {
+		t.Error("projectClips did not return an error for gifs that were not rendered")
+	}
+
+	gifsPath := filepath.Join(projectPath, "scene_1", renderPath)
+	if err := os.MkdirAll(gifsPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"commands_1.gif", "commands_2.gif"} {
+		if err := ioutil.WriteFile(filepath.Join(gifsPath, name), []byte("GIF89a"), 0644); err != nil {
+			t.Fatalf("Test error: could not write to file.\n%s", err)
+		}
+	}
+	clips, err := projectClips(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clips) != 2 {
+		t.Fatalf("found clips %+v, want 2", clips)
+	}
+	if filepath.Base(clips[0].Path) != "commands_1.gif" || filepath.Base(clips[1].Path) != "commands_2.gif" {
+		t.Errorf("found clips %+v, want commands_1.gif and commands_2.gif", clips)
+	}
+	if clips[1].Duration != 0.5 {
+		t.Errorf("commands_2.gif lasts %vs, want 0.5s", clips[1].Duration)
+	}
+}
+
+// TestVideoArgs makes sure that each clip is scaled to the video's
+// resolution and lasts as long as its asciicast.
+func TestVideoArgs(t *testing.T) {
+	clips := []videoClip{{"a.gif", 1.5}, {"b.gif", 0.25}}
+	settings := videoSettings{Codec: "libx265", CRF: 28, FPS: 30, Width: 640, Height: 360}
+	args := strings.Join(videoArgs(clips, "out.mp4", settings), " ")
+
+	for _, want := range []string{
+		"-i a.gif -i b.gif",
+		"[0:v]fps=30,scale=640:360:force_original_aspect_ratio=decrease,pad=640:360:",
+		"trim=duration=1.500,",
+		"[1:v]fps=30,",
+		"trim=duration=0.250,",
+		"[v0][v1]concat=n=2:v=1:a=0[video]",
+		"-map [video] -c:v libx265 -crf 28",
+		"-r 30",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("arguments %q do not contain %q", args, want)
+		}
+	}
+	if !strings.HasSuffix(args, "out.mp4") {
+		t.Errorf("arguments %q do not end with the output", args)
+	}
+}
+
+// TestSceneVideoArgs makes sure that the video of a scene has its
+// narration.
+func TestSceneVideoArgs(t *testing.T) {
+	clips := []videoClip{{"a.gif", 1.5}, {"b.gif", 0.25}}
+	timeline := &sceneTimeline{Actions: []timelineAction{{Start: 0.5, Audio: "read_1.mp3"}, {Start: 1.5}}}
+	settings := videoSettings{Codec: "libx264", CRF: 23, FPS: 25, Width: 1280, Height: 720}
+	args := strings.Join(sceneVideoArgs(clips, timeline, "scene_1.mp4", settings, false), " ")
+
+	for _, want := range []string{
+		"-i a.gif -i b.gif -i read_1.mp3",
+		"[v0][v1]concat=n=2:v=1:a=0[video];[2:a]adelay=delays=500:all=1[n0]",
+		"-map [video] -map [narration] -c:a aac",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("arguments %q do not contain %q", args, want)
+		}
+	}
+
+	// Scenes without narration have no sound.
+	timeline.Actions[0].Audio = ""
+	args = strings.Join(sceneVideoArgs(clips, timeline, "scene_1.mp4", settings, false), " ")
+	if strings.Contains(args, "narration") {
+		t.Errorf("arguments %q add a narration that doesn't exist", args)
+	}
+}
+
+// TestParseResolution reads valid and invalid resolutions.
+func TestParseResolution(t *testing.T) {
+	var testCases = []struct {
+		resolution    string
+		width, height int
+		valid         bool
+	}{
+		{"1280x720", 1280, 720, true},
+		{"1920X1080", 1920, 1080, true},
+		{"1281x720", 0, 0, false},
+		{"0x720", 0, 0, false},
+		{"720p", 0, 0, false},
+		{"ax720", 0, 0, false},
+	}
+	for _, tc := range testCases {
+		width, height, err := parseResolution(tc.resolution)
+		if (err == nil) != tc.valid {
+			t.Errorf("parseResolution(%q) returned error %v, want valid: %v", tc.resolution, err, tc.valid)
+			continue
+		}
+		if width != tc.width || height != tc.height {
+			t.Errorf("parseResolution(%q) = %dx%d, want %dx%d", tc.resolution, width, height, tc.width, tc.height)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"gopkg.in/yaml.v2"
+)
+
+// watchInterval is how often the watchdog checks the asciicasts that
+// are being recorded.
+var watchInterval = time.Second
+
+// actionCommand is a single command typed by Good Bot during an action.
+type actionCommand struct {
+	text string
+	// The name of the password typed by the command, if any. Passwords
+	// are never printed, so they can't be found in asciicasts.
+	password string
+}
+
+// sceneAction stores the information from one of the command files of
+// a scene. Each command is followed by what Good Bot expects to be
+// printed before typing the next command.
+type sceneAction struct {
+	name     string
+	commands []actionCommand
+	expect   []string
+	// How long Good Bot can wait for what it expects. Zero means
+	// that the default timeout is used.
+	timeout time.Duration
+}
+
+// recordTimeoutError is returned when Good Bot waited longer than the
+// timeout for something to be printed during a recording.
+type recordTimeoutError struct {
+	scene    string
+	action   string
+	command  string
+	expect   string
+	timeout  time.Duration
+	castPath string
+}
+
+func (e *recordTimeoutError) Error() string {
+	var message string
+	if e.command == "" {
+		message = fmt.Sprintf("%s timed out after %s in %s before its first command was typed", e.scene, e.timeout, e.action)
+	} else {
+		message = fmt.Sprintf("%s timed out after %s in %s, after command %q", e.scene, e.timeout, e.action, e.command)
+		if e.expect != "" {
+			message += fmt.Sprintf(" while expecting %q", e.expect)
+		}
+	}
+	if e.castPath != "" {
+		message += fmt.Sprintf(". The partial asciicast has been kept as %s", e.castPath)
+	}
+	return message
+}
+
+// parseSceneActions reads every command file of a scene. Command files
+// are YAML documents that contain the "commands" and "expect" lists of an
+// action, and optionally a "timeout". The timeout can either be a number
+// of seconds or a duration such as "1m30s".
+//
+// Actions are returned in the order they are recorded.
+func parseSceneActions(scenePath string) ([]sceneAction, error) {
+	files, err := listFiles(filepath.Join(scenePath, "commands"))
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []sceneAction
+	for _, file := range files {
+		contents, err := os.ReadFile(filepath.Join(scenePath, "commands", file))
+		if err != nil {
+			return nil, err
+		}
+
+		var raw struct {
+			Commands []interface{} `yaml:"commands"`
+			Expect   []string      `yaml:"expect"`
+			Timeout  interface{}   `yaml:"timeout"`
+		}
+		if err := yaml.Unmarshal(contents, &raw); err != nil {
+			return nil, fmt.Errorf("could not read command file %s: %s", file, err)
+		}
+
+		action := sceneAction{name: file, expect: raw.Expect}
+		for _, command := range raw.Commands {
+			switch value := command.(type) {
+			case map[interface{}]interface{}:
+				if name, ok := value["password"]; ok {
+					action.commands = append(action.commands, actionCommand{fmt.Sprintf("password: %v", name), fmt.Sprint(name)})
+					continue
+				}
+				action.commands = append(action.commands, actionCommand{fmt.Sprint(value), ""})
+			default:
+				action.commands = append(action.commands, actionCommand{fmt.Sprint(value), ""})
+			}
+		}
+
+		switch value := raw.Timeout.(type) {
+		case nil:
+		case int:
+			action.timeout = time.Duration(value) * time.Second
+		case float64:
+			action.timeout = time.Duration(value * float64(time.Second))
+		case string:
+			action.timeout, err = time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("command file %s has an invalid timeout: %s", file, err)
+			}
+		default:
+			return nil, fmt.Errorf("command file %s has an invalid timeout: %v", file, value)
+		}
+
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// watchRecording watches the asciicasts written in the provided scenes
+// while they are being recorded. The asciicast that was modified last is
+// considered to be the one that is being recorded.
+//
+// The timer is only armed once the asciicast of an action has been
+// created, so that starting the container doesn't count, and it is reset
+// each time a new command from that action is printed. Once the last
+// command of an action and its expected output have been printed, the
+// timer is stopped until the next action's asciicast is created. If Good
+// Bot waits longer than the action's timeout, or defaultTimeout if the
+// action has none, an error is sent on the returned channel and the
+// watch stops. The asciicast is copied in the scene's
+// "logs" directory before the error is sent, so that it can be inspected
+// even if the scene is recorded again.
+//
+// The watch also stops when ctx is done. If no timeout is set at all,
+// nil is returned, which is a channel that never receives anything.
+func watchRecording(ctx context.Context, scenePaths []string, defaultTimeout time.Duration) <-chan error {
+	actions := make(map[string][]sceneAction)
+	hasTimeout := defaultTimeout > 0
+	for _, scenePath := range scenePaths {
+		sceneActions, err := parseSceneActions(scenePath)
+		if err != nil {
+			// The recording can still go on without a watchdog.
+			fmt.Printf("Could not watch scene %s for timeouts.\n%s\n", scenePath, err)
+			continue
+		}
+		for _, action := range sceneActions {
+			hasTimeout = hasTimeout || action.timeout > 0
+		}
+		actions[scenePath] = sceneActions
+	}
+	if !hasTimeout {
+		return nil
+	}
+
+	timedOut := make(chan error, 1)
+	started := time.Now().Add(-modTimeSlack)
+
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		var current string
+		progress := -1
+		lastChange := time.Now()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			scenePath, castPath := latestCast(scenePaths, started)
+			if castPath == "" {
+				continue
+			}
+			action, found := findAction(actions[scenePath], castPath)
+
+			newProgress := 0
+			finished := false
+			if found {
+				output := castOutput(castPath)
+				newProgress = typedCommands(action, output)
+				finished = actionFinished(action, output)
+			}
+			if castPath != current || newProgress != progress {
+				current = castPath
+				progress = newProgress
+				lastChange = time.Now()
+				continue
+			}
+			if finished {
+				lastChange = time.Now()
+				continue
+			}
+
+			timeout := defaultTimeout
+			if found && action.timeout > 0 {
+				timeout = action.timeout
+			}
+			if timeout <= 0 || time.Since(lastChange) < timeout {
+				continue
+			}
+
+			err := &recordTimeoutError{
+				scene:    filepath.Base(scenePath),
+				action:   strings.TrimSuffix(filepath.Base(castPath), filepath.Ext(castPath)),
+				timeout:  timeout,
+				castPath: keepPartialCast(scenePath, castPath),
+			}
+			if progress > 0 {
+				err.command = action.commands[progress-1].text
+				if progress-1 < len(action.expect) {
+					err.expect = action.expect[progress-1]
+				}
+			}
+			timedOut <- err
+			return
+		}
+	}()
+
+	return timedOut
+}
+
+// latestCast finds the asciicast that was modified last in the provided
+// scenes. Asciicasts modified before since are ignored. The path towards
+// the scene and towards the asciicast are returned, or empty strings if
+// no asciicast could be found.
+func latestCast(scenePaths []string, since time.Time) (string, string) {
+	var latestScene string
+	var latestPath string
+	var latestTime time.Time
+
+	for _, scenePath := range scenePaths {
+		casts, err := getSceneCasts(scenePath)
+		if err != nil {
+			continue
+		}
+		for _, castPath := range casts {
+			info, err := os.Stat(castPath)
+			if err != nil || info.ModTime().Before(since) {
+				continue
+			}
+			if info.ModTime().After(latestTime) {
+				latestScene, latestPath, latestTime = scenePath, castPath, info.ModTime()
+			}
+		}
+	}
+	return latestScene, latestPath
+}
+
+// findAction returns the action that is recorded in an asciicast. Each
+// asciicast has the same name as the command file of its action.
+func findAction(actions []sceneAction, castPath string) (sceneAction, bool) {
+	name := strings.TrimSuffix(filepath.Base(castPath), filepath.Ext(castPath))
+	for _, action := range actions {
+		if action.name == name {
+			return action, true
+		}
+	}
+	return sceneAction{}, false
+}
+
+// escapeSequences matches the ANSI escape sequences that a terminal uses
+// to move the cursor or change colors.
+var escapeSequences = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]|\x1b[()][0-9A-Za-z]|\r`)
+
+// castOutput returns everything that was printed in an asciicast, without
+// escape sequences. Good Bot sometimes makes typos on purpose and then
+// erases them, so backspaces are applied to the output. The asciicast can
+// be incomplete, since it might still be recording. Lines that can't be
+// unmarshalled are ignored.
+func castOutput(castPath string) string {
+	file, err := os.Open(castPath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	reader, err := asciicast.NewReader(file)
+	if err != nil {
+		return ""
+	}
+
+	var output strings.Builder
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			var lineErr *asciicast.LineError
+			if errors.As(err, &lineErr) {
+				continue
+			}
+			break
+		}
+		if event.Type == asciicast.Output {
+			output.WriteString(event.Data)
+		}
+	}
+	var erased []rune
+	for _, char := range escapeSequences.ReplaceAllString(output.String(), "") {
+		if char == '\b' {
+			if len(erased) > 0 && erased[len(erased)-1] != '\n' {
+				erased = erased[:len(erased)-1]
+			}
+			continue
+		}
+		erased = append(erased, char)
+	}
+	return string(erased)
+}
+
+// typedCommands returns how many of an action's commands have been typed
+// in the provided output. See typedPosition for more information.
+func typedCommands(action sceneAction, output string) int {
+	typed, _ := typedPosition(action, output)
+	return typed
+}
+
+// typedPosition returns how many of an action's commands have been typed
+// in the provided output, and the position in the output right after
+// the last one. Commands are searched in order.
+//
+// Passwords are never printed. A password is considered typed once a
+// line ends after what Good Bot expected before typing it, which is
+// when Enter is pressed, or after the line of the previous command if
+// nothing was expected. A password is also considered typed once a
+// command after it has been found.
+func typedPosition(action sceneAction, output string) (int, int) {
+	typed := 0
+	position := 0
+	for i, command := range action.commands {
+		if command.password != "" {
+			if end := passwordEnd(action, i, output, position); end >= 0 {
+				position = end
+				typed = i + 1
+			}
+			continue
+		}
+		index := strings.Index(output[position:], command.text)
+		if index < 0 {
+			break
+		}
+		position += index + len(command.text)
+		typed = i + 1
+	}
+	return typed, position
+}
+
+// passwordEnd finds where the line in which the password of the
+// command at index was typed ends in the output, starting from position.
+// -1 is returned if the password hasn't been typed yet.
+func passwordEnd(action sceneAction, index int, output string, position int) int {
+	if index > 0 {
+		previous := "\n"
+		if index-1 < len(action.expect) && action.expect[index-1] != "" {
+			previous = action.expect[index-1]
+		}
+		found := strings.Index(output[position:], previous)
+		if found < 0 {
+			return -1
+		}
+		position += found + len(previous)
+	}
+	found := strings.Index(output[position:], "\n")
+	if found < 0 {
+		return -1
+	}
+	return position + found + 1
+}
+
+// actionFinished checks whether or not every command of an action has
+// been typed in the provided output, followed by what Good Bot expects
+// after the last one, if anything.
+func actionFinished(action sceneAction, output string) bool {
+	last := len(action.commands) - 1
+	typed, position := typedPosition(action, output)
+	if last < 0 || typed <= last {
+		return false
+	}
+	if last >= len(action.expect) || action.expect[last] == "" {
+		return true
+	}
+	return strings.Contains(output[position:], action.expect[last])
+}
+
+// keepPartialCast copies an asciicast that is being recorded in the
+// scene's "logs" directory. The path towards the copy is returned, or
+// the original path if the copy failed.
+func keepPartialCast(scenePath string, castPath string) string {
+	contents, err := os.ReadFile(castPath)
+	if err != nil {
+		return castPath
+	}
+	logsPath := filepath.Join(scenePath, "logs")
+	if err := os.MkdirAll(logsPath, 0777); err != nil {
+		return castPath
+	}
+	name := strings.TrimSuffix(filepath.Base(castPath), filepath.Ext(castPath))
+	partialPath := filepath.Join(logsPath, name+".partial.cast")
+	if err := ioutil.WriteFile(partialPath, contents, 0644); err != nil {
+		return castPath
+	}
+	return partialPath
+}
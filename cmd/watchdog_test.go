@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestScene creates a scene with a single command file in a
+// temporary directory. The path towards the scene is returned.
+func writeTestScene(t *testing.T, commands string) string {
+	scenePath, err := ioutil.TempDir(testData.project, "scene_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"commands", "asciicasts"} {
+		if err := os.Mkdir(filepath.Join(scenePath, dir), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(scenePath, "commands", "commands_1"), []byte(commands), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scenePath
+}
+
+// TestParseSceneActions reads the command files of a scene from the
+// test project.
+func TestParseSceneActions(t *testing.T) {
+	scenePath := filepath.Join(testData.testProject1, "scene_2")
+	actions, err := parseSceneActions(scenePath)
+	if err != nil {
+		t.Fatalf("parseSceneActions(%s) returned error:\n%s", scenePath, err)
+	}
+	if len(actions) != 1 {
+		t.Fatalf("parseSceneActions(%s) found %d actions, want 1", scenePath, len(actions))
+	}
+	if len(actions[0].commands) != 3 || actions[0].commands[1].text != "cd foobar" {
+		t.Errorf("parseSceneActions(%s) found commands %v", scenePath, actions[0].commands)
+	}
+	if actions[0].timeout != 0 {
+		t.Errorf("parseSceneActions(%s) found timeout %s, want none", scenePath, actions[0].timeout)
+	}
+}
+
+// TestParseSceneActionsTimeout reads a command file that contains a
+// password and a timeout.
+func TestParseSceneActionsTimeout(t *testing.T) {
+	scenePath := writeTestScene(t, "commands:\n- ssh tricky@server\n- password: SSH_TRICKY\nexpect:\n- assword\n- prompt\ntimeout: 1m30s\n")
+	defer os.RemoveAll(scenePath)
+
+	actions, err := parseSceneActions(scenePath)
+	if err != nil {
+		t.Fatalf("parseSceneActions(%s) returned error:\n%s", scenePath, err)
+	}
+	if actions[0].timeout != 90*time.Second {
+		t.Errorf("parseSceneActions(%s) found timeout %s, want 1m30s", scenePath, actions[0].timeout)
+	}
+	if actions[0].commands[1].password != "SSH_TRICKY" {
+		t.Errorf("parseSceneActions(%s) did not find the password", scenePath)
+	}
+}
+
+// TestTypedCommands counts the commands typed in an asciicast from the
+// test project.
+func TestTypedCommands(t *testing.T) {
+	scenePath := filepath.Join(testData.testProject1, "scene_2")
+	actions, err := parseSceneActions(scenePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := castOutput(filepath.Join(scenePath, recordingsPath, "commands_1.cast"))
+
+	if got := typedCommands(actions[0], output); got != 3 {
+		t.Errorf("typedCommands found %d commands, want 3", got)
+	}
+	if got := typedCommands(actions[0], output[:strings.Index(output, "cd foobar")]); got != 1 {
+		t.Errorf("typedCommands on a partial output found %d commands, want 1", got)
+	}
+}
+
+// TestWatchRecording writes a partial asciicast in which the first
+// command has been typed, and makes sure that the watchdog times out
+// with an error that names the command and the expected pattern.
+func TestWatchRecording(t *testing.T) {
+	scenePath := writeTestScene(t, "commands:\n- echo 'hello world'\n- ls\nexpect:\n- never printed\n- prompt\ntimeout: 50ms\n")
+	defer os.RemoveAll(scenePath)
+
+	defer func(interval time.Duration) { watchInterval = interval }(watchInterval)
+	watchInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timedOut := watchRecording(ctx, []string{scenePath}, 0)
+
+	cast := "{\"version\": 2, \"width\": 80, \"height\": 24}\n[0.1, \"o\", \"$ echo 'hello world'\\r\\n\"]\n"
+	err := ioutil.WriteFile(filepath.Join(scenePath, recordingsPath, "commands_1.cast"), []byte(cast), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-timedOut:
+		message := err.Error()
+		for _, want := range []string{filepath.Base(scenePath), "commands_1", "echo 'hello world'", "never printed", "commands_1.partial.cast"} {
+			if !strings.Contains(message, want) {
+				t.Errorf("watchRecording error %q does not contain %q", message, want)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("watchRecording did not time out")
+	}
+}
+
+// TestWatchRecordingNoTimeout makes sure that nothing is watched when
+// no timeout is set.
+func TestWatchRecordingNoTimeout(t *testing.T) {
+	scenePath := filepath.Join(testData.testProject1, "scene_1")
+	if watchRecording(context.Background(), []string{scenePath}, 0) != nil {
+		t.Errorf("watchRecording(%s) should not watch a scene without timeouts", scenePath)
+	}
+}
+
+// TestActionFinished checks that an action is only finished once its
+// last command and what is expected after it have been printed.
+func TestActionFinished(t *testing.T) {
+	action := sceneAction{
+		commands: []actionCommand{{"echo a", ""}, {"ls", ""}},
+		expect:   []string{"a", "done"},
+	}
+	var testCases = []struct {
+		output string
+		want   bool
+	}{
+		{"$ echo a\r\na\r\n", false},
+		{"$ echo a\r\na\r\n$ ls\r\n", false},
+		{"$ echo a\r\na\r\n$ ls\r\ndone\r\n", true},
+	}
+	for _, tc := range testCases {
+		if got := actionFinished(action, tc.output); got != tc.want {
+			t.Errorf("actionFinished(%q) = %v, want %v", tc.output, got, tc.want)
+		}
+	}
+}
+
+// TestWatchRecordingArmed makes sure that the watchdog doesn't time out
+// before an asciicast has been created, or once its action is finished.
+func TestWatchRecordingArmed(t *testing.T) {
+	scenePath := writeTestScene(t, "commands:\n- ls\nexpect:\n- done\ntimeout: 30ms\n")
+	defer os.RemoveAll(scenePath)
+
+	defer func(interval time.Duration) { watchInterval = interval }(watchInterval)
+	watchInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timedOut := watchRecording(ctx, []string{scenePath}, 0)
+
+	select {
+	case err := <-timedOut:
+		t.Fatalf("watchRecording timed out before any asciicast was created: %s", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	cast := "{\"version\": 2, \"width\": 80, \"height\": 24}\n[0.1, \"o\", \"$ ls\\r\\ndone\\r\\n\"]\n"
+	err := ioutil.WriteFile(filepath.Join(scenePath, recordingsPath, "commands_1.cast"), []byte(cast), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-timedOut:
+		t.Errorf("watchRecording timed out after the action was finished: %s", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// TestActionFinishedPassword checks that an action whose last command is
+// a password is finished once the password has been typed, and what is
+// expected after it has been printed.
+func TestActionFinishedPassword(t *testing.T) {
+	action := sceneAction{
+		commands: []actionCommand{{"ssh tricky@server", ""}, {"password: SSH_TRICKY", "SSH_TRICKY"}},
+		expect:   []string{"assword:", "Welcome"},
+	}
+	var testCases = []struct {
+		output string
+		typed  int
+		want   bool
+	}{
+		{"$ ssh tricky@server\r\n", 1, false},
+		{"$ ssh tricky@server\r\ntricky@server's password: ", 1, false},
+		{"$ ssh tricky@server\r\ntricky@server's password: \r\n", 2, false},
+		{"$ ssh tricky@server\r\ntricky@server's password: \r\nWelcome to server\r\n", 2, true},
+	}
+	for _, tc := range testCases {
+		if got := typedCommands(action, tc.output); got != tc.typed {
+			t.Errorf("typedCommands(%q) = %d, want %d", tc.output, got, tc.typed)
+		}
+		if got := actionFinished(action, tc.output); got != tc.want {
+			t.Errorf("actionFinished(%q) = %v, want %v", tc.output, got, tc.want)
+		}
+	}
+}
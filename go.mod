@@ -3,7 +3,7 @@ module github.com/TrickyTroll/good-bot-cli
 go 1.16
 
 require (
-	github.com/AlecAivazis/survey/v2 v2.2.15 // indirect
+	github.com/AlecAivazis/survey/v2 v2.2.15
 	github.com/Netflix/go-expect v0.0.0-20210722184520-ef0bf57d82b3 // indirect
 	github.com/containerd/containerd v1.5.3 // indirect
 	github.com/docker/docker v20.10.7+incompatible
@@ -15,4 +15,7 @@ require (
 	github.com/sirupsen/logrus v1.8.1 // indirect
 	github.com/spf13/cobra v1.2.1
 	github.com/spf13/viper v1.8.1
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
+	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
+	gopkg.in/yaml.v2 v2.4.0
 )
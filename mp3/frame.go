@@ -0,0 +1,124 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mp3
+
+// header is the header of an MPEG audio frame.
+type header struct {
+	// version is 1 for MPEG-1, 2 for MPEG-2 and 25 for MPEG-2.5.
+	version int
+	layer   int
+	// bitrate is in bits per second.
+	bitrate    int
+	sampleRate int
+	mono       bool
+	// size is the size of the whole frame, in bytes.
+	size int
+	// samples is the number of samples in the frame.
+	samples int
+}
+
+// bitrates are the bitrates of each version and layer, in kbps, by
+// bitrate index. Index 0 is for free bitrates, which are not supported.
+var bitrates = map[[2]int][16]int{
+	{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// sampleRates are the sample rates of each version, in Hz, by sample
+// rate index.
+var sampleRates = map[int][3]int{
+	1:  {44100, 48000, 32000},
+	2:  {22050, 24000, 16000},
+	25: {11025, 12000, 8000},
+}
+
+// parseHeader reads the header of the frame at the start of data.
+// False is returned if data doesn't start with a valid frame header.
+func parseHeader(data []byte) (header, bool) {
+	if len(data) < 4 || data[0] != 0xff || data[1]&0xe0 != 0xe0 {
+		return header{}, false
+	}
+
+	var h header
+	switch (data[1] >> 3) & 3 {
+	case 0:
+		h.version = 25
+	case 2:
+		h.version = 2
+	case 3:
+		h.version = 1
+	default:
+		return header{}, false
+	}
+	// Layers are written backwards: 3 is layer I.
+	h.layer = 4 - int((data[1]>>1)&3)
+	if h.layer == 4 {
+		return header{}, false
+	}
+
+	bitrateIndex, sampleRateIndex := data[2]>>4, (data[2]>>2)&3
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return header{}, false
+	}
+	tableVersion := h.version
+	if tableVersion == 25 {
+		tableVersion = 2
+	}
+	h.bitrate = bitrates[[2]int{tableVersion, h.layer}][bitrateIndex] * 1000
+	h.sampleRate = sampleRates[h.version][sampleRateIndex]
+	padding := int((data[2] >> 1) & 1)
+	h.mono = data[3]>>6 == 3
+
+	switch {
+	case h.layer == 1:
+		h.samples = 384
+		h.size = (12*h.bitrate/h.sampleRate + padding) * 4
+	case h.layer == 3 && h.version != 1:
+		h.samples = 576
+		h.size = 72*h.bitrate/h.sampleRate + padding
+	default:
+		h.samples = 1152
+		h.size = 144*h.bitrate/h.sampleRate + padding
+	}
+	return h, true
+}
+
+// channels returns the number of channels of the frame.
+func (h header) channels() int {
+	if h.mono {
+		return 1
+	}
+	return 2
+}
+
+// sideInfoSize returns the size of the side information that follows
+// the header of a layer III frame. The Xing header comes after it.
+func (h header) sideInfoSize() int {
+	switch {
+	case h.version == 1 && h.mono:
+		return 17
+	case h.version == 1:
+		return 32
+	case h.mono:
+		return 9
+	default:
+		return 17
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mp3
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf16"
+)
+
+// readID3v2 reads the ID3v2 tag at the start of data, if there is one,
+// and adds its text frames to tags. The size of the tag is returned, or
+// 0 if data doesn't start with a tag.
+//
+// Versions 2.2, 2.3 and 2.4 are supported. Frames that are compressed
+// or encrypted are skipped.
+func readID3v2(data []byte, tags map[string]string) (int, error) {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return 0, nil
+	}
+	version, flags := data[3], data[5]
+	if version < 2 || version > 4 {
+		return 0, errors.New("unsupported ID3v2 version")
+	}
+	size := 10 + int(syncsafe(data[6:10]))
+	if version == 4 && flags&0x10 != 0 {
+		// The tag ends with a footer.
+		size += 10
+	}
+	if size > len(data) {
+		return 0, errors.New("ID3v2 tag is truncated")
+	}
+
+	body := data[10 : 10+int(syncsafe(data[6:10]))]
+	if version < 4 && flags&0x80 != 0 {
+		body = removeUnsynchronisation(body)
+	}
+	if flags&0x40 != 0 && version > 2 {
+		// The extended header is skipped.
+		if len(body) < 4 {
+			return size, nil
+		}
+		extended := int(bigEndian(body[:4])) + 4
+		if version == 4 {
+			extended = int(syncsafe(body[:4]))
+		}
+		if extended > len(body) {
+			return size, nil
+		}
+		body = body[extended:]
+	}
+
+	readFrames(body, version, tags)
+	return size, nil
+}
+
+// readFrames reads the frames of an ID3v2 tag. Frames are read until
+// the padding at the end of the tag, or until a frame is invalid.
+func readFrames(body []byte, version byte, tags map[string]string) {
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+
+	for len(body) >= headerSize && body[0] != 0 {
+		id := string(body[:idSize])
+		var size int
+		var flags byte
+		switch version {
+		case 2:
+			size = int(bigEndian(body[3:6]))
+		case 3:
+			size = int(bigEndian(body[4:8]))
+			flags = body[9]
+		default:
+			size = int(syncsafe(body[4:8]))
+			flags = body[9]
+		}
+		if size > len(body)-headerSize {
+			return
+		}
+		content := body[headerSize : headerSize+size]
+		body = body[headerSize+size:]
+
+		content, ok := frameContent(content, version, flags)
+		if ok && id[0] == 'T' && id != "TXXX" && id != "TXX" {
+			if text := decodeText(content); text != "" {
+				tags[id] = text
+			}
+		}
+	}
+}
+
+// frameContent removes what the flags of a frame add to its content.
+// False is returned if the frame is compressed or encrypted.
+func frameContent(content []byte, version byte, flags byte) ([]byte, bool) {
+	switch version {
+	case 3:
+		if flags&0xc0 != 0 {
+			return nil, false
+		}
+		if flags&0x20 != 0 && len(content) > 0 {
+			// Grouping identity.
+			content = content[1:]
+		}
+	case 4:
+		if flags&0x0c != 0 {
+			return nil, false
+		}
+		if flags&0x40 != 0 && len(content) > 0 {
+			// Grouping identity.
+			content = content[1:]
+		}
+		if flags&0x02 != 0 {
+			content = removeUnsynchronisation(content)
+		}
+		if flags&0x01 != 0 && len(content) >= 4 {
+			// Data length indicator.
+			content = content[4:]
+		}
+	}
+	return content, true
+}
+
+// decodeText decodes the content of a text frame. Its first byte is the
+// text's encoding. Frames that contain more than one value have them
+// separated by slashes.
+func decodeText(content []byte) string {
+	if len(content) < 1 {
+		return ""
+	}
+	encoding, text := content[0], content[1:]
+
+	var values []string
+	switch encoding {
+	case 1, 2:
+		values = splitUTF16(text, encoding == 2)
+	case 3:
+		values = strings.Split(string(text), "\x00")
+	default:
+		var latin1 []rune
+		for _, b := range text {
+			latin1 = append(latin1, rune(b))
+		}
+		values = strings.Split(string(latin1), "\x00")
+	}
+
+	var kept []string
+	for _, value := range values {
+		if value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return strings.Join(kept, "/")
+}
+
+// splitUTF16 decodes UTF-16 values separated by null characters. Each
+// value can start with a byte order mark. Without one, values are big
+// endian if bigEndian is true, and little endian otherwise.
+func splitUTF16(text []byte, bigEndian bool) []string {
+	var values []string
+	var units []uint16
+	littleEndian := !bigEndian
+	for i := 0; i+1 < len(text); i += 2 {
+		first, second := text[i], text[i+1]
+		switch {
+		case len(units) == 0 && first == 0xff && second == 0xfe:
+			littleEndian = true
+			continue
+		case len(units) == 0 && first == 0xfe && second == 0xff:
+			littleEndian = false
+			continue
+		}
+		unit := uint16(first)<<8 | uint16(second)
+		if littleEndian {
+			unit = uint16(second)<<8 | uint16(first)
+		}
+		if unit == 0 {
+			values = append(values, string(utf16.Decode(units)))
+			units = nil
+			continue
+		}
+		units = append(units, unit)
+	}
+	return append(values, string(utf16.Decode(units)))
+}
+
+// syncsafe reads an integer stored on 7 bits per byte, which is how ID3v2
+// stores sizes so that they never look like a frame header.
+func syncsafe(data []byte) uint32 {
+	var value uint32
+	for _, b := range data {
+		value = value<<7 | uint32(b&0x7f)
+	}
+	return value
+}
+
+// removeUnsynchronisation removes the null bytes that are added after
+// each 0xff byte of unsynchronised data.
+func removeUnsynchronisation(data []byte) []byte {
+	return bytes.ReplaceAll(data, []byte{0xff, 0x00}, []byte{0xff})
+}
@@ -0,0 +1,67 @@
+package mp3
+
+import (
+	"testing"
+)
+
+// TestDecodeText decodes text frames in each encoding.
+func TestDecodeText(t *testing.T) {
+	var testCases = []struct {
+		content []byte
+		want    string
+	}{
+		{[]byte{0, 'c', 'a', 'f', 0xe9}, "café"},
+		{[]byte{3, 'c', 'a', 'f', 0xc3, 0xa9, 0}, "café"},
+		{[]byte{1, 0xfe, 0xff, 0, 'h', 0, 'i'}, "hi"},
+		{[]byte{2, 0, 'h', 0, 'i'}, "hi"},
+		{[]byte{3, 'a', 0, 'b'}, "a/b"},
+		{[]byte{1, 0xff, 0xfe, 'a', 0, 0, 0, 0xff, 0xfe, 'b', 0}, "a/b"},
+		{[]byte{}, ""},
+	}
+	for _, tc := range testCases {
+		if got := decodeText(tc.content); got != tc.want {
+			t.Errorf("decodeText(%v) returned %q, want %q", tc.content, got, tc.want)
+		}
+	}
+}
+
+// TestReadID3v2Versions reads the tags of each supported version.
+func TestReadID3v2Versions(t *testing.T) {
+	var testCases = []struct {
+		name string
+		tag  []byte
+		id   string
+	}{
+		{"v2.2", []byte{'I', 'D', '3', 2, 0, 0, 0, 0, 0, 10, 'T', 'T', '2', 0, 0, 4, 0, 'a', 'b', 'c'}, "TT2"},
+		// The size of v2.4 frames is syncsafe, and this frame has a
+		// data length indicator.
+		{"v2.4", []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 18, 'T', 'I', 'T', '2', 0, 0, 0, 8, 0, 1, 0, 0, 0, 4, 3, 'a', 'b', 'c'}, "TIT2"},
+		// Unsynchronised v2.3 tags have a null byte after each 0xff.
+		{"unsynchronised", []byte{'I', 'D', '3', 3, 0, 0x80, 0, 0, 0, 16, 'T', 'I', 'T', '2', 0, 0, 0, 5, 0, 0, 0, 'a', 'b', 'c', 0xff, 0}, "TIT2"},
+	}
+	for _, tc := range testCases {
+		tags := map[string]string{}
+		size, err := readID3v2(tc.tag, tags)
+		if err != nil {
+			t.Errorf("%s: readID3v2 returned error: %s", tc.name, err)
+			continue
+		}
+		if size != len(tc.tag) {
+			t.Errorf("%s: got a tag of %d bytes, want %d", tc.name, size, len(tc.tag))
+		}
+		want := "abc"
+		if tc.name == "unsynchronised" {
+			want = "abcÿ"
+		}
+		if tags[tc.id] != want {
+			t.Errorf("%s: got tags %q, want %s %q", tc.name, tags, tc.id, want)
+		}
+	}
+}
+
+// TestSyncsafe reads integers stored on 7 bits per byte.
+func TestSyncsafe(t *testing.T) {
+	if got := syncsafe([]byte{0, 0, 0x02, 0x01}); got != 257 {
+		t.Errorf("syncsafe returned %d, want 257", got)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mp3 reads the length and metadata of MPEG audio files, without
+// decoding them.
+//
+// A file is made of frames that each contain the same number of samples,
+// so its length is found by counting its frames. Files with a variable
+// bitrate usually start with a Xing or VBRI header, which already
+// contains the number of frames. Files can also start with an ID3v2 tag,
+// which contains metadata such as a title.
+package mp3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Info describes an MPEG audio file.
+type Info struct {
+	// Duration is the length of the audio, in seconds.
+	Duration float64
+	// Bitrate is the average number of bits per second.
+	Bitrate int
+	// SampleRate is the number of samples per second, in Hz.
+	SampleRate int
+	Channels   int
+	// Frames is the number of audio frames.
+	Frames int
+	// VBR is true if the file has a Xing or VBRI header, which is used
+	// by files with a variable bitrate.
+	VBR bool
+	// Tags contains the text frames of the file's ID3v2 tag, by frame
+	// ID, such as "TIT2" for the title.
+	Tags map[string]string
+}
+
+// ErrNoFrames is returned when a file does not contain any MPEG audio
+// frame.
+var ErrNoFrames = errors.New("no MPEG audio frames found")
+
+// Read reads the length and metadata of an MPEG audio file.
+func Read(r io.Reader) (*Info, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{Tags: map[string]string{}}
+	offset := 0
+	// Some files have more than one tag.
+	for {
+		size, err := readID3v2(data[offset:], info.Tags)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			break
+		}
+		offset += size
+	}
+
+	start, first, ok := findFrame(data, offset)
+	if !ok {
+		return nil, ErrNoFrames
+	}
+	info.SampleRate = first.sampleRate
+	info.Channels = first.channels()
+
+	if frames, bytes, ok := readVBRHeader(data[start:], first); ok {
+		info.VBR = true
+		info.Frames = frames
+		info.Duration = float64(frames*first.samples) / float64(first.sampleRate)
+		if bytes == 0 {
+			bytes = len(data) - start
+		}
+		if info.Duration > 0 {
+			info.Bitrate = int(float64(bytes*8)/info.Duration + 0.5)
+		}
+		return info, nil
+	}
+
+	// Without a header, every frame is counted. The audio ends at the
+	// first thing that isn't a frame, such as an ID3v1 tag.
+	bytes, samples := 0, 0
+	for position := start; position+4 <= len(data); {
+		current, ok := parseHeader(data[position:])
+		if !ok || position+current.size > len(data) {
+			break
+		}
+		info.Frames++
+		bytes += current.size
+		samples += current.samples
+		position += current.size
+	}
+	info.Duration = float64(samples) / float64(info.SampleRate)
+	if info.Duration > 0 {
+		info.Bitrate = int(float64(bytes*8)/info.Duration + 0.5)
+	}
+	return info, nil
+}
+
+// ReadFile reads the length and metadata of an MPEG audio file saved in
+// a file.
+func ReadFile(path string) (*Info, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return info, nil
+}
+
+// findFrame returns the position and header of the first frame found
+// after offset. A frame is only accepted if it is followed by another
+// frame, or by the end of the data, since bytes that look like a frame
+// header can be found anywhere.
+func findFrame(data []byte, offset int) (int, header, bool) {
+	for position := offset; position+4 <= len(data); position++ {
+		current, ok := parseHeader(data[position:])
+		if !ok {
+			continue
+		}
+		next := position + current.size
+		if next == len(data) {
+			return position, current, true
+		}
+		if following, ok := parseHeader(data[next:]); ok && following.sampleRate == current.sampleRate {
+			return position, current, true
+		}
+	}
+	return 0, header{}, false
+}
+
+// readVBRHeader reads the Xing or VBRI header that can be found in the
+// first frame of a file. The number of audio frames and bytes is
+// returned, without the frame of the header. The number of bytes is 0
+// if the header doesn't have it.
+func readVBRHeader(frame []byte, first header) (int, int, bool) {
+	if len(frame) > first.size {
+		frame = frame[:first.size]
+	}
+
+	// The Xing header, also written as "Info" for files with a constant
+	// bitrate, comes right after the side information.
+	xing := 4 + first.sideInfoSize()
+	if len(frame) >= xing+8 && (string(frame[xing:xing+4]) == "Xing" || string(frame[xing:xing+4]) == "Info") {
+		flags := bigEndian(frame[xing+4 : xing+8])
+		position := xing + 8
+		frames, bytes := 0, 0
+		if flags&1 != 0 {
+			if len(frame) < position+4 {
+				return 0, 0, false
+			}
+			frames = int(bigEndian(frame[position : position+4]))
+			position += 4
+		}
+		if flags&2 != 0 && len(frame) >= position+4 {
+			bytes = int(bigEndian(frame[position:position+4])) - first.size
+		}
+		if flags&1 == 0 {
+			return 0, 0, false
+		}
+		return frames, maxInt(bytes, 0), true
+	}
+
+	// The VBRI header is always 32 bytes after the frame header.
+	const vbri = 4 + 32
+	if len(frame) >= vbri+18 && string(frame[vbri:vbri+4]) == "VBRI" {
+		bytes := int(bigEndian(frame[vbri+10:vbri+14])) - first.size
+		frames := int(bigEndian(frame[vbri+14 : vbri+18]))
+		return frames, maxInt(bytes, 0), true
+	}
+	return 0, 0, false
+}
+
+// bigEndian reads an unsigned integer stored with its most significant
+// byte first.
+func bigEndian(data []byte) uint32 {
+	var value uint32
+	for _, b := range data {
+		value = value<<8 | uint32(b)
+	}
+	return value
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,165 @@
+package mp3
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// testProject is the path of the project used for tests.
+var testProject = filepath.Join("..", "testdata", "project_1")
+
+// TestReadFile reads the narrations of the test project, which are
+// MPEG-2 layer III files with a constant bitrate.
+func TestReadFile(t *testing.T) {
+	var testCases = []struct {
+		path     string
+		frames   int
+		duration float64
+	}{
+		{"scene_1/audio/read_1.mp3", 53, 1.272},
+		{"scene_1/audio/read_2.mp3", 57, 1.368},
+		{"scene_2/audio/read_1.mp3", 147, 3.528},
+		{"scene_3/audio/read_1.mp3", 196, 4.704},
+		{"scene_4/audio/read_1.mp3", 116, 2.784},
+	}
+	for _, tc := range testCases {
+		info, err := ReadFile(filepath.Join(testProject, tc.path))
+		if err != nil {
+			t.Errorf("ReadFile(%s) returned error: %s", tc.path, err)
+			continue
+		}
+		if info.Frames != tc.frames || !closeTo(info.Duration, tc.duration) {
+			t.Errorf("%s has %d frames and lasts %vs, want %d frames and %vs", tc.path, info.Frames, info.Duration, tc.frames, tc.duration)
+		}
+		if info.Bitrate != 32000 || info.SampleRate != 24000 || info.Channels != 1 || info.VBR {
+			t.Errorf("%s is %+v, want a 32kbps 24kHz mono file", tc.path, info)
+		}
+	}
+}
+
+// frame returns an MPEG-1 layer III frame of 128kbps at 44.1kHz, in
+// stereo, which is 417 bytes long. The frame's content starts with
+// content.
+func frame(content []byte) []byte {
+	data := make([]byte, 417)
+	copy(data, []byte{0xff, 0xfb, 0x90, 0x00})
+	copy(data[4:], content)
+	return data
+}
+
+// repeat returns count copies of a frame.
+func repeat(data []byte, count int) []byte {
+	return bytes.Repeat(data, count)
+}
+
+// TestReadCBR counts the frames of a file, which end at an ID3v1 tag.
+func TestReadCBR(t *testing.T) {
+	data := repeat(frame(nil), 100)
+	data = append(data, append([]byte("TAG"), make([]byte, 125)...)...)
+
+	info, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 100 * 1152 / 44100.0
+	if info.Frames != 100 || !closeTo(info.Duration, want) || info.SampleRate != 44100 || info.Channels != 2 {
+		t.Errorf("got %+v, want 100 frames lasting %vs at 44100Hz in stereo", info, want)
+	}
+	// Frames of 417 bytes are a little shorter than 128kbps.
+	if info.Bitrate < 127000 || info.Bitrate > 128000 {
+		t.Errorf("got a bitrate of %d, want about 128000", info.Bitrate)
+	}
+}
+
+// TestReadXing uses the number of frames of a Xing header, instead of
+// counting the frames.
+func TestReadXing(t *testing.T) {
+	for _, name := range []string{"Xing", "Info"} {
+		// The Xing header is after 32 bytes of side information.
+		header := make([]byte, 32)
+		header = append(header, name...)
+		header = append(header, 0, 0, 0, 3)
+		header = append(header, 0, 0, 0x03, 0xe8)    // 1000 frames
+		header = append(header, 0, 0x01, 0x00, 0x00) // 65536 bytes
+		data := append(frame(header), repeat(frame(nil), 10)...)
+
+		info, err := Read(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		duration := 1000 * 1152 / 44100.0
+		bitrate := int(float64((65536-417)*8)/duration + 0.5)
+		if info.Frames != 1000 || !closeTo(info.Duration, duration) || info.Bitrate != bitrate || !info.VBR {
+			t.Errorf("%s header: got %+v, want 1000 frames lasting %vs at %d bps", name, info, duration, bitrate)
+		}
+	}
+}
+
+// TestReadVBRI uses the number of frames of a VBRI header.
+func TestReadVBRI(t *testing.T) {
+	header := make([]byte, 32)
+	header = append(header, "VBRI"...)
+	header = append(header, 0, 1, 0, 0, 0, 75)
+	header = append(header, 0, 0, 0x10, 0x00) // 4096 bytes
+	header = append(header, 0, 0, 0, 50)      // 50 frames
+	data := append(frame(header), repeat(frame(nil), 10)...)
+
+	info, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	duration := 50 * 1152 / 44100.0
+	if info.Frames != 50 || !closeTo(info.Duration, duration) || !info.VBR {
+		t.Errorf("got %+v, want 50 frames lasting %vs", info, duration)
+	}
+}
+
+// TestReadID3v2 skips an ID3v2 tag, and reads its text frames.
+func TestReadID3v2(t *testing.T) {
+	// A v2.3 tag with a title, an artist in UTF-16, and padding.
+	var frames []byte
+	frames = append(frames, "TIT2"...)
+	frames = append(frames, 0, 0, 0, 6, 0, 0)
+	frames = append(frames, 0, 'H', 'e', 'l', 'l', 'o')
+	frames = append(frames, "TPE1"...)
+	frames = append(frames, 0, 0, 0, 7, 0, 0)
+	frames = append(frames, 1, 0xff, 0xfe, 'B', 0, 'o', 0)
+	frames = append(frames, make([]byte, 20)...)
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frames))}, frames...)
+
+	// Bytes that look like a frame header right after the tag are not
+	// taken for a frame.
+	data := append(tag, 0xff, 0xfb, 0x00)
+	data = append(data, repeat(frame(nil), 5)...)
+	info, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Tags["TIT2"] != "Hello" || info.Tags["TPE1"] != "Bo" {
+		t.Errorf("got tags %v, want TIT2 Hello and TPE1 Bo", info.Tags)
+	}
+	if info.Frames != 5 {
+		t.Errorf("got %d frames, want 5", info.Frames)
+	}
+}
+
+// TestReadErrors makes sure that files that are not MPEG audio files are
+// rejected.
+func TestReadErrors(t *testing.T) {
+	if _, err := Read(bytes.NewReader([]byte("not an mp3 file"))); !errors.Is(err, ErrNoFrames) {
+		t.Errorf("got error %v, want %v", err, ErrNoFrames)
+	}
+	truncated := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 1, 0}
+	if _, err := Read(bytes.NewReader(truncated)); err == nil {
+		t.Error("a truncated ID3v2 tag did not return an error")
+	}
+}
+
+// closeTo checks whether or not two durations are the same, to the
+// microsecond.
+func closeTo(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
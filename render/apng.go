@@ -0,0 +1,189 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+)
+
+// APNGOptions controls how a recording is drawn in an animated png.
+type APNGOptions struct {
+	// Scale multiplies the size of each pixel of the font. A scale of
+	// 1 draws cells of 7x13 pixels.
+	Scale int
+	// MaxFPS is the highest number of frames shown each second. It can
+	// be at most 100, since delays are in centiseconds.
+	MaxFPS int
+	// Theme is the theme used to draw the terminal. If it is nil, the
+	// recording's theme is used, or DefaultTheme if it has none.
+	Theme *Theme
+}
+
+// pngSignature starts every png file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngChunk is a chunk of a png file, without its length and checksum.
+type pngChunk struct {
+	Type string
+	Data []byte
+}
+
+// APNG draws a recording as an animated png. The frames are the same as
+// the ones of Gif, but they are compressed without loss, which keeps the
+// text crisp. Only the part of each frame that changed is saved.
+func APNG(cast *asciicast.Cast, w io.Writer, options APNGOptions) error {
+	if options.Scale < 1 {
+		options.Scale = 1
+	}
+	if options.MaxFPS < 1 || options.MaxFPS > 100 {
+		options.MaxFPS = 100
+	}
+	if options.Theme == nil {
+		options.Theme = ThemeFromHeader(&cast.Header)
+	}
+	r := newRasterizer(cast.Header.Width, cast.Header.Height, options.Scale, options.Theme)
+	parts := r.animate(cast, (100+options.MaxFPS-1)/options.MaxFPS)
+
+	var chunks []pngChunk
+	var sequence uint32
+	for i, part := range parts {
+		// Each frame is encoded as a png of its own, which uses the same
+		// palette, and its image data is moved to the animation.
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, part.Image); err != nil {
+			return err
+		}
+		frameChunks, err := readPNGChunks(encoded.Bytes())
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			// The header and palette come before the animation control
+			// chunk and the first frame.
+			for _, chunk := range frameChunks {
+				if chunk.Type == "IDAT" || chunk.Type == "IEND" {
+					break
+				}
+				chunks = append(chunks, chunk)
+				if chunk.Type == "IHDR" {
+					control := make([]byte, 8)
+					binary.BigEndian.PutUint32(control, uint32(len(parts)))
+					chunks = append(chunks, pngChunk{"acTL", control})
+				}
+			}
+		}
+
+		bounds := part.Image.Bounds()
+		control := make([]byte, 26)
+		binary.BigEndian.PutUint32(control[0:], sequence)
+		binary.BigEndian.PutUint32(control[4:], uint32(bounds.Dx()))
+		binary.BigEndian.PutUint32(control[8:], uint32(bounds.Dy()))
+		binary.BigEndian.PutUint32(control[12:], uint32(bounds.Min.X))
+		binary.BigEndian.PutUint32(control[16:], uint32(bounds.Min.Y))
+		delay, unit := part.Delay, 100
+		if delay > math.MaxUint16 {
+			// Long pauses are written in seconds.
+			delay, unit = minInt(delay/100, math.MaxUint16), 1
+		}
+		binary.BigEndian.PutUint16(control[20:], uint16(delay))
+		binary.BigEndian.PutUint16(control[22:], uint16(unit))
+		// The dispose and blend operations are both 0, so that each
+		// frame replaces its part of the previous one.
+		chunks = append(chunks, pngChunk{"fcTL", control})
+		sequence++
+
+		for _, chunk := range frameChunks {
+			if chunk.Type != "IDAT" {
+				continue
+			}
+			if i == 0 {
+				chunks = append(chunks, chunk)
+				continue
+			}
+			data := make([]byte, 4+len(chunk.Data))
+			binary.BigEndian.PutUint32(data, sequence)
+			copy(data[4:], chunk.Data)
+			chunks = append(chunks, pngChunk{"fdAT", data})
+			sequence++
+		}
+	}
+	chunks = append(chunks, pngChunk{"IEND", nil})
+
+	if _, err := io.WriteString(w, pngSignature); err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := writePNGChunk(w, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPNGChunks splits a png file into its chunks.
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, errors.New("not a png file")
+	}
+	data = data[len(pngSignature):]
+	var chunks []pngChunk
+	for len(data) > 0 {
+		if len(data) < 12 {
+			return nil, errors.New("truncated png chunk")
+		}
+		length := int(binary.BigEndian.Uint32(data))
+		if len(data) < 12+length {
+			return nil, errors.New("truncated png chunk")
+		}
+		chunks = append(chunks, pngChunk{string(data[4:8]), data[8 : 8+length]})
+		data = data[12+length:]
+	}
+	return chunks, nil
+}
+
+// writePNGChunk writes a chunk with its length and checksum.
+func writePNGChunk(w io.Writer, chunk pngChunk) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(chunk.Data)))
+	copy(header[4:], chunk.Type)
+	checksum := crc32.NewIEEE()
+	checksum.Write(header[4:])
+	checksum.Write(chunk.Data)
+
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, checksum.Sum32())
+	for _, part := range [][]byte{header, chunk.Data, footer} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
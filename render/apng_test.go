@@ -0,0 +1,86 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestAPNG reads the chunks of the animated png of a recording, and
+// checks its size, frames and delays.
+func TestAPNG(t *testing.T) {
+	cast := testCast(4, 2, output(0.5, "ab"), output(1, "\x1b[?25l"), output(1.2, "\r\n─"))
+
+	var buffer bytes.Buffer
+	if err := APNG(cast, &buffer, APNGOptions{Scale: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Decoders that don't support animations show the first frame.
+	first, err := png.Decode(bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := first.Bounds(); bounds.Dx() != 4*7*2 || bounds.Dy() != 2*13*2 {
+		t.Errorf("png is %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), 4*7*2, 2*13*2)
+	}
+	if got := first.At(3*7*2, 13*2); !sameColor(got, DefaultTheme.Background) {
+		t.Errorf("first frame has color %v, want %v", got, DefaultTheme.Background)
+	}
+
+	chunks, err := readPNGChunks(buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames uint32
+	var delays []int
+	var sequence []uint32
+	var last []byte
+	for _, chunk := range chunks {
+		switch chunk.Type {
+		case "acTL":
+			frames = binary.BigEndian.Uint32(chunk.Data)
+		case "fcTL":
+			delays = append(delays, int(binary.BigEndian.Uint16(chunk.Data[20:])))
+			sequence = append(sequence, binary.BigEndian.Uint32(chunk.Data))
+			last = chunk.Data
+		case "fdAT":
+			sequence = append(sequence, binary.BigEndian.Uint32(chunk.Data))
+		}
+	}
+	if frames != 4 {
+		t.Errorf("animation control has %d frames, want 4", frames)
+	}
+	if want := []int{50, 50, 20, lastFrameDelay}; !equalInts(delays, want) {
+		t.Errorf("png has delays %v, want %v", delays, want)
+	}
+	for i, number := range sequence {
+		if number != uint32(i) {
+			t.Fatalf("png has sequence numbers %v, want them to count from 0", sequence)
+		}
+	}
+
+	// Frames after the first one only contain what changed, which is
+	// the last line here.
+	if top := binary.BigEndian.Uint32(last[16:]); top < 13*2 {
+		t.Errorf("last frame starts at y %d, want it to start on the second line", top)
+	}
+}
+
+// TestAPNGFile writes an animated png to a file.
+func TestAPNGFile(t *testing.T) {
+	pngPath := filepath.Join(t.TempDir(), "commands_1.png")
+	if err := APNGFile(testCast(4, 1, output(0.5, "a")), pngPath, APNGOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(pngPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(contents)); err != nil {
+		t.Errorf("%s is not a png: %s", pngPath, err)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package render
+
+import (
+	"math"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/TrickyTroll/good-bot-cli/vt"
+)
+
+// Frame is what a terminal shows from a point in time until the next
+// frame.
+type Frame struct {
+	// Time is in centiseconds, the unit used by gifs.
+	Time   int
+	Screen *vt.Screen
+}
+
+// Frames replays a recording in a terminal of the recording's size, and
+// returns the screens it shows. The first frame is always the blank
+// screen shown at the start of the recording.
+//
+// Frames are at least minDelay centiseconds apart. Screens that are
+// shown for a shorter time are merged into the next one. Screens that
+// are the same as the previous one are skipped.
+func Frames(cast *asciicast.Cast, minDelay int) []Frame {
+	terminal := vt.New(cast.Header.Width, cast.Header.Height)
+	frames := []Frame{{0, terminal.Screen()}}
+
+	for _, event := range cast.Events {
+		if event.Type != asciicast.Output {
+			continue
+		}
+		terminal.Write([]byte(event.Data))
+		time := centiseconds(event.Time)
+		screen := terminal.Screen()
+
+		last := &frames[len(frames)-1]
+		if time-last.Time < minDelay {
+			last.Screen = screen
+		} else if !sameScreen(screen, last.Screen) {
+			frames = append(frames, Frame{time, screen})
+		}
+	}
+
+	// Merging screens can leave two frames that are the same next to
+	// each other.
+	merged := frames[:1]
+	for _, frame := range frames[1:] {
+		if !sameScreen(frame.Screen, merged[len(merged)-1].Screen) {
+			merged = append(merged, frame)
+		}
+	}
+	return merged
+}
+
+// sameScreen checks whether or not two screens look the same.
+func sameScreen(a *vt.Screen, b *vt.Screen) bool {
+	if a.Width != b.Width || a.Height != b.Height || a.CursorVisible != b.CursorVisible {
+		return false
+	}
+	if a.CursorVisible && (a.CursorX != b.CursorX || a.CursorY != b.CursorY) {
+		return false
+	}
+	for y := range a.Cells {
+		for x := range a.Cells[y] {
+			if a.Cells[y][x] != b.Cells[y][x] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// centiseconds converts a number of seconds to centiseconds.
+func centiseconds(seconds float64) int {
+	return int(math.Round(seconds * 100))
+}
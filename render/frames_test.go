@@ -0,0 +1,68 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+)
+
+// testCast returns a recording of the provided size with the provided
+// events.
+func testCast(width int, height int, events ...asciicast.Event) *asciicast.Cast {
+	return &asciicast.Cast{
+		Header: asciicast.Header{Version: asciicast.Version, Width: width, Height: height},
+		Events: events,
+	}
+}
+
+// output returns an output event.
+func output(time float64, data string) asciicast.Event {
+	return asciicast.Event{Time: time, Type: asciicast.Output, Data: data}
+}
+
+// TestFrames checks the time and text of the frames of a recording.
+func TestFrames(t *testing.T) {
+	cast := testCast(5, 2,
+		output(0.5, "a"),
+		output(0.51, "b"),
+		output(1, "\x1b[?25l"),
+		output(1.5, "\x1b[?25l"),
+		asciicast.Event{Time: 2, Type: asciicast.Input, Data: "x"},
+		output(3, "\x1b[2J"),
+	)
+
+	var want = []struct {
+		time int
+		text string
+	}{
+		{0, "\n\n"},
+		{50, "ab\n\n"},
+		{100, "ab\n\n"},
+		{300, "\n\n"},
+	}
+	frames := Frames(cast, 5)
+	if len(frames) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(want))
+	}
+	for i, frame := range frames {
+		if frame.Time != want[i].time || frame.Screen.String() != want[i].text {
+			t.Errorf("frame %d is %q at %d, want %q at %d", i, frame.Screen.String(), frame.Time, want[i].text, want[i].time)
+		}
+	}
+	if frames[2].Screen.CursorVisible {
+		t.Error("frame 2 shows the cursor, want it hidden")
+	}
+}
+
+// TestFramesMerged makes sure that screens that are shown for a shorter
+// time than the minimum delay are merged.
+func TestFramesMerged(t *testing.T) {
+	cast := testCast(5, 1, output(0.1, "a"), output(0.15, "b"), output(0.19, "c"), output(0.5, "d"))
+	frames := Frames(cast, 10)
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(frames))
+	}
+	if got := frames[1].Screen.String(); got != "abc\n" || frames[1].Time != 10 {
+		t.Errorf("frame 1 is %q at %d, want %q at 10", got, frames[1].Time, "abc\n")
+	}
+}
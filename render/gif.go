@@ -0,0 +1,333 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/TrickyTroll/good-bot-cli/vt"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// GifOptions controls how a recording is drawn in a gif.
+type GifOptions struct {
+	// Scale multiplies the size of each pixel of the font. A scale of
+	// 1 draws cells of 7x13 pixels.
+	Scale int
+	// MaxFPS is the highest number of frames shown each second. It can
+	// be at most 50, since gifs can't change faster than that.
+	MaxFPS int
+	// Theme is the theme used to draw the terminal. If it is nil, the
+	// recording's theme is used, or DefaultTheme if it has none.
+	Theme *Theme
+}
+
+// lastFrameDelay is the shortest time the last frame of a gif is shown,
+// in centiseconds, before the gif starts again.
+const lastFrameDelay = 200
+
+// lastDelay returns how long the last of the frames of a recording is
+// shown, in centiseconds. It lasts until the end of the recording, so
+// that pauses at the end are kept, and at least lastFrameDelay.
+func lastDelay(cast *asciicast.Cast, frames []Frame) int {
+	end := centiseconds(cast.Length()) - frames[len(frames)-1].Time
+	if end < lastFrameDelay {
+		return lastFrameDelay
+	}
+	return end
+}
+
+// font is the font used to draw cells. Its glyphs all have the same
+// size, and characters it doesn't have are drawn as U+FFFD.
+var font = basicfont.Face7x13
+
+// Gif draws a recording as an animated gif. The recording is replayed in
+// a terminal of its own size, and a frame is drawn each time the screen
+// changes. Only the part of each frame that changed is saved, which
+// keeps gifs small.
+func Gif(cast *asciicast.Cast, w io.Writer, options GifOptions) error {
+	if options.Scale < 1 {
+		options.Scale = 1
+	}
+	if options.MaxFPS < 1 || options.MaxFPS > 50 {
+		options.MaxFPS = 50
+	}
+	if options.Theme == nil {
+		options.Theme = ThemeFromHeader(&cast.Header)
+	}
+	r := newRasterizer(cast.Header.Width, cast.Header.Height, options.Scale, options.Theme)
+	animation := &gif.GIF{Config: image.Config{ColorModel: r.palette, Width: r.bounds.Dx(), Height: r.bounds.Dy()}}
+	for _, part := range r.animate(cast, (100+options.MaxFPS-1)/options.MaxFPS) {
+		animation.Image = append(animation.Image, part.Image)
+		animation.Delay = append(animation.Delay, part.Delay)
+		animation.Disposal = append(animation.Disposal, gif.DisposalNone)
+	}
+	return gif.EncodeAll(w, animation)
+}
+
+// animationFrame is the part of a frame that changed since the previous
+// one, drawn over it.
+type animationFrame struct {
+	Image *image.Paletted
+	// Delay is how long the frame is shown, in centiseconds.
+	Delay int
+}
+
+// animate replays a recording and draws each of its frames, which are
+// at least minDelay centiseconds apart. The first frame is the whole
+// screen, and the next ones only contain what changed. Frames that don't
+// change anything make the previous one last longer, and the last frame
+// lasts until the end of the recording.
+func (r *rasterizer) animate(cast *asciicast.Cast, minDelay int) []animationFrame {
+	frames := Frames(cast, minDelay)
+
+	var parts []animationFrame
+	previous := image.NewPaletted(r.bounds, r.palette)
+	current := image.NewPaletted(r.bounds, r.palette)
+	for i, frame := range frames {
+		r.draw(current, frame.Screen)
+		delay := lastDelay(cast, frames)
+		if i+1 < len(frames) {
+			delay = frames[i+1].Time - frame.Time
+		}
+
+		changed := r.bounds
+		if i > 0 {
+			changed = difference(previous, current)
+		}
+		if changed.Empty() {
+			parts[len(parts)-1].Delay += delay
+			continue
+		}
+
+		part := image.NewPaletted(changed, r.palette)
+		for y := changed.Min.Y; y < changed.Max.Y; y++ {
+			copy(part.Pix[part.PixOffset(changed.Min.X, y):], current.Pix[current.PixOffset(changed.Min.X, y):current.PixOffset(changed.Max.X, y)])
+		}
+		parts = append(parts, animationFrame{part, delay})
+		previous, current = current, previous
+	}
+	return parts
+}
+
+// difference returns the smallest rectangle that contains every pixel
+// that differs between two images of the same size.
+func difference(a *image.Paletted, b *image.Paletted) image.Rectangle {
+	changed := image.Rectangle{}
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		rowA := a.Pix[a.PixOffset(bounds.Min.X, y):a.PixOffset(bounds.Max.X, y)]
+		rowB := b.Pix[b.PixOffset(bounds.Min.X, y):b.PixOffset(bounds.Max.X, y)]
+		first, last := -1, -1
+		for x := range rowA {
+			if rowA[x] != rowB[x] {
+				if first == -1 {
+					first = x
+				}
+				last = x
+			}
+		}
+		if first != -1 {
+			changed = changed.Union(image.Rect(bounds.Min.X+first, y, bounds.Min.X+last+1, y+1))
+		}
+	}
+	return changed
+}
+
+// rasterizer draws screens on images.
+type rasterizer struct {
+	scale      int
+	cellWidth  int
+	cellHeight int
+	bounds     image.Rectangle
+	theme      *Theme
+	palette    color.Palette
+	indexes    map[color.RGBA]uint8
+}
+
+// newRasterizer creates a rasterizer for screens of the provided size.
+func newRasterizer(width int, height int, scale int, theme *Theme) *rasterizer {
+	cellWidth, cellHeight := font.Advance*scale, font.Height*scale
+	return &rasterizer{
+		scale:      scale,
+		cellWidth:  cellWidth,
+		cellHeight: cellHeight,
+		bounds:     image.Rect(0, 0, width*cellWidth, height*cellHeight),
+		theme:      theme,
+		palette:    gifPalette(theme),
+		indexes:    make(map[color.RGBA]uint8),
+	}
+}
+
+// gifPalette returns the 256 colors that can be used in a gif: the
+// theme's colors first, then the colors of the 256 color palette that
+// still fit. Other colors are replaced by the closest color of the
+// palette.
+func gifPalette(theme *Theme) color.Palette {
+	palette := color.Palette{}
+	seen := make(map[color.RGBA]bool)
+	add := func(c color.RGBA) {
+		if !seen[c] && len(palette) < 256 {
+			seen[c] = true
+			palette = append(palette, c)
+		}
+	}
+	add(theme.Background)
+	add(theme.Foreground)
+	for i := 0; i < 256; i++ {
+		add(theme.indexed(uint8(i)))
+	}
+	return palette
+}
+
+// index returns the index of a color in the palette.
+func (r *rasterizer) index(c color.RGBA) uint8 {
+	index, ok := r.indexes[c]
+	if !ok {
+		index = uint8(r.palette.Index(c))
+		r.indexes[c] = index
+	}
+	return index
+}
+
+// draw draws a screen on an image of the rasterizer's size. The cursor
+// is drawn as a block, by swapping the colors of its cell.
+func (r *rasterizer) draw(img *image.Paletted, screen *vt.Screen) {
+	for y, row := range screen.Cells {
+		for x, cell := range row {
+			fg, bg := r.theme.Colors(cell.Style)
+			if screen.CursorVisible && x == screen.CursorX && y == screen.CursorY {
+				fg, bg = bg, fg
+			}
+			r.drawCell(img, x*r.cellWidth, y*r.cellHeight, cell, r.index(fg), r.index(bg))
+		}
+	}
+}
+
+// drawCell draws a single cell, with its top left corner at left, top.
+func (r *rasterizer) drawCell(img *image.Paletted, left int, top int, cell vt.Cell, fg uint8, bg uint8) {
+	fill(img, image.Rect(left, top, left+r.cellWidth, top+r.cellHeight), bg)
+	if cell.Style.Attrs&vt.Hidden != 0 {
+		return
+	}
+
+	if !drawBox(img, left, top, r.cellWidth, r.cellHeight, r.scale, cell.Char, fg) && cell.Char != ' ' {
+		r.drawGlyph(img, left, top, cell.Char, fg)
+	}
+	if cell.Style.Attrs&vt.Underline != 0 {
+		y := top + (font.Ascent+1)*r.scale
+		fill(img, image.Rect(left, y, left+r.cellWidth, y+r.scale), fg)
+	}
+	if cell.Style.Attrs&vt.Strike != 0 {
+		y := top + font.Ascent*r.scale/2
+		fill(img, image.Rect(left, y, left+r.cellWidth, y+r.scale), fg)
+	}
+}
+
+// drawGlyph draws a character of the font. Each pixel of the glyph is
+// drawn as a square of the rasterizer's scale.
+func (r *rasterizer) drawGlyph(img *image.Paletted, left int, top int, char rune, fg uint8) {
+	_, mask, maskp, _, ok := font.Glyph(fixed.Point26_6{}, char)
+	if !ok {
+		return
+	}
+	alpha := mask.(*image.Alpha)
+	for y := 0; y < font.Height; y++ {
+		for x := 0; x < font.Width; x++ {
+			if alpha.AlphaAt(maskp.X+x, maskp.Y+y).A < 0x80 {
+				continue
+			}
+			pixelX, pixelY := left+(x+font.Left)*r.scale, top+y*r.scale
+			fill(img, image.Rect(pixelX, pixelY, pixelX+r.scale, pixelY+r.scale), fg)
+		}
+	}
+}
+
+// fill fills a rectangle of an image with a color.
+func fill(img *image.Paletted, rect image.Rectangle, index uint8) {
+	rect = rect.Intersect(img.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(rect.Min.X, y):img.PixOffset(rect.Max.X, y)]
+		for x := range row {
+			row[x] = index
+		}
+	}
+}
+
+// Directions of the lines of box drawing characters.
+const (
+	lineUp = 1 << iota
+	lineRight
+	lineDown
+	lineLeft
+)
+
+// boxLines are the lines of the box drawing characters that are drawn
+// without the font, which doesn't have them. Heavy and double lines are
+// drawn as light lines.
+var boxLines = map[rune]int{
+	'─': lineLeft | lineRight, '━': lineLeft | lineRight, '═': lineLeft | lineRight,
+	'│': lineUp | lineDown, '┃': lineUp | lineDown, '║': lineUp | lineDown,
+	'┌': lineRight | lineDown, '┏': lineRight | lineDown, '╔': lineRight | lineDown, '╭': lineRight | lineDown,
+	'┐': lineLeft | lineDown, '┓': lineLeft | lineDown, '╗': lineLeft | lineDown, '╮': lineLeft | lineDown,
+	'└': lineUp | lineRight, '┗': lineUp | lineRight, '╚': lineUp | lineRight, '╰': lineUp | lineRight,
+	'┘': lineUp | lineLeft, '┛': lineUp | lineLeft, '╝': lineUp | lineLeft, '╯': lineUp | lineLeft,
+	'├': lineUp | lineDown | lineRight, '┣': lineUp | lineDown | lineRight, '╠': lineUp | lineDown | lineRight,
+	'┤': lineUp | lineDown | lineLeft, '┫': lineUp | lineDown | lineLeft, '╣': lineUp | lineDown | lineLeft,
+	'┬': lineLeft | lineRight | lineDown, '┳': lineLeft | lineRight | lineDown, '╦': lineLeft | lineRight | lineDown,
+	'┴': lineLeft | lineRight | lineUp, '┻': lineLeft | lineRight | lineUp, '╩': lineLeft | lineRight | lineUp,
+	'┼': lineUp | lineDown | lineLeft | lineRight, '╋': lineUp | lineDown | lineLeft | lineRight, '╬': lineUp | lineDown | lineLeft | lineRight,
+}
+
+// drawBox draws box drawing and block characters. False is returned if
+// the character is not one of them.
+func drawBox(img *image.Paletted, left int, top int, width int, height int, thickness int, char rune, fg uint8) bool {
+	switch char {
+	case '█':
+		fill(img, image.Rect(left, top, left+width, top+height), fg)
+		return true
+	case '▀':
+		fill(img, image.Rect(left, top, left+width, top+height/2), fg)
+		return true
+	case '▄':
+		fill(img, image.Rect(left, top+height/2, left+width, top+height), fg)
+		return true
+	}
+
+	lines, ok := boxLines[char]
+	if !ok {
+		return false
+	}
+	centerX, centerY := left+(width-thickness)/2, top+(height-thickness)/2
+	if lines&lineUp != 0 {
+		fill(img, image.Rect(centerX, top, centerX+thickness, centerY+thickness), fg)
+	}
+	if lines&lineDown != 0 {
+		fill(img, image.Rect(centerX, centerY, centerX+thickness, top+height), fg)
+	}
+	if lines&lineLeft != 0 {
+		fill(img, image.Rect(left, centerY, centerX+thickness, centerY+thickness), fg)
+	}
+	if lines&lineRight != 0 {
+		fill(img, image.Rect(centerX, centerY, left+width, centerY+thickness), fg)
+	}
+	return true
+}
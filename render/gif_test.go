@@ -0,0 +1,121 @@
+package render
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestGif decodes the gif of a recording and checks its size, frames
+// and delays.
+func TestGif(t *testing.T) {
+	cast := testCast(4, 2, output(0.5, "ab"), output(1, "\x1b[?25l"), output(1.2, "\r\n─"))
+
+	var buffer bytes.Buffer
+	if err := Gif(cast, &buffer, GifOptions{Scale: 2}); err != nil {
+		t.Fatal(err)
+	}
+	animation, err := gif.DecodeAll(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if width, height := animation.Config.Width, animation.Config.Height; width != 4*7*2 || height != 2*13*2 {
+		t.Errorf("gif is %dx%d, want %dx%d", width, height, 4*7*2, 2*13*2)
+	}
+	if want := []int{50, 50, 20, lastFrameDelay}; !equalInts(animation.Delay, want) {
+		t.Errorf("gif has delays %v, want %v", animation.Delay, want)
+	}
+
+	// Frames after the first one only contain what changed, which is
+	// the last line here.
+	last := animation.Image[len(animation.Image)-1]
+	if bounds := last.Bounds(); bounds.Min.Y < 13*2 {
+		t.Errorf("last frame has bounds %v, want it to start on the second line", bounds)
+	}
+	// The middle of the box drawing character uses the text color.
+	if got := last.At(3*2, 13*2+6*2); !sameColor(got, DefaultTheme.Foreground) {
+		t.Errorf("box drawing character has color %v, want %v", got, DefaultTheme.Foreground)
+	}
+	if got := last.At(3*2, 13*2); !sameColor(got, DefaultTheme.Background) {
+		t.Errorf("cell around box drawing character has color %v, want %v", got, DefaultTheme.Background)
+	}
+}
+
+// TestGifMaxFPS makes sure that a gif doesn't have more frames than
+// allowed by MaxFPS.
+func TestGifMaxFPS(t *testing.T) {
+	cast := testCast(4, 1)
+	for i := 0; i < 20; i++ {
+		cast.Events = append(cast.Events, output(float64(i)*0.02, "a"))
+	}
+	var buffer bytes.Buffer
+	if err := Gif(cast, &buffer, GifOptions{MaxFPS: 10}); err != nil {
+		t.Fatal(err)
+	}
+	animation, err := gif.DecodeAll(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, delay := range animation.Delay {
+		if delay < 10 {
+			t.Errorf("frame %d has delay %d, want at least 10", i, delay)
+		}
+	}
+}
+
+// TestGifEndPause makes sure that the last frame of a gif lasts until
+// the end of the recording, even when the end doesn't change the screen.
+func TestGifEndPause(t *testing.T) {
+	cast := testCast(4, 1, output(0.5, "ab"), output(6, ""))
+	var buffer bytes.Buffer
+	if err := Gif(cast, &buffer, GifOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	animation, err := gif.DecodeAll(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{50, 550}; !equalInts(animation.Delay, want) {
+		t.Errorf("gif has delays %v, want %v", animation.Delay, want)
+	}
+}
+
+// TestGifFile writes a gif to a file.
+func TestGifFile(t *testing.T) {
+	gifPath := filepath.Join(t.TempDir(), "commands_1.gif")
+	if err := GifFile(testCast(4, 1, output(0.5, "a")), gifPath, GifOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(gifPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := gif.DecodeAll(file); err != nil {
+		t.Errorf("could not decode the gif: %s", err)
+	}
+}
+
+// sameColor checks whether or not two colors are the same.
+func sameColor(a color.Color, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+// equalInts checks whether or not two lists of integers are the same.
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package render
+
+import (
+	"fmt"
+	"html"
+	"image/color"
+	"strings"
+
+	"github.com/TrickyTroll/good-bot-cli/vt"
+)
+
+// htmlCell is a cell with the colors it is drawn with.
+type htmlCell struct {
+	char   rune
+	fg, bg color.RGBA
+	attrs  vt.Attr
+}
+
+// HTMLRows returns the rows of a screen as HTML. Each group of cells
+// that have the same style is written in a span, with an inline style
+// for the colors and attributes that are not the theme's defaults. The
+// cursor is drawn as a block, by swapping the colors of its cell.
+//
+// Rows are meant to be shown in a pre element that uses the theme's
+// colors, so the spaces at the end of a row that use the default style
+// are removed.
+func HTMLRows(screen *vt.Screen, theme *Theme) []string {
+	rows := make([]string, len(screen.Cells))
+	for y, row := range screen.Cells {
+		cells := make([]htmlCell, len(row))
+		for x, cell := range row {
+			fg, bg := theme.Colors(cell.Style)
+			if screen.CursorVisible && x == screen.CursorX && y == screen.CursorY {
+				fg, bg = bg, fg
+			}
+			cells[x] = htmlCell{cell.Char, fg, bg, cell.Style.Attrs & (textAttrs | vt.Hidden)}
+		}
+		// Only the default style can be removed at the end of a row.
+		end := len(cells)
+		for end > 0 && cells[end-1] == (htmlCell{' ', theme.Foreground, theme.Background, 0}) {
+			end--
+		}
+
+		var output strings.Builder
+		for start := 0; start < end; {
+			next := start + 1
+			for next < end && sameHTML(cells[next], cells[start]) {
+				next++
+			}
+			writeSpan(&output, cells[start:next], theme)
+			start = next
+		}
+		rows[y] = output.String()
+	}
+	return rows
+}
+
+// writeSpan writes a group of cells that have the same style. Cells
+// that use the default style are written without a span.
+func writeSpan(output *strings.Builder, cells []htmlCell, theme *Theme) {
+	var text strings.Builder
+	for _, cell := range cells {
+		if cell.attrs&vt.Hidden != 0 {
+			text.WriteRune(' ')
+		} else {
+			text.WriteRune(cell.char)
+		}
+	}
+	content := html.EscapeString(text.String())
+
+	var styles []string
+	style := cells[0]
+	if style.fg != theme.Foreground {
+		styles = append(styles, "color:"+HexColor(style.fg))
+	}
+	if style.bg != theme.Background {
+		styles = append(styles, "background:"+HexColor(style.bg))
+	}
+	if style.attrs&vt.Bold != 0 {
+		styles = append(styles, "font-weight:bold")
+	}
+	if style.attrs&vt.Italic != 0 {
+		styles = append(styles, "font-style:italic")
+	}
+	var decorations []string
+	if style.attrs&vt.Underline != 0 {
+		decorations = append(decorations, "underline")
+	}
+	if style.attrs&vt.Strike != 0 {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		styles = append(styles, "text-decoration:"+strings.Join(decorations, " "))
+	}
+
+	if len(styles) == 0 {
+		output.WriteString(content)
+		return
+	}
+	fmt.Fprintf(output, `<span style="%s">%s</span>`, strings.Join(styles, ";"), content)
+}
+
+// sameHTML checks whether or not two cells can be written in the same
+// span.
+func sameHTML(a htmlCell, b htmlCell) bool {
+	return a.fg == b.fg && a.bg == b.bg && a.attrs == b.attrs
+}
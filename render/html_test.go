@@ -0,0 +1,29 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/TrickyTroll/good-bot-cli/vt"
+)
+
+// TestHTMLRows checks the HTML of each row of a screen.
+func TestHTMLRows(t *testing.T) {
+	terminal := vt.New(8, 3)
+	terminal.Write([]byte("a<b> \x1b[1;31mred\x1b[0m\r\n\x1b[44m  \x1b[0m\x1b[8mhidden\x1b[0m\r\n"))
+
+	theme := &DefaultTheme
+	want := []string{
+		`a&lt;b&gt; <span style="color:` + HexColor(theme.Palette[9]) + `;font-weight:bold">red</span>`,
+		`<span style="background:` + HexColor(theme.Palette[4]) + `">  </span>      `,
+		`<span style="color:` + HexColor(theme.Background) + `;background:` + HexColor(theme.Foreground) + `"> </span>`,
+	}
+	got := HTMLRows(terminal.Screen(), theme)
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+}
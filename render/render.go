@@ -0,0 +1,82 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render draws asciicasts without an external program. Each
+// recording is replayed in a virtual terminal, and the screens it shows
+// are turned into an animation.
+package render
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+)
+
+// GifFile draws a recording as an animated gif, and writes it at
+// gifPath. See Gif for more information.
+func GifFile(cast *asciicast.Cast, gifPath string, options GifOptions) error {
+	return writeFile(gifPath, func(w io.Writer) error {
+		return Gif(cast, w, options)
+	})
+}
+
+// SVGFile draws a recording as an animated svg, and writes it at
+// svgPath. See SVG for more information.
+func SVGFile(cast *asciicast.Cast, svgPath string, options SVGOptions) error {
+	return writeFile(svgPath, func(w io.Writer) error {
+		return SVG(cast, w, options)
+	})
+}
+
+// APNGFile draws a recording as an animated png, and writes it at
+// pngPath. See APNG for more information.
+func APNGFile(cast *asciicast.Cast, pngPath string, options APNGOptions) error {
+	return writeFile(pngPath, func(w io.Writer) error {
+		return APNG(cast, w, options)
+	})
+}
+
+// writeFile writes a file using the provided function. The file is
+// written in a temporary file first, which replaces the destination once
+// it has been written completely.
+func writeFile(path string, write func(io.Writer) error) error {
+	temporary, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+
+	buffered := bufio.NewWriter(temporary)
+	if err := write(buffered); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temporary.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), path)
+}
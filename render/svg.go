@@ -0,0 +1,266 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package render
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/TrickyTroll/good-bot-cli/vt"
+)
+
+// SVGOptions controls how a recording is drawn in an svg.
+type SVGOptions struct {
+	// FontSize is the size of the text, in pixels. It is 14 by
+	// default.
+	FontSize float64
+	// MaxFPS is the highest number of frames shown each second. It can
+	// be at most 50, like with gifs.
+	MaxFPS int
+	// Theme is the theme used to draw the terminal. If it is nil, the
+	// recording's theme is used, or DefaultTheme if it has none.
+	Theme *Theme
+}
+
+// Sizes used inside of svgs. Cells are drawn with a font size of 10 and
+// are 6x12 units, so that every position can be written as an integer.
+// The svg is then scaled to the font size of the options.
+const (
+	svgFontSize   = 10
+	svgCellWidth  = 6
+	svgCellHeight = 12
+	// svgBaseline is the distance between the top of a cell and the
+	// baseline of its text.
+	svgBaseline = 9
+)
+
+// svgFonts are the fonts used to draw the text, in order of preference.
+const svgFonts = `Monaco, Consolas, 'Liberation Mono', 'DejaVu Sans Mono', 'Courier New', monospace`
+
+// SVG draws a recording as an animated svg. The screens shown by the
+// recording are drawn next to each other, and a CSS animation moves
+// them so that only the current one is visible. The text of each screen
+// is kept as text, which can be selected and copied.
+//
+// Like with gifs, the last screen is shown until the end of the
+// recording, and for at least 2 seconds, before the animation starts
+// again.
+func SVG(cast *asciicast.Cast, w io.Writer, options SVGOptions) error {
+	if options.FontSize <= 0 {
+		options.FontSize = 14
+	}
+	if options.MaxFPS < 1 || options.MaxFPS > 50 {
+		options.MaxFPS = 50
+	}
+	if options.Theme == nil {
+		options.Theme = ThemeFromHeader(&cast.Header)
+	}
+	frames := Frames(cast, (100+options.MaxFPS-1)/options.MaxFPS)
+
+	s := &svgWriter{theme: options.Theme, classes: map[color.RGBA]string{}}
+	width, height := cast.Header.Width*svgCellWidth, cast.Header.Height*svgCellHeight
+	for i, frame := range frames {
+		fmt.Fprintf(&s.body, `<g transform="translate(%d)">`, i*width)
+		s.frame(frame.Screen)
+		s.body.WriteString("</g>\n")
+	}
+
+	scale := options.FontSize / svgFontSize
+	var output strings.Builder
+	fmt.Fprintf(&output, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %d %d" font-family="%s" font-size="%d">`+"\n",
+		formatNumber(float64(width)*scale), formatNumber(float64(height)*scale), width, height, svgFonts, svgFontSize)
+	output.WriteString("<style>\n")
+	output.WriteString("text{white-space:pre}\n")
+	for _, c := range s.order {
+		fmt.Fprintf(&output, ".%s{fill:%s}\n", s.classes[c], HexColor(c))
+	}
+	if len(frames) > 1 {
+		writeKeyframes(&output, frames, width, lastDelay(cast, frames))
+	}
+	output.WriteString("</style>\n")
+	fmt.Fprintf(&output, `<rect width="%d" height="%d" fill="%s"/>`+"\n", width, height, HexColor(options.Theme.Background))
+	fmt.Fprintf(&output, `<svg width="%d" height="%d">`+"\n", width, height)
+	fmt.Fprintf(&output, `<g class="frames" fill="%s">`+"\n", HexColor(options.Theme.Foreground))
+	output.WriteString(s.body.String())
+	output.WriteString("</g>\n</svg>\n</svg>\n")
+
+	_, err := io.WriteString(w, output.String())
+	return err
+}
+
+// writeKeyframes writes the animation that moves the frames. Each
+// keyframe shows a frame, starting at the frame's time, and the steps
+// timing function keeps it until the next keyframe. The last frame is
+// shown for lastDelay centiseconds.
+func writeKeyframes(output *strings.Builder, frames []Frame, width int, lastDelay int) {
+	total := frames[len(frames)-1].Time + lastDelay
+	fmt.Fprintf(output, ".frames{animation:frames %ss steps(1,end) infinite}\n", formatNumber(float64(total)/100))
+	output.WriteString("@keyframes frames{")
+	for i, frame := range frames {
+		fmt.Fprintf(output, "%s%%{transform:translateX(%dpx)}", formatNumber(float64(frame.Time)*100/float64(total)), -i*width)
+	}
+	fmt.Fprintf(output, "100%%{transform:translateX(%dpx)}}\n", -(len(frames)-1)*width)
+}
+
+// svgWriter writes the frames of an svg. Colors are written as CSS
+// classes, which are shared by every frame.
+type svgWriter struct {
+	theme   *Theme
+	body    strings.Builder
+	classes map[color.RGBA]string
+	// order is the order in which the classes were created.
+	order []color.RGBA
+}
+
+// class returns the CSS class that fills an element with a color.
+func (s *svgWriter) class(c color.RGBA) string {
+	if name, ok := s.classes[c]; ok {
+		return name
+	}
+	name := "c" + strconv.Itoa(len(s.order))
+	s.classes[c] = name
+	s.order = append(s.order, c)
+	return name
+}
+
+// svgCell is a cell with the colors it is drawn with.
+type svgCell struct {
+	char   rune
+	fg, bg color.RGBA
+	attrs  vt.Attr
+}
+
+// frame writes the backgrounds and text of a screen. The cursor is
+// drawn as a block, by swapping the colors of its cell.
+func (s *svgWriter) frame(screen *vt.Screen) {
+	for y, row := range screen.Cells {
+		cells := make([]svgCell, len(row))
+		for x, cell := range row {
+			fg, bg := s.theme.Colors(cell.Style)
+			if screen.CursorVisible && x == screen.CursorX && y == screen.CursorY {
+				fg, bg = bg, fg
+			}
+			cells[x] = svgCell{cell.Char, fg, bg, cell.Style.Attrs}
+		}
+		s.backgrounds(cells, y)
+		s.text(cells, y)
+	}
+}
+
+// backgrounds writes a rectangle for each group of cells of a row that
+// have the same background color. The default background is drawn once
+// for the whole svg.
+func (s *svgWriter) backgrounds(cells []svgCell, y int) {
+	for start := 0; start < len(cells); {
+		end := start + 1
+		for end < len(cells) && cells[end].bg == cells[start].bg {
+			end++
+		}
+		if cells[start].bg != s.theme.Background {
+			fmt.Fprintf(&s.body, `<rect x="%d" y="%d" width="%d" height="%d" class="%s"/>`,
+				start*svgCellWidth, y*svgCellHeight, (end-start)*svgCellWidth, svgCellHeight, s.class(cells[start].bg))
+		}
+		start = end
+	}
+}
+
+// textAttrs are the attributes that change how text is drawn.
+const textAttrs = vt.Bold | vt.Italic | vt.Underline | vt.Strike
+
+// text writes the text of a row. Each group of cells that have the same
+// style is written in its own tspan, placed at the position of its first
+// cell. Groups that are only blank are skipped.
+func (s *svgWriter) text(cells []svgCell, y int) {
+	var spans strings.Builder
+	for start := 0; start < len(cells); {
+		end := start + 1
+		for end < len(cells) && sameText(cells[end], cells[start]) {
+			end++
+		}
+		s.span(&spans, cells[start:end], start)
+		start = end
+	}
+	if spans.Len() > 0 {
+		fmt.Fprintf(&s.body, `<text y="%d">%s</text>`, y*svgCellHeight+svgBaseline, spans.String())
+	}
+	s.body.WriteString("\n")
+}
+
+// span writes a tspan for a group of cells that have the same style,
+// starting at column x.
+func (s *svgWriter) span(spans *strings.Builder, cells []svgCell, x int) {
+	style := cells[0]
+	if style.attrs&vt.Hidden != 0 {
+		return
+	}
+	var text strings.Builder
+	for _, cell := range cells {
+		text.WriteRune(cell.char)
+	}
+	content := text.String()
+	if style.attrs&(vt.Underline|vt.Strike) == 0 {
+		content = strings.TrimRight(content, " ")
+	}
+	if content == "" {
+		return
+	}
+
+	fmt.Fprintf(spans, `<tspan x="%d"`, x*svgCellWidth)
+	if style.fg != s.theme.Foreground {
+		fmt.Fprintf(spans, ` class="%s"`, s.class(style.fg))
+	}
+	if style.attrs&vt.Bold != 0 {
+		spans.WriteString(` font-weight="bold"`)
+	}
+	if style.attrs&vt.Italic != 0 {
+		spans.WriteString(` font-style="italic"`)
+	}
+	var decorations []string
+	if style.attrs&vt.Underline != 0 {
+		decorations = append(decorations, "underline")
+	}
+	if style.attrs&vt.Strike != 0 {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		fmt.Fprintf(spans, ` text-decoration="%s"`, strings.Join(decorations, " "))
+	}
+	spans.WriteString(">")
+	xml.EscapeText(spans, []byte(content))
+	spans.WriteString("</tspan>")
+}
+
+// sameText checks whether or not the text of two cells can be written
+// in the same tspan.
+func sameText(a svgCell, b svgCell) bool {
+	return a.fg == b.fg && a.attrs&(textAttrs|vt.Hidden) == b.attrs&(textAttrs|vt.Hidden)
+}
+
+// HexColor writes a color as "#rrggbb", like in CSS.
+func HexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// formatNumber writes a number with at most 3 decimals.
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(math.Round(number*1000)/1000, 'f', -1, 64)
+}
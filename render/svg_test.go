@@ -0,0 +1,120 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// svgText returns the text of each frame of an svg, row by row. The svg
+// is also checked to be valid XML.
+func svgText(t *testing.T, data []byte) []string {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var frames []string
+	var text strings.Builder
+	depth, frameDepth, inText := 0, -1, false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("svg is not valid XML: %s", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+			if token.Name.Local == "g" && frameDepth == -1 && strings.HasPrefix(attr(token, "transform"), "translate(") {
+				frameDepth = depth
+				text.Reset()
+			}
+			inText = inText || token.Name.Local == "text"
+		case xml.EndElement:
+			if token.Name.Local == "text" && frameDepth != -1 {
+				text.WriteString("|")
+				inText = false
+			}
+			if depth == frameDepth {
+				frames = append(frames, text.String())
+				frameDepth = -1
+			}
+			depth--
+		case xml.CharData:
+			if inText {
+				text.Write(token)
+			}
+		}
+	}
+	return frames
+}
+
+// attr returns the value of an element's attribute.
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// TestSVG checks the frames and the animation of an svg.
+func TestSVG(t *testing.T) {
+	cast := testCast(6, 2, output(0.5, "a <b>"), output(1, "\r\n\x1b[31mred\x1b[0m"), output(1.5, "\x1b[?25l"))
+
+	var buffer bytes.Buffer
+	if err := SVG(cast, &buffer, SVGOptions{FontSize: 20}); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+
+	want := []string{"", "a <b>|", "a <b>|red|", "a <b>|red|"}
+	got := svgText(t, data)
+	if len(got) != len(want) {
+		t.Fatalf("svg has frames %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("frame %d has text %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	for _, part := range []string{
+		`width="72" height="48" viewBox="0 0 36 24"`,
+		".frames{animation:frames 3.5s steps(1,end) infinite}",
+		"14.286%{transform:translateX(-36px)}",
+		"100%{transform:translateX(-108px)}",
+		".c1{fill:" + HexColor(DefaultTheme.Palette[1]) + "}",
+		`<tspan x="0" class="c1">red</tspan>`,
+	} {
+		if !bytes.Contains(data, []byte(part)) {
+			t.Errorf("svg does not contain %q:\n%s", part, data)
+		}
+	}
+}
+
+// TestSVGStyles checks how the styles of cells are written.
+func TestSVGStyles(t *testing.T) {
+	cast := testCast(8, 1, output(0, "\x1b[?25l\x1b[1;3ma\x1b[0;4;9mb\x1b[0;44m  \x1b[0;8mc"))
+
+	var buffer bytes.Buffer
+	if err := SVG(cast, &buffer, SVGOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.String()
+	for _, part := range []string{
+		`<tspan x="0" font-weight="bold" font-style="italic">a</tspan>`,
+		`<tspan x="6" text-decoration="underline line-through">b</tspan>`,
+		`<rect x="12" y="0" width="12" height="12" class="c0"/>`,
+	} {
+		if !strings.Contains(data, part) {
+			t.Errorf("svg does not contain %q:\n%s", part, data)
+		}
+	}
+	// Hidden text is not written, and a single frame is not animated.
+	if strings.Contains(data, ">c<") || strings.Contains(data, "@keyframes") {
+		t.Errorf("svg contains hidden text or an animation:\n%s", data)
+	}
+}
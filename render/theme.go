@@ -0,0 +1,143 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package render
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/TrickyTroll/good-bot-cli/vt"
+)
+
+// Theme contains the colors used to draw a terminal.
+type Theme struct {
+	Foreground color.RGBA
+	Background color.RGBA
+	// Palette contains the 8 standard colors, followed by their bright
+	// versions.
+	Palette [16]color.RGBA
+}
+
+// DefaultTheme is the theme used by the Asciinema player.
+var DefaultTheme = Theme{
+	Foreground: rgb(0xcc, 0xcc, 0xcc),
+	Background: rgb(0x12, 0x13, 0x14),
+	Palette: [16]color.RGBA{
+		rgb(0x00, 0x00, 0x00), rgb(0xdd, 0x3c, 0x69), rgb(0x4e, 0xbf, 0x22), rgb(0xdd, 0xaf, 0x3c),
+		rgb(0x26, 0xb0, 0xd7), rgb(0xb9, 0x54, 0xe1), rgb(0x54, 0xe1, 0xb9), rgb(0xd9, 0xd9, 0xd9),
+		rgb(0x4d, 0x4d, 0x4d), rgb(0xdd, 0x3c, 0x69), rgb(0x4e, 0xbf, 0x22), rgb(0xdd, 0xaf, 0x3c),
+		rgb(0x26, 0xb0, 0xd7), rgb(0xb9, 0x54, 0xe1), rgb(0x54, 0xe1, 0xb9), rgb(0xff, 0xff, 0xff),
+	},
+}
+
+// ThemeFromHeader returns the theme of a recording. Recordings that
+// don't have a theme, or that have an invalid one, use DefaultTheme.
+func ThemeFromHeader(header *asciicast.Header) *Theme {
+	theme := DefaultTheme
+	if header.Theme == nil {
+		return &theme
+	}
+
+	fg, err := parseHexColor(header.Theme.Fg)
+	if err != nil {
+		return &theme
+	}
+	bg, err := parseHexColor(header.Theme.Bg)
+	if err != nil {
+		return &theme
+	}
+	colors := strings.Split(header.Theme.Palette, ":")
+	if len(colors) != 8 && len(colors) != 16 {
+		return &theme
+	}
+	var palette [16]color.RGBA
+	for i, hex := range colors {
+		if palette[i], err = parseHexColor(hex); err != nil {
+			return &theme
+		}
+	}
+	// Themes with 8 colors use the same colors for the bright ones.
+	if len(colors) == 8 {
+		copy(palette[8:], palette[:8])
+	}
+	return &Theme{Foreground: fg, Background: bg, Palette: palette}
+}
+
+// parseHexColor reads a color written as "#rrggbb".
+func parseHexColor(hex string) (color.RGBA, error) {
+	if len(hex) != 7 || hex[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", hex)
+	}
+	value, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", hex)
+	}
+	return rgb(uint8(value>>16), uint8(value>>8), uint8(value)), nil
+}
+
+// Colors returns the text and background colors of a cell. Bold text
+// that uses one of the 8 standard colors is drawn with its bright
+// version, like most terminals do.
+func (t *Theme) Colors(style vt.Style) (color.RGBA, color.RGBA) {
+	fg, bg := t.Foreground, t.Background
+	if index, ok := style.Fg.Index(); ok && index < 8 && style.Attrs&vt.Bold != 0 {
+		fg = t.color(vt.IndexedColor(index+8), fg)
+	} else {
+		fg = t.color(style.Fg, fg)
+	}
+	bg = t.color(style.Bg, bg)
+	if style.Attrs&vt.Inverse != 0 {
+		fg, bg = bg, fg
+	}
+	return fg, bg
+}
+
+// color returns the RGB value of a color, or def if it is the default
+// color.
+func (t *Theme) color(c vt.Color, def color.RGBA) color.RGBA {
+	if r, g, b, ok := c.RGB(); ok {
+		return rgb(r, g, b)
+	}
+	index, ok := c.Index()
+	if !ok {
+		return def
+	}
+	return t.indexed(index)
+}
+
+// indexed returns one of the 256 colors of the terminal. The first 16
+// come from the theme, and the others are the same on every terminal: a
+// 6x6x6 color cube followed by 24 shades of gray.
+func (t *Theme) indexed(index uint8) color.RGBA {
+	switch {
+	case index < 16:
+		return t.Palette[index]
+	case index < 232:
+		levels := [6]uint8{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+		i := index - 16
+		return rgb(levels[i/36], levels[i/6%6], levels[i%6])
+	default:
+		gray := 8 + (index-232)*10
+		return rgb(gray, gray, gray)
+	}
+}
+
+func rgb(r, g, b uint8) color.RGBA {
+	return color.RGBA{r, g, b, 0xff}
+}
@@ -0,0 +1,56 @@
+package render
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/TrickyTroll/good-bot-cli/asciicast"
+	"github.com/TrickyTroll/good-bot-cli/vt"
+)
+
+// TestThemeFromHeader reads the themes of recordings.
+func TestThemeFromHeader(t *testing.T) {
+	palette := "#000000:#110000:#002200:#000033:#440000:#005500:#000066:#777777"
+	theme := ThemeFromHeader(&asciicast.Header{Theme: &asciicast.Theme{Fg: "#ffffff", Bg: "#102030", Palette: palette}})
+	if theme.Background != rgb(0x10, 0x20, 0x30) || theme.Foreground != rgb(0xff, 0xff, 0xff) {
+		t.Errorf("theme has colors %v and %v, want #ffffff and #102030", theme.Foreground, theme.Background)
+	}
+	if theme.Palette[1] != rgb(0x11, 0, 0) || theme.Palette[9] != rgb(0x11, 0, 0) {
+		t.Errorf("theme has red colors %v and %v, want #110000", theme.Palette[1], theme.Palette[9])
+	}
+
+	var invalid = []*asciicast.Theme{
+		nil,
+		{Fg: "white", Bg: "#102030", Palette: palette},
+		{Fg: "#ffffff", Bg: "#102030", Palette: "#000000:#ffffff"},
+		{Fg: "#ffffff", Bg: "#102030", Palette: palette[:len(palette)-1] + "g"},
+	}
+	for _, header := range invalid {
+		if theme := ThemeFromHeader(&asciicast.Header{Theme: header}); *theme != DefaultTheme {
+			t.Errorf("theme %+v is not the default theme", header)
+		}
+	}
+}
+
+// TestColors checks the colors used to draw cells.
+func TestColors(t *testing.T) {
+	theme := &DefaultTheme
+	var testCases = []struct {
+		style  vt.Style
+		fg, bg color.RGBA
+	}{
+		{vt.Style{}, theme.Foreground, theme.Background},
+		{vt.Style{Fg: vt.IndexedColor(1), Bg: vt.IndexedColor(4)}, theme.Palette[1], theme.Palette[4]},
+		{vt.Style{Fg: vt.IndexedColor(1), Attrs: vt.Bold}, theme.Palette[9], theme.Background},
+		{vt.Style{Fg: vt.IndexedColor(16)}, rgb(0, 0, 0), theme.Background},
+		{vt.Style{Fg: vt.IndexedColor(231)}, rgb(0xff, 0xff, 0xff), theme.Background},
+		{vt.Style{Fg: vt.IndexedColor(232)}, rgb(8, 8, 8), theme.Background},
+		{vt.Style{Fg: vt.RGBColor(1, 2, 3), Attrs: vt.Inverse}, theme.Background, rgb(1, 2, 3)},
+	}
+	for _, tc := range testCases {
+		fg, bg := theme.Colors(tc.style)
+		if fg != tc.fg || bg != tc.bg {
+			t.Errorf("style %+v has colors %v and %v, want %v and %v", tc.style, fg, bg, tc.fg, tc.bg)
+		}
+	}
+}
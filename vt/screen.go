@@ -0,0 +1,172 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package vt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Screen is a copy of the contents of a terminal's screen, or of part
+// of it. Unlike a Terminal, it does not change when output is written.
+type Screen struct {
+	Width  int
+	Height int
+	// Cells are saved row by row.
+	Cells         [][]Cell
+	CursorX       int
+	CursorY       int
+	CursorVisible bool
+}
+
+// NewScreen creates a blank screen with the cursor in the top left
+// corner, which is what a terminal shows before anything is written.
+func NewScreen(width, height int) *Screen {
+	return &Screen{
+		Width:         width,
+		Height:        height,
+		Cells:         newCells(width, height),
+		CursorVisible: true,
+	}
+}
+
+// Screen returns a copy of the whole screen.
+func (t *Terminal) Screen() *Screen {
+	return t.Viewport(0, 0, t.width, t.height)
+}
+
+// Viewport returns a copy of part of the screen. The part starts at the
+// left column and top row, and can extend past the screen, in which case
+// the missing cells are blank. The cursor's position is relative to the
+// viewport, and it is hidden if it is outside of the viewport.
+func (t *Terminal) Viewport(left, top, width, height int) *Screen {
+	screen := &Screen{
+		Width:         width,
+		Height:        height,
+		Cells:         make([][]Cell, height),
+		CursorX:       t.x - left,
+		CursorY:       t.y - top,
+		CursorVisible: t.cursorVisible,
+	}
+	for y := range screen.Cells {
+		screen.Cells[y] = make([]Cell, width)
+		for x := range screen.Cells[y] {
+			screen.Cells[y][x] = t.Cell(left+x, top+y)
+		}
+	}
+	if screen.CursorX < 0 || screen.CursorY < 0 || screen.CursorX >= width || screen.CursorY >= height {
+		screen.CursorX = clamp(screen.CursorX, 0, width-1)
+		screen.CursorY = clamp(screen.CursorY, 0, height-1)
+		screen.CursorVisible = false
+	}
+	return screen
+}
+
+// Line returns the text of a row, without trailing spaces.
+func (s *Screen) Line(y int) string {
+	var line strings.Builder
+	for _, cell := range s.Cells[y] {
+		line.WriteRune(cell.Char)
+	}
+	return strings.TrimRight(line.String(), " ")
+}
+
+// String returns the text of the screen, one row per line. Styles and
+// the cursor are not part of the text.
+func (s *Screen) String() string {
+	lines := make([]string, s.Height)
+	for y := range lines {
+		lines[y] = s.Line(y)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Diff returns the output that turns the previous screen into this one
+// on a terminal of this screen's size. Only the rows that changed are
+// drawn again, starting from their first changed column. If previous is
+// nil, or if it doesn't have the same size, every row is drawn.
+//
+// Styles are reset each time a row is drawn, so the output does not
+// depend on the terminal's state. An empty string is returned if nothing
+// changed.
+func (s *Screen) Diff(previous *Screen) string {
+	if previous != nil && (previous.Width != s.Width || previous.Height != s.Height) {
+		previous = nil
+	}
+
+	var output strings.Builder
+	changed := false
+	for y, row := range s.Cells {
+		start := 0
+		if previous != nil {
+			start = firstDifference(row, previous.Cells[y])
+			if start == len(row) {
+				continue
+			}
+		}
+		changed = true
+		fmt.Fprintf(&output, "\x1b[%d;%dH", y+1, start+1)
+		drawRow(&output, row, start)
+	}
+
+	if changed || previous == nil || previous.CursorX != s.CursorX || previous.CursorY != s.CursorY {
+		fmt.Fprintf(&output, "\x1b[%d;%dH", s.CursorY+1, s.CursorX+1)
+	}
+	if previous == nil || previous.CursorVisible != s.CursorVisible {
+		if s.CursorVisible {
+			output.WriteString("\x1b[?25h")
+		} else {
+			output.WriteString("\x1b[?25l")
+		}
+	}
+	return output.String()
+}
+
+// drawRow writes the output that draws a row, starting at the provided
+// column. Trailing blank cells are erased instead of being written.
+func drawRow(output *strings.Builder, row []Cell, start int) {
+	last := len(row) - 1
+	for last >= start && row[last] == blank {
+		last--
+	}
+
+	style := Style{}
+	output.WriteString("\x1b[0m")
+	for _, cell := range row[start : last+1] {
+		if cell.Style != style {
+			style = cell.Style
+			output.WriteString(style.SGR())
+		}
+		output.WriteRune(cell.Char)
+	}
+	if !style.IsDefault() {
+		output.WriteString("\x1b[0m")
+	}
+	if last < len(row)-1 {
+		output.WriteString("\x1b[K")
+	}
+}
+
+// firstDifference returns the first column where two rows of the same
+// width differ, or the width of the rows if they are the same.
+func firstDifference(a []Cell, b []Cell) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return len(a)
+}
@@ -0,0 +1,71 @@
+package vt
+
+import (
+	"testing"
+)
+
+// TestViewport copies parts of a screen, including parts that go past
+// the screen's edges.
+func TestViewport(t *testing.T) {
+	terminal := run(4, 3, "abcd\r\nefgh\r\nij")
+
+	var testCases = []struct {
+		left, top     int
+		width, height int
+		want          string
+		visible       bool
+	}{
+		{0, 0, 4, 3, "abcd\nefgh\nij\n", true},
+		{1, 1, 2, 2, "fg\nj\n", true},
+		{0, 0, 2, 2, "ab\nef\n", false},
+		{2, 2, 4, 2, "\n\n", true},
+	}
+	for _, tc := range testCases {
+		viewport := terminal.Viewport(tc.left, tc.top, tc.width, tc.height)
+		if got := viewport.String(); got != tc.want {
+			t.Errorf("Viewport(%d, %d, %d, %d) shows %q, want %q", tc.left, tc.top, tc.width, tc.height, got, tc.want)
+		}
+		if viewport.CursorVisible != tc.visible {
+			t.Errorf("Viewport(%d, %d, %d, %d) has cursor visible %v, want %v", tc.left, tc.top, tc.width, tc.height, viewport.CursorVisible, tc.visible)
+		}
+	}
+}
+
+// TestDiff makes sure that writing the output of Diff to a terminal that
+// shows the previous screen makes it show the new screen.
+func TestDiff(t *testing.T) {
+	var steps = []string{
+		"hello",
+		"\r\n\x1b[1;31mworld\x1b[0m",
+		"\x1b[H\x1b[K",
+		"\x1b[3;2H\x1b[44m  \x1b[0m",
+		"\x1b[?25l",
+		"\x1b[2J\x1b[H\x1b[?25h",
+	}
+
+	source := New(6, 3)
+	replayed := New(6, 3)
+	previous := NewScreen(6, 3)
+	for _, step := range steps {
+		source.Write([]byte(step))
+		screen := source.Screen()
+		replayed.Write([]byte(screen.Diff(previous)))
+		previous = screen
+
+		got := replayed.Screen()
+		if got.String() != screen.String() || got.CursorX != screen.CursorX || got.CursorY != screen.CursorY || got.CursorVisible != screen.CursorVisible {
+			t.Fatalf("after %q, replayed screen is %q, want %q", step, got, screen)
+		}
+		for y := range screen.Cells {
+			for x := range screen.Cells[y] {
+				if got.Cells[y][x] != screen.Cells[y][x] {
+					t.Fatalf("after %q, cell %d,%d is %+v, want %+v", step, x, y, got.Cells[y][x], screen.Cells[y][x])
+				}
+			}
+		}
+	}
+
+	if output := source.Screen().Diff(previous); output != "" {
+		t.Errorf("Diff returned %q for screens that are the same", output)
+	}
+}
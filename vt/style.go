@@ -0,0 +1,209 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package vt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Color is the color of a cell's text or background. It is either the
+// terminal's default color, one of the 256 indexed colors, or an RGB
+// color.
+type Color uint32
+
+const (
+	colorIndexed Color = 1 << 24
+	colorRGB     Color = 2 << 24
+	colorKind    Color = 0xff << 24
+)
+
+// DefaultColor is the terminal's default foreground or background color.
+const DefaultColor Color = 0
+
+// IndexedColor returns one of the 256 colors of the terminal's palette.
+// The first 8 colors are the standard colors, and the next 8 colors are
+// their bright versions.
+func IndexedColor(index uint8) Color {
+	return colorIndexed | Color(index)
+}
+
+// RGBColor returns a true color.
+func RGBColor(r, g, b uint8) Color {
+	return colorRGB | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// IsDefault checks whether or not the color is the default color.
+func (c Color) IsDefault() bool {
+	return c == DefaultColor
+}
+
+// Index returns the index of an indexed color. False is returned if the
+// color is not an indexed color.
+func (c Color) Index() (uint8, bool) {
+	return uint8(c), c&colorKind == colorIndexed
+}
+
+// RGB returns the components of an RGB color. False is returned if the
+// color is not an RGB color.
+func (c Color) RGB() (uint8, uint8, uint8, bool) {
+	return uint8(c >> 16), uint8(c >> 8), uint8(c), c&colorKind == colorRGB
+}
+
+// Attr is a set of text attributes.
+type Attr uint16
+
+// Text attributes that can be set with SGR sequences.
+const (
+	Bold Attr = 1 << iota
+	Faint
+	Italic
+	Underline
+	Blink
+	Inverse
+	Hidden
+	Strike
+)
+
+// attrCodes are the SGR codes that set each attribute.
+var attrCodes = []struct {
+	attr Attr
+	code int
+}{
+	{Bold, 1}, {Faint, 2}, {Italic, 3}, {Underline, 4}, {Blink, 5}, {Inverse, 7}, {Hidden, 8}, {Strike, 9},
+}
+
+// Style is how a cell is displayed.
+type Style struct {
+	Fg    Color
+	Bg    Color
+	Attrs Attr
+}
+
+// IsDefault checks whether or not the style is the terminal's default
+// style.
+func (s Style) IsDefault() bool {
+	return s == Style{}
+}
+
+// SGR returns the escape sequence that sets the style. The sequence
+// always resets the previous style first.
+func (s Style) SGR() string {
+	codes := []string{"0"}
+	for _, attr := range attrCodes {
+		if s.Attrs&attr.attr != 0 {
+			codes = append(codes, strconv.Itoa(attr.code))
+		}
+	}
+	codes = append(codes, colorCodes(s.Fg, 30, 90, 38)...)
+	codes = append(codes, colorCodes(s.Bg, 40, 100, 48)...)
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// colorCodes returns the SGR codes that set a color. The base codes are
+// used for the standard colors, the bright codes for the bright colors
+// and the extended code for every other color.
+func colorCodes(c Color, base int, bright int, extended int) []string {
+	if index, ok := c.Index(); ok {
+		switch {
+		case index < 8:
+			return []string{strconv.Itoa(base + int(index))}
+		case index < 16:
+			return []string{strconv.Itoa(bright + int(index) - 8)}
+		default:
+			return []string{strconv.Itoa(extended), "5", strconv.Itoa(int(index))}
+		}
+	}
+	if r, g, b, ok := c.RGB(); ok {
+		return []string{strconv.Itoa(extended), "2", strconv.Itoa(int(r)), strconv.Itoa(int(g)), strconv.Itoa(int(b))}
+	}
+	return nil
+}
+
+// applySGR changes a style using the parameters of an SGR sequence.
+// Unknown parameters are ignored.
+func applySGR(style Style, params []int) Style {
+	if len(params) == 0 {
+		return Style{}
+	}
+
+	for i := 0; i < len(params); i++ {
+		param := params[i]
+		switch {
+		case param == 0:
+			style = Style{}
+		case param == 21:
+			style.Attrs |= Underline
+		case param == 22:
+			style.Attrs &^= Bold | Faint
+		case param == 23:
+			style.Attrs &^= Italic
+		case param == 24:
+			style.Attrs &^= Underline
+		case param == 25:
+			style.Attrs &^= Blink
+		case param == 27:
+			style.Attrs &^= Inverse
+		case param == 28:
+			style.Attrs &^= Hidden
+		case param == 29:
+			style.Attrs &^= Strike
+		case param >= 30 && param <= 37:
+			style.Fg = IndexedColor(uint8(param - 30))
+		case param == 39:
+			style.Fg = DefaultColor
+		case param >= 40 && param <= 47:
+			style.Bg = IndexedColor(uint8(param - 40))
+		case param == 49:
+			style.Bg = DefaultColor
+		case param >= 90 && param <= 97:
+			style.Fg = IndexedColor(uint8(param - 90 + 8))
+		case param >= 100 && param <= 107:
+			style.Bg = IndexedColor(uint8(param - 100 + 8))
+		case param == 38 || param == 48:
+			color, used := extendedColor(params[i+1:])
+			i += used
+			if used == 0 {
+				continue
+			}
+			if param == 38 {
+				style.Fg = color
+			} else {
+				style.Bg = color
+			}
+		default:
+			for _, attr := range attrCodes {
+				if attr.code == param || (attr.attr == Blink && param == 6) {
+					style.Attrs |= attr.attr
+				}
+			}
+		}
+	}
+	return style
+}
+
+// extendedColor reads a 256 color or an RGB color from the parameters
+// that follow a 38 or 48 SGR parameter. The number of parameters used is
+// returned along with the color.
+func extendedColor(params []int) (Color, int) {
+	if len(params) >= 2 && params[0] == 5 {
+		return IndexedColor(uint8(params[1])), 2
+	}
+	if len(params) >= 4 && params[0] == 2 {
+		return RGBColor(uint8(params[1]), uint8(params[2]), uint8(params[3])), 4
+	}
+	return DefaultColor, len(params)
+}
@@ -0,0 +1,632 @@
+/*
+Copyright © 2021 Etienne Parent <tricky@beon.ca>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vt is a virtual terminal that understands the escape
+// sequences used by shells and common terminal programs.
+//
+// Output recorded from a real terminal is written to a Terminal, which
+// keeps the contents of its screen up to date. The screen can then be
+// copied, compared and drawn again at another size, which is how
+// recordings are cropped and rendered.
+//
+// The terminal supports the usual VT100 and xterm sequences: cursor
+// movements, erasing, inserting and deleting, scroll regions, colors and
+// text attributes, the alternate screen and the DEC line drawing
+// characters. Sequences that it does not know about are ignored. Every
+// character takes a single column.
+package vt
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Cell is a single character on the screen.
+type Cell struct {
+	Char  rune
+	Style Style
+}
+
+// blank is an empty cell with the default style.
+var blank = Cell{Char: ' '}
+
+// parserState is what the parser is currently reading.
+type parserState int
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateCharset
+	stateCSI
+	stateString
+	stateStringEscape
+)
+
+// savedCursor is what is saved by DECSC and restored by DECRC.
+type savedCursor struct {
+	x, y     int
+	style    Style
+	graphics bool
+}
+
+// Terminal is a virtual terminal. It implements io.Writer, and everything
+// written to it is interpreted the way a terminal would.
+type Terminal struct {
+	width  int
+	height int
+	cells  [][]Cell
+	// The main screen is saved here while the alternate screen is used.
+	mainCells [][]Cell
+
+	x, y int
+	// Set when a character was printed in the last column. The next
+	// character is printed on the next line.
+	wrapPending bool
+	style       Style
+	saved       savedCursor
+
+	scrollTop    int
+	scrollBottom int
+
+	autowrap      bool
+	insert        bool
+	cursorVisible bool
+	// Whether or not the DEC line drawing characters are used.
+	graphics bool
+
+	state parserState
+	// Bytes of an incomplete UTF-8 character, kept for the next write.
+	pending []byte
+	params  []byte
+	// The byte that follows "ESC (" or the private marker of a CSI
+	// sequence.
+	marker byte
+}
+
+// New creates a terminal with a blank screen.
+func New(width, height int) *Terminal {
+	t := &Terminal{}
+	t.width, t.height = max(width, 1), max(height, 1)
+	t.reset()
+	return t
+}
+
+// reset brings the terminal back to its initial state.
+func (t *Terminal) reset() {
+	t.cells = newCells(t.width, t.height)
+	t.mainCells = nil
+	t.x, t.y = 0, 0
+	t.wrapPending = false
+	t.style = Style{}
+	t.saved = savedCursor{}
+	t.scrollTop, t.scrollBottom = 0, t.height-1
+	t.autowrap = true
+	t.insert = false
+	t.cursorVisible = true
+	t.graphics = false
+	t.state = stateGround
+}
+
+// newCells creates a blank screen.
+func newCells(width, height int) [][]Cell {
+	cells := make([][]Cell, height)
+	for y := range cells {
+		cells[y] = newLine(width)
+	}
+	return cells
+}
+
+// newLine creates a blank line.
+func newLine(width int) []Cell {
+	line := make([]Cell, width)
+	for x := range line {
+		line[x] = blank
+	}
+	return line
+}
+
+// Size returns the width and height of the terminal.
+func (t *Terminal) Size() (int, int) {
+	return t.width, t.height
+}
+
+// Cursor returns the position of the cursor and whether or not it is
+// visible. The top left corner is 0, 0.
+func (t *Terminal) Cursor() (int, int, bool) {
+	return t.x, t.y, t.cursorVisible
+}
+
+// Cell returns the cell at a position. Positions outside of the screen
+// are blank.
+func (t *Terminal) Cell(x, y int) Cell {
+	if x < 0 || y < 0 || x >= t.width || y >= t.height {
+		return blank
+	}
+	return t.cells[y][x]
+}
+
+// Resize changes the size of the terminal. Lines are cut or padded on the
+// right, and rows are removed or added at the bottom. The scroll region
+// is reset.
+func (t *Terminal) Resize(width, height int) {
+	width, height = max(width, 1), max(height, 1)
+	resize := func(cells [][]Cell) [][]Cell {
+		if cells == nil {
+			return nil
+		}
+		resized := newCells(width, height)
+		for y := 0; y < height && y < len(cells); y++ {
+			copy(resized[y], cells[y])
+		}
+		return resized
+	}
+	t.cells = resize(t.cells)
+	t.mainCells = resize(t.mainCells)
+	t.width, t.height = width, height
+	t.x, t.y = min(t.x, width-1), min(t.y, height-1)
+	t.wrapPending = false
+	t.scrollTop, t.scrollBottom = 0, height-1
+}
+
+// Write interprets the provided output. Escape sequences and UTF-8
+// characters can be split between writes.
+func (t *Terminal) Write(p []byte) (int, error) {
+	data := p
+	if len(t.pending) > 0 {
+		data = append(t.pending, p...)
+		t.pending = nil
+	}
+
+	for len(data) > 0 {
+		b := data[0]
+		if t.state != stateGround || b < utf8.RuneSelf {
+			t.handleByte(b)
+			data = data[1:]
+			continue
+		}
+		if !utf8.FullRune(data) {
+			t.pending = append([]byte(nil), data...)
+			break
+		}
+		char, size := utf8.DecodeRune(data)
+		t.print(char)
+		data = data[size:]
+	}
+	return len(p), nil
+}
+
+// handleByte interprets a single byte that is not part of a UTF-8
+// character.
+func (t *Terminal) handleByte(b byte) {
+	switch t.state {
+	case stateGround:
+		if b < 0x20 || b == 0x7f {
+			t.control(b)
+		} else {
+			t.print(rune(b))
+		}
+
+	case stateEscape:
+		t.escape(b)
+
+	case stateCharset:
+		if t.marker == '(' {
+			t.graphics = b == '0'
+		}
+		t.state = stateGround
+
+	case stateCSI:
+		switch {
+		case b == 0x1b:
+			t.state = stateEscape
+		case b == 0x18 || b == 0x1a:
+			t.state = stateGround
+		case b < 0x20:
+			// Control characters are executed in the middle of sequences.
+			t.control(b)
+		case b >= 0x40 && b <= 0x7e:
+			t.state = stateGround
+			t.csi(b)
+		case (b == '?' || b == '>' || b == '<' || b == '=') && len(t.params) == 0:
+			t.marker = b
+		default:
+			t.params = append(t.params, b)
+		}
+
+	case stateString:
+		// Operating system commands and other strings end with BEL or
+		// with ST, which is "ESC \".
+		if b == 0x07 || b == 0x18 || b == 0x1a {
+			t.state = stateGround
+		} else if b == 0x1b {
+			t.state = stateStringEscape
+		}
+
+	case stateStringEscape:
+		t.state = stateGround
+		if b != '\\' {
+			t.escape(b)
+		}
+	}
+}
+
+// control executes a control character.
+func (t *Terminal) control(b byte) {
+	switch b {
+	case '\r':
+		t.x = 0
+		t.wrapPending = false
+	case '\n', '\v', '\f':
+		t.lineFeed()
+	case '\b':
+		if t.x > 0 {
+			t.x--
+		}
+		t.wrapPending = false
+	case '\t':
+		t.x = min((t.x/8+1)*8, t.width-1)
+		t.wrapPending = false
+	case 0x1b:
+		t.state = stateEscape
+	}
+}
+
+// escape interprets the byte that follows ESC.
+func (t *Terminal) escape(b byte) {
+	t.state = stateGround
+	switch b {
+	case '[':
+		t.state = stateCSI
+		t.params = t.params[:0]
+		t.marker = 0
+	case ']', 'P', 'X', '^', '_':
+		t.state = stateString
+	case '(', ')', '*', '+', '#', '%':
+		t.state = stateCharset
+		t.marker = b
+	case '7':
+		t.saved = savedCursor{t.x, t.y, t.style, t.graphics}
+	case '8':
+		t.restoreCursor()
+	case 'D':
+		t.lineFeed()
+	case 'E':
+		t.x = 0
+		t.lineFeed()
+	case 'M':
+		t.reverseIndex()
+	case 'c':
+		t.reset()
+	}
+}
+
+// print writes a character at the cursor's position and moves the cursor.
+func (t *Terminal) print(char rune) {
+	if t.graphics {
+		if replacement, ok := lineDrawing[char]; ok {
+			char = replacement
+		}
+	}
+
+	if t.wrapPending {
+		t.x = 0
+		t.lineFeed()
+	}
+
+	line := t.cells[t.y]
+	if t.insert {
+		copy(line[t.x+1:], line[t.x:])
+	}
+	line[t.x] = Cell{char, t.style}
+
+	if t.x == t.width-1 {
+		t.wrapPending = t.autowrap
+	} else {
+		t.x++
+	}
+}
+
+// lineFeed moves the cursor down, and scrolls the scroll region if the
+// cursor is on its last line.
+func (t *Terminal) lineFeed() {
+	t.wrapPending = false
+	if t.y == t.scrollBottom {
+		t.scrollUp(1)
+	} else if t.y < t.height-1 {
+		t.y++
+	}
+}
+
+// reverseIndex moves the cursor up, and scrolls the scroll region down
+// if the cursor is on its first line.
+func (t *Terminal) reverseIndex() {
+	t.wrapPending = false
+	if t.y == t.scrollTop {
+		t.scrollDown(1)
+	} else if t.y > 0 {
+		t.y--
+	}
+}
+
+// scrollUp moves the lines of the scroll region up. New blank lines are
+// added at the bottom of the region.
+func (t *Terminal) scrollUp(n int) {
+	t.deleteLines(t.scrollTop, n)
+}
+
+// scrollDown moves the lines of the scroll region down. New blank lines
+// are added at the top of the region.
+func (t *Terminal) scrollDown(n int) {
+	t.insertLines(t.scrollTop, n)
+}
+
+// deleteLines removes n lines starting at row y, which should be in the
+// scroll region. The following lines of the region move up.
+func (t *Terminal) deleteLines(y int, n int) {
+	n = min(n, t.scrollBottom-y+1)
+	region := t.cells[y : t.scrollBottom+1]
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = newLine(t.width)
+	}
+}
+
+// insertLines adds n blank lines at row y, which should be in the scroll
+// region. The following lines of the region move down.
+func (t *Terminal) insertLines(y int, n int) {
+	n = min(n, t.scrollBottom-y+1)
+	region := t.cells[y : t.scrollBottom+1]
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = newLine(t.width)
+	}
+}
+
+// restoreCursor restores what was saved by DECSC.
+func (t *Terminal) restoreCursor() {
+	t.x, t.y = min(t.saved.x, t.width-1), min(t.saved.y, t.height-1)
+	t.style = t.saved.style
+	t.graphics = t.saved.graphics
+	t.wrapPending = false
+}
+
+// csiParams returns the numeric parameters of the current CSI sequence.
+// Empty parameters are returned as 0. Sub-parameters separated by colons
+// are read as regular parameters.
+func (t *Terminal) csiParams() []int {
+	if len(t.params) == 0 {
+		return nil
+	}
+	fields := strings.Split(strings.Replace(string(t.params), ":", ";", -1), ";")
+	params := make([]int, len(fields))
+	for i, field := range fields {
+		value, _ := strconv.Atoi(strings.TrimRight(field, " !\"#$%&'()*+,-./"))
+		params[i] = value
+	}
+	return params
+}
+
+// param returns a parameter, or def if it is missing or 0.
+func param(params []int, index int, def int) int {
+	if index >= len(params) || params[index] == 0 {
+		return def
+	}
+	return params[index]
+}
+
+// csi executes a CSI sequence, which ends with the final byte.
+func (t *Terminal) csi(final byte) {
+	params := t.csiParams()
+	n := param(params, 0, 1)
+
+	if t.marker == '?' {
+		if final == 'h' || final == 'l' {
+			for _, mode := range params {
+				t.setPrivateMode(mode, final == 'h')
+			}
+		}
+		return
+	}
+	if t.marker != 0 {
+		return
+	}
+
+	// Only a few sequences keep the pending wrap.
+	if final != 'm' {
+		t.wrapPending = false
+	}
+
+	switch final {
+	case 'A':
+		top := 0
+		if t.y >= t.scrollTop {
+			top = t.scrollTop
+		}
+		t.y = max(t.y-n, top)
+	case 'B', 'e':
+		bottom := t.height - 1
+		if t.y <= t.scrollBottom {
+			bottom = t.scrollBottom
+		}
+		t.y = min(t.y+n, bottom)
+	case 'C', 'a':
+		t.x = min(t.x+n, t.width-1)
+	case 'D':
+		t.x = max(t.x-n, 0)
+	case 'E':
+		t.y = min(t.y+n, t.height-1)
+		t.x = 0
+	case 'F':
+		t.y = max(t.y-n, 0)
+		t.x = 0
+	case 'G', '`':
+		t.x = clamp(n-1, 0, t.width-1)
+	case 'd':
+		t.y = clamp(n-1, 0, t.height-1)
+	case 'H', 'f':
+		t.y = clamp(param(params, 0, 1)-1, 0, t.height-1)
+		t.x = clamp(param(params, 1, 1)-1, 0, t.width-1)
+	case 'J':
+		t.eraseDisplay(param(params, 0, 0))
+	case 'K':
+		t.eraseLine(param(params, 0, 0))
+	case 'L':
+		if t.y >= t.scrollTop && t.y <= t.scrollBottom {
+			t.insertLines(t.y, n)
+			t.x = 0
+		}
+	case 'M':
+		if t.y >= t.scrollTop && t.y <= t.scrollBottom {
+			t.deleteLines(t.y, n)
+			t.x = 0
+		}
+	case 'P':
+		line := t.cells[t.y]
+		n = min(n, t.width-t.x)
+		copy(line[t.x:], line[t.x+n:])
+		t.fill(t.y, t.width-n, t.width)
+	case '@':
+		line := t.cells[t.y]
+		n = min(n, t.width-t.x)
+		copy(line[t.x+n:], line[t.x:])
+		t.fill(t.y, t.x, t.x+n)
+	case 'X':
+		t.fill(t.y, t.x, min(t.x+n, t.width))
+	case 'S':
+		t.scrollUp(n)
+	case 'T':
+		if len(params) <= 1 {
+			t.scrollDown(n)
+		}
+	case 'm':
+		t.style = applySGR(t.style, params)
+	case 'r':
+		top := param(params, 0, 1) - 1
+		bottom := param(params, 1, t.height) - 1
+		if top < bottom && bottom < t.height {
+			t.scrollTop, t.scrollBottom = top, bottom
+			t.x, t.y = 0, 0
+		}
+	case 's':
+		t.saved = savedCursor{t.x, t.y, t.style, t.graphics}
+	case 'u':
+		t.restoreCursor()
+	case 'h', 'l':
+		for _, mode := range params {
+			if mode == 4 {
+				t.insert = final == 'h'
+			}
+		}
+	}
+}
+
+// setPrivateMode sets or resets a DEC private mode.
+func (t *Terminal) setPrivateMode(mode int, set bool) {
+	switch mode {
+	case 7:
+		t.autowrap = set
+	case 25:
+		t.cursorVisible = set
+	case 47, 1047, 1049:
+		if mode == 1049 && set {
+			t.saved = savedCursor{t.x, t.y, t.style, t.graphics}
+		}
+		if set && t.mainCells == nil {
+			t.mainCells = t.cells
+			t.cells = newCells(t.width, t.height)
+		} else if !set && t.mainCells != nil {
+			t.cells = t.mainCells
+			t.mainCells = nil
+		}
+		if mode == 1049 && !set {
+			t.restoreCursor()
+		}
+	}
+}
+
+// eraseDisplay erases part of the screen. Mode 0 erases from the cursor
+// to the end of the screen, mode 1 from the start of the screen to the
+// cursor, and modes 2 and 3 erase the whole screen.
+func (t *Terminal) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		t.fill(t.y, t.x, t.width)
+		for y := t.y + 1; y < t.height; y++ {
+			t.fill(y, 0, t.width)
+		}
+	case 1:
+		for y := 0; y < t.y; y++ {
+			t.fill(y, 0, t.width)
+		}
+		t.fill(t.y, 0, t.x+1)
+	case 2, 3:
+		for y := 0; y < t.height; y++ {
+			t.fill(y, 0, t.width)
+		}
+	}
+}
+
+// eraseLine erases part of the cursor's line. Mode 0 erases from the
+// cursor to the end of the line, mode 1 from the start of the line to
+// the cursor, and mode 2 erases the whole line.
+func (t *Terminal) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		t.fill(t.y, t.x, t.width)
+	case 1:
+		t.fill(t.y, 0, t.x+1)
+	case 2:
+		t.fill(t.y, 0, t.width)
+	}
+}
+
+// fill erases the cells of a line from start to end, excluding end. The
+// erased cells keep the current background color.
+func (t *Terminal) fill(y int, start int, end int) {
+	erased := Cell{' ', Style{Bg: t.style.Bg}}
+	line := t.cells[y]
+	for x := max(start, 0); x < end && x < t.width; x++ {
+		line[x] = erased
+	}
+}
+
+// lineDrawing maps the characters of the DEC line drawing set to their
+// Unicode equivalent.
+var lineDrawing = map[rune]rune{
+	'`': '◆', 'a': '▒', 'f': '°', 'g': '±', 'j': '┘', 'k': '┐', 'l': '┌',
+	'm': '└', 'n': '┼', 'o': '⎺', 'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽',
+	't': '├', 'u': '┤', 'v': '┴', 'w': '┬', 'x': '│', 'y': '≤', 'z': '≥',
+	'{': 'π', '|': '≠', '}': '£', '~': '·',
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func clamp(value, low, high int) int {
+	return max(low, min(value, high))
+}
@@ -0,0 +1,132 @@
+package vt
+
+import (
+	"testing"
+)
+
+// run writes output to a new terminal and returns it.
+func run(width, height int, output ...string) *Terminal {
+	terminal := New(width, height)
+	for _, o := range output {
+		terminal.Write([]byte(o))
+	}
+	return terminal
+}
+
+// TestWrite writes output to small terminals and checks the text on
+// their screens.
+func TestWrite(t *testing.T) {
+	var testCases = []struct {
+		name   string
+		output []string
+		want   string
+	}{
+		{"text", []string{"hello\r\nworld"}, "hello\nworld\n\n"},
+		{"wrap", []string{"abcdefgh"}, "abcde\nfgh\n\n"},
+		{"no wrap", []string{"\x1b[?7labcdefgh"}, "abcdh\n\n\n"},
+		{"scroll", []string{"1\r\n2\r\n3\r\n4"}, "2\n3\n4\n"},
+		{"backspace", []string{"abc\b\bX"}, "aXc\n\n\n"},
+		{"tab", []string{"a\tb"}, "a   b\n\n\n"},
+		{"cursor position", []string{"\x1b[2;3Hx\x1b[Hy"}, "y\n  x\n\n"},
+		{"erase line", []string{"abcde\x1b[3G\x1b[K"}, "ab\n\n\n"},
+		{"erase display", []string{"abc\r\ndef\x1b[2J"}, "\n\n\n"},
+		{"insert characters", []string{"abc\x1b[G\x1b[2@"}, "  abc\n\n\n"},
+		{"delete characters", []string{"abcde\x1b[2G\x1b[2P"}, "ade\n\n\n"},
+		{"insert lines", []string{"1\r\n2\r\n3\x1b[2;1H\x1b[L"}, "1\n\n2\n"},
+		{"delete lines", []string{"1\r\n2\r\n3\x1b[1;1H\x1b[M"}, "2\n3\n\n"},
+		{"scroll region", []string{"1\r\n2\r\n3\x1b[1;2r\x1b[2;1H\n"}, "2\n\n3\n"},
+		{"reverse index", []string{"1\r\n2\x1b[H\x1bM"}, "\n1\n2\n"},
+		{"save cursor", []string{"a\x1b7\x1b[3;3Hb\x1b8c"}, "ac\n\n  b\n"},
+		{"line drawing", []string{"\x1b(0lqk\x1b(Bq"}, "┌─┐q\n\n\n"},
+		{"split sequence", []string{"a\x1b", "[2", ";2Hb"}, "a\n b\n\n"},
+		{"split character", []string{"\xc3", "\xa9t\xc3", "\xa9"}, "été\n\n\n"},
+		{"title", []string{"\x1b]0;title\x07a\x1b]2;other\x1b\\b"}, "ab\n\n\n"},
+		{"alternate screen", []string{"main\x1b[?1049h\x1b[2J\x1b[Halt"}, "alt\n\n\n"},
+		{"main screen", []string{"main\x1b[?1049h\x1b[2Jalt\x1b[?1049l"}, "main\n\n\n"},
+	}
+
+	for _, tc := range testCases {
+		got := run(5, 3, tc.output...).Screen().String()
+		if got != tc.want {
+			t.Errorf("%s: got screen %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestStyles checks the style of cells after SGR sequences.
+func TestStyles(t *testing.T) {
+	terminal := run(10, 1, "\x1b[1;31ma\x1b[0;4;38;5;200;48;2;1;2;3mb\x1b[22;39;49;94mc\x1b[md\x1b[7m\x1b[K")
+
+	var want = []Style{
+		{Fg: IndexedColor(1), Attrs: Bold},
+		{Fg: IndexedColor(200), Bg: RGBColor(1, 2, 3), Attrs: Underline},
+		{Fg: IndexedColor(12), Attrs: Underline},
+		{},
+		// Erased cells only keep the background color, which is the
+		// default one here.
+		{},
+	}
+	for x, style := range want {
+		if got := terminal.Cell(x, 0).Style; got != style {
+			t.Errorf("cell %d has style %+v, want %+v", x, got, style)
+		}
+	}
+}
+
+// TestSGR makes sure that the sequence returned by Style.SGR sets the
+// style again.
+func TestSGR(t *testing.T) {
+	var styles = []Style{
+		{},
+		{Fg: IndexedColor(3), Bg: IndexedColor(9), Attrs: Bold | Italic},
+		{Fg: IndexedColor(100), Attrs: Inverse | Strike},
+		{Fg: RGBColor(255, 0, 128), Bg: IndexedColor(0)},
+	}
+	for _, style := range styles {
+		terminal := run(2, 1, "\x1b[1;2;45m", style.SGR(), "a")
+		if got := terminal.Cell(0, 0).Style; got != style {
+			t.Errorf("%q sets style %+v, want %+v", style.SGR(), got, style)
+		}
+	}
+}
+
+// TestCursor checks the cursor's position and visibility.
+func TestCursor(t *testing.T) {
+	var testCases = []struct {
+		output  string
+		x, y    int
+		visible bool
+	}{
+		{"", 0, 0, true},
+		{"abc", 3, 0, true},
+		{"abcde", 4, 0, true},
+		{"\x1b[10;10H", 4, 2, true},
+		{"\x1b[2;2H\x1b[A\x1b[2C", 3, 0, true},
+		{"\x1b[?25l", 0, 0, false},
+		{"\x1b[?25l\x1bc", 0, 0, true},
+	}
+	for _, tc := range testCases {
+		x, y, visible := run(5, 3, tc.output).Cursor()
+		if x != tc.x || y != tc.y || visible != tc.visible {
+			t.Errorf("%q: cursor is at %d,%d (visible: %v), want %d,%d (visible: %v)", tc.output, x, y, visible, tc.x, tc.y, tc.visible)
+		}
+	}
+}
+
+// TestResize makes sure that resizing a terminal keeps the text that
+// still fits, starting from the top left corner.
+func TestResize(t *testing.T) {
+	terminal := run(5, 3, "abcde\r\nfghij\r\nklm")
+	terminal.Resize(3, 2)
+	if got, want := terminal.Screen().String(), "abc\nfgh\n"; got != want {
+		t.Errorf("got screen %q after shrinking, want %q", got, want)
+	}
+	terminal.Resize(4, 3)
+	if width, height := terminal.Size(); width != 4 || height != 3 {
+		t.Errorf("terminal has size %dx%d, want 4x3", width, height)
+	}
+	terminal.Write([]byte("\r\nnop"))
+	if got, want := terminal.Screen().String(), "abc\nfgh\nnop\n"; got != want {
+		t.Errorf("got screen %q after growing, want %q", got, want)
+	}
+}